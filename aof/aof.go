@@ -1,28 +1,37 @@
 package aof
 
 import (
-	"io"
+	"bufio"
+	"errors"
 	"os"
 	"redis-go/config"
 	"redis-go/constant"
 	databaseface "redis-go/interface/database"
 	"redis-go/lib/logger"
 	"redis-go/lib/utils"
+	"redis-go/rdb"
 	"redis-go/resp/connection"
-	"redis-go/resp/parser"
 	"redis-go/resp/reply"
 	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-const aofBufferSize = 1 << 16
+const (
+	aofBufferSize = 1 << 16
+	aofBatchSize  = 1 << 10 // 单次合并写入的最大payload数量
+)
 
 // aof通过异步方式传递命令数据，命令在执行结尾将数据通过payload传递到管道中
 // 显然由于database作为命令的实际执行者，我们是可以获取到当前命令执行所对应的dbIndex
 // 当然存在一个特例。当我们的select命令是额外执行的，所以我们要增加一个dbIndex命令，防止select命令丢失导致数据不一致问题
+// 事务中的多条命令需要保证一次性写入文件，这里一个payload可以包含多条命令
 type payload struct {
-	cmd     constant.CommandLine
+	cmds    []constant.CommandLine
 	dbIndex int
+	signal  *rewriteSignal // 不为nil时表示这是一个aof重写的控制信号，不包含命令
 }
 
 type AofHandler struct {
@@ -31,106 +40,260 @@ type AofHandler struct {
 	aofFile     *os.File              // 命令持久化文件
 	aofFileName string                // 命令持久化文件
 	currDB      int                   // 当前持久化所在db，和payload中的db对照使用
+	// 文件末尾的命令不完整时是否截断后继续加载
+	loadTruncated bool
+
+	// 刷盘相关
+	fsyncPolicy  string                // 刷盘策略，always/everysec/no
+	fileMu       sync.Mutex            // 后台刷盘和重写替换文件时需要持有，保证操作的是同一个文件
+	lastFsync    atomic.Int64          // 上一次刷盘的时间，unix毫秒
+	pendingBytes atomic.Int64          // 已经写入但尚未刷盘的字节数
+	lastWriteErr atomic.Pointer[error] // 最近一次写入失败的错误，之后写入成功时清空
+	lastFsyncErr atomic.Pointer[error] // 最近一次刷盘失败的错误，之后刷盘成功时清空
+	finished     chan struct{}         // 处理管道的协程退出的通知
+	closeChan    chan struct{}         // 关闭信号，用于停止后台刷盘
+	closeOnce    sync.Once
+	closeMu      sync.RWMutex // 写入管道时持有读锁，关闭管道时持有写锁，关闭之后不再写入管道
+	closed       bool
+
+	// aof重写相关
+	rewritePercentage int64        // 自动重写的增长比例，为0时关闭自动重写
+	rewriteMinSize    int64        // 自动重写的最小文件大小
+	rewriteLock       sync.Mutex   // 保证同一时间只有一个重写任务
+	rewriting         atomic.Bool  // 是否正在重写
+	buffering         bool         // 是否需要缓存写入的命令，只在处理管道的协程中访问
+	rewriteBuf        []byte       // 重写期间写入的命令，重写完成后追加到新文件的末尾
+	rewriteDB         int          // rewriteBuf 当前所在的db
+	fileSize          atomic.Int64 // 当前aof文件的大小
+	baseSize          atomic.Int64 // 启动或者上一次重写之后aof文件的大小，用于判断是否需要自动重写
 }
 
 func NewAofHandler(db databaseface.Database) (*AofHandler, error) {
 	handler := &AofHandler{
-		db: db,
+		db:                db,
+		fsyncPolicy:       parseFsyncPolicy(config.Properties.AppendFsync),
+		rewritePercentage: int64(config.Properties.AutoAofRewritePercentage),
+		rewriteMinSize:    int64(config.Properties.AutoAofRewriteMinSize),
+		loadTruncated:     parseLoadTruncated(config.Properties.AofLoadTruncated),
+		finished:          make(chan struct{}),
+		closeChan:         make(chan struct{}),
 	}
 	handler.aofFileName = config.Properties.AppendFilename
-	// 加载持久化文件
-	handler.LoadAof()
+	// 加载持久化文件，文件损坏时拒绝启动
+	if err := handler.LoadAof(); err != nil {
+		return nil, err
+	}
 	file, err := os.OpenFile(handler.aofFileName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return nil, err
 	}
 	handler.aofFile = file
+	if info, err := file.Stat(); err == nil {
+		handler.fileSize.Store(info.Size())
+		handler.baseSize.Store(info.Size())
+	}
 	// 创建持久化管道
 	handler.aofChan = make(chan *payload, aofBufferSize)
 	// 异步处理命令
 	go func() {
 		handler.handleAof()
 	}()
+	handler.lastFsync.Store(time.Now().UnixMilli())
+	if handler.fsyncPolicy == FsyncEverySec {
+		go handler.fsyncEverySecond()
+	}
 	return handler, nil
 }
 
+// Close 关闭aof，等待管道中剩余的命令全部写入文件并刷盘后关闭文件
 func (handler *AofHandler) Close() error {
+	handler.closeOnce.Do(func() {
+		handler.closeMu.Lock()
+		handler.closed = true
+		close(handler.aofChan)
+		handler.closeMu.Unlock()
+		<-handler.finished
+		close(handler.closeChan)
+	})
+	handler.fileMu.Lock()
+	defer handler.fileMu.Unlock()
+	_ = handler.aofFile.Sync()
 	return handler.aofFile.Close()
 }
 
-func (handler *AofHandler) LoadAof() {
+// LoadAof 加载aof文件，文件不存在时跳过
+// 文件末尾的命令不完整时按照 aofLoadTruncated 配置截断文件或者拒绝启动，文件中间损坏时总是拒绝启动
+func (handler *AofHandler) LoadAof() error {
 	// 1. 加载文件
 	logger.Info("[load aof file] start load aof file")
 	file, err := os.Open(handler.aofFileName)
 	if err != nil {
 		logger.Info("[load aof file] the aof file is not exist or open error", err)
-		return
+		return nil
 	}
-	// 2. 存在文件才会继续加载,利用parseStream进行文件的逐行读取
 	defer file.Close()
-	ch := parser.ParseStream(file)
-	// 3. 通过fakeConn来进行命令执行装载
-	fakeConn := &connection.Connection{}
-	for payload := range ch {
-		if payload.Err != nil {
-			// If the error is EOF or unexpected EOF, break the loop
-			if payload.Err == io.EOF || payload.Err == io.ErrUnexpectedEOF {
-				// End of file
-				break
-			}
-			logger.Error("[load aof file] parse error", payload.Err)
-			continue
-		}
-		if payload.Data == nil {
-			continue
-		}
-		// 4. 获取命令
-		bulkReply, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			continue
+	// 2. 混合格式的文件以rdb数据开头，先加载rdb数据，剩余的部分仍然是resp格式的命令
+	// rdb数据和之后的命令使用同一个reader流式读取，不需要把整个文件读入内存
+	src := bufio.NewReader(file)
+	var offset int64
+	if header, _ := src.Peek(rdb.HeaderSize); rdb.IsRDB(header) {
+		n, err := handler.loadPreamble(src)
+		if err != nil {
+			return err
 		}
+		offset = n
+	}
+	// 3. 通过fakeConn来进行命令执行装载
+	fakeConn := connection.NewFakeConnection()
+	validEnd, err := ReadCommands(src, offset, func(cmd constant.CommandLine, _ int64) bool {
 		// 为了保证回放的命令不再二次写入aof文件中，采用提前初始化AddAof方法的方式将其转换为空方法
-		rep := handler.db.Exec(fakeConn, bulkReply.Args) // 执行命令写入
+		rep := handler.db.Exec(fakeConn, cmd) // 执行命令写入
 		if reply.IsErrReply(rep) {
 			logger.Error("Execute AOF command error")
 		}
+		return true
+	})
+	if err != nil {
+		if !IsTruncated(err) || !handler.loadTruncated {
+			logger.Error("[load aof file] bad aof file, use aof-check --fix to repair it", err)
+			return err
+		}
+		// 4. 丢弃末尾不完整的命令，保证之后追加的命令能被正确解析
+		logger.Warn("[load aof file] truncate aof file to last valid command at offset "+strconv.FormatInt(validEnd, 10), err)
+		if err := os.Truncate(handler.aofFileName, validEnd); err != nil {
+			logger.Error("[load aof file] truncate aof file failed", err)
+			return err
+		}
 	}
 	logger.Info("[load aof file] load aof file success")
+	return nil
+}
+
+// SnapshotLoader 能够加载rdb格式数据的数据库，混合格式的aof文件需要通过它加载文件头
+type SnapshotLoader interface {
+	LoadSnapshotFrom(reader *bufio.Reader) (int64, error)
+}
+
+// loadPreamble 加载混合格式aof文件的rdb文件头，返回文件头的长度，之后的命令部分留在reader中
+func (handler *AofHandler) loadPreamble(src *bufio.Reader) (int64, error) {
+	loader, ok := handler.db.(SnapshotLoader)
+	if !ok {
+		return 0, errors.New("database does not support rdb preamble")
+	}
+	n, err := loader.LoadSnapshotFrom(src)
+	if err != nil {
+		logger.Error("[load aof file] load rdb preamble failed", err)
+		return 0, &CorruptedError{Offset: 0, Reason: "invalid rdb preamble: " + err.Error()}
+	}
+	logger.Info("[load aof file] load rdb preamble success")
+	return n, nil
 }
 
 func (handler *AofHandler) handleAof() {
-	handler.currDB = 0
+	defer close(handler.finished)
+	// 追加写入已有文件时无法确定文件末尾所在的db，第一条命令前总是补充select命令
+	handler.currDB = -1
 	// 从ch中获取命令，将命令持久化到文件中
+	// 管道中积压的命令合并成一次写入，减少系统调用和刷盘的次数
 	for pl := range handler.aofChan {
-		logger.Info("[handle aof] write command to file: ", pl.cmd)
-		var cmdToWrite []byte
+		batch := []*payload{pl}
+	drain:
+		for len(batch) < aofBatchSize {
+			select {
+			case next, ok := <-handler.aofChan:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		handler.writeBatch(batch)
+	}
+}
+
+// writeBatch 将一批命令写入文件，重写的控制信号需要在它之前的命令写入之后处理
+func (handler *AofHandler) writeBatch(batch []*payload) {
+	var cmdToWrite []byte
+	for _, pl := range batch {
+		if pl.signal != nil {
+			handler.writeAndSync(cmdToWrite)
+			cmdToWrite = nil
+			handler.handleRewriteSignal(pl.signal)
+			continue
+		}
+		logger.Info("[handle aof] write command to file: ", pl.cmds)
 		if pl.dbIndex != handler.currDB {
 			// 出现db切换现象，进行补充select命令
 			selectCmd := reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(pl.dbIndex))).ToBytes()
 			cmdToWrite = slices.Concat(cmdToWrite, selectCmd)
+			handler.currDB = pl.dbIndex
 		}
-		cmd := reply.MakeMultiBulkReply(pl.cmd).ToBytes()
-		cmdToWrite = slices.Concat(cmdToWrite, cmd)
-		// 将命令持久化的文件中
-		_, err := handler.aofFile.Write(cmdToWrite)
-		if err != nil {
-			logger.Error("[handle aof error] write cmd to file err! current command: " + string(cmd))
-			continue
+		for _, cmd := range pl.cmds {
+			cmdToWrite = slices.Concat(cmdToWrite, reply.MakeMultiBulkReply(cmd).ToBytes())
 		}
-		// 将命令刷盘，防止由于内存中的命令尚未持久化导致数据丢失
-		handler.aofFile.Sync()
+		// 重写期间命令需要同时写入旧文件和重写缓存，重写失败时旧文件仍然是完整的
+		if handler.buffering {
+			handler.appendRewriteBuf(pl)
+		}
+	}
+	handler.writeAndSync(cmdToWrite)
+}
 
+// writeAndSync 将数据写入文件，并按照刷盘策略决定是否立即刷盘
+func (handler *AofHandler) writeAndSync(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	// 将命令持久化的文件中
+	n, err := handler.aofFile.Write(data)
+	handler.fileSize.Add(int64(n))
+	handler.pendingBytes.Add(int64(n))
+	if err != nil {
+		logger.Error("[handle aof error] write cmd to file err! current command: " + string(data))
+		handler.lastWriteErr.Store(&err)
+		// 写入失败时无法确定文件末尾所在的db，下一条命令前补充select命令
+		handler.currDB = -1
+		return
+	}
+	handler.lastWriteErr.Store(nil)
+	// always 策略下每次写入都刷盘，防止由于内存中的命令尚未持久化导致数据丢失
+	if handler.fsyncPolicy == FsyncAlways {
+		handler.fsync()
 	}
 }
 
-func (handler *AofHandler) AddHandler(index int, line constant.CommandLine) {
-	// 合法性校验
-	if handler.aofChan == nil || !config.Properties.AppendOnly {
-		handler.aofChan = make(chan *payload, 100)
+// LastWriteError 最近一次写入或者刷盘失败的错误，写入和刷盘都恢复成功之后返回nil
+func (handler *AofHandler) LastWriteError() error {
+	if err := handler.lastWriteErr.Load(); err != nil {
+		return *err
+	}
+	if err := handler.lastFsyncErr.Load(); err != nil {
+		return *err
 	}
-	// 写入到channel中
-	handler.aofChan <- &payload{
-		cmd:     line,
-		dbIndex: index,
+	return nil
+}
+
+// PendingCommands 管道中等待写入文件的命令数
+func (handler *AofHandler) PendingCommands() int {
+	return len(handler.aofChan)
+}
+
+func (handler *AofHandler) AddHandler(index int, lines ...constant.CommandLine) {
+	// 写入到channel中，aof已经关闭时丢弃
+	if !handler.send(&payload{cmds: lines, dbIndex: index}) {
+		logger.Warn("[handle aof] aof is closed, discard command: ", lines)
+	}
+}
+
+// send 写入管道，aof已经关闭时返回false
+func (handler *AofHandler) send(pl *payload) bool {
+	handler.closeMu.RLock()
+	defer handler.closeMu.RUnlock()
+	if handler.closed {
+		return false
 	}
+	handler.aofChan <- pl
+	return true
 }
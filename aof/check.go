@@ -0,0 +1,207 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"redis-go/constant"
+	"redis-go/rdb"
+	"strconv"
+	"strings"
+)
+
+// aof文件的校验，加载aof文件和 aof-check 工具共用
+// 和处理网络请求的 parser 不同，这里严格按照 *<n>\r\n $<len>\r\n<data>\r\n 的格式读取，并记录每条命令在文件中的偏移量
+// 文件在命令中间结束时视为截断(通常是最后一次写入不完整)，其他不符合格式的数据视为损坏
+
+// maxBulkLen 单个参数的最大长度，防止损坏的长度字段导致申请过大的内存
+const maxBulkLen = 512 << 20
+
+// CorruptedError aof文件截断或者损坏
+type CorruptedError struct {
+	Offset    int64 // 出错的位置在文件中的偏移量
+	Truncated bool  // 文件在命令中间结束
+	Reason    string
+}
+
+func (e *CorruptedError) Error() string {
+	if e.Truncated {
+		return fmt.Sprintf("aof file truncated at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("aof file corrupted at offset %d: %s", e.Offset, e.Reason)
+}
+
+// IsTruncated 判断错误是否为文件截断
+func IsTruncated(err error) bool {
+	var corrupted *CorruptedError
+	return errors.As(err, &corrupted) && corrupted.Truncated
+}
+
+// cmdReader 逐条读取resp格式的命令，offset 为已经读取的数据在文件中的结束位置
+type cmdReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+// readLine 读取以\r\n结尾的一行，不包含\r\n
+func (r *cmdReader) readLine() ([]byte, error) {
+	start := r.offset
+	line, err := r.reader.ReadBytes('\n')
+	r.offset += int64(len(line))
+	if err != nil {
+		if err == io.EOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			return nil, &CorruptedError{Offset: start, Truncated: true, Reason: "unexpected end of file"}
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, &CorruptedError{Offset: start, Reason: "line is not terminated by CRLF"}
+	}
+	return line[:len(line)-2], nil
+}
+
+// readCommand 读取一条完整的命令，文件正常结束时返回 io.EOF
+func (r *cmdReader) readCommand() (constant.CommandLine, error) {
+	start := r.offset
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, &CorruptedError{Offset: start, Reason: "expect '*', got " + strconv.Quote(string(line))}
+	}
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count <= 0 {
+		return nil, &CorruptedError{Offset: start, Reason: "invalid multi bulk length " + strconv.Quote(string(line[1:]))}
+	}
+	cmd := make(constant.CommandLine, 0, count)
+	for i := 0; i < count; i++ {
+		headerOffset := r.offset
+		header, err := r.readLine()
+		if err == io.EOF {
+			return nil, &CorruptedError{Offset: start, Truncated: true, Reason: "unexpected end of file"}
+		}
+		if err != nil {
+			return nil, truncatedAt(err, start)
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, &CorruptedError{Offset: headerOffset, Reason: "expect '$', got " + strconv.Quote(string(header))}
+		}
+		size, err := strconv.Atoi(string(header[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, &CorruptedError{Offset: headerOffset, Reason: "invalid bulk length " + strconv.Quote(string(header[1:]))}
+		}
+		dataOffset := r.offset
+		data := make([]byte, size+2)
+		n, err := io.ReadFull(r.reader, data)
+		r.offset += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, &CorruptedError{Offset: start, Truncated: true, Reason: "unexpected end of file"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return nil, &CorruptedError{Offset: dataOffset + int64(size), Reason: "bulk string is not terminated by CRLF"}
+		}
+		cmd = append(cmd, data[:size])
+	}
+	return cmd, nil
+}
+
+// truncatedAt 截断的命令从命令的起始位置开始算起
+func truncatedAt(err error, start int64) error {
+	var corrupted *CorruptedError
+	if errors.As(err, &corrupted) && corrupted.Truncated {
+		corrupted.Offset = start
+	}
+	return err
+}
+
+// ReadCommands 从 offset 位置开始依次读取命令并回调，end 为命令结束的位置，consumer 返回false时停止读取
+// 返回值为最后一条完整命令结束的位置，事务只有读到exec或者discard之后才算完整，
+// 文件截断或者损坏时按照这个位置截断文件可以得到一个完整的aof文件
+func ReadCommands(src io.Reader, offset int64, consumer func(cmd constant.CommandLine, end int64) bool) (int64, error) {
+	r := &cmdReader{reader: bufio.NewReader(src), offset: offset}
+	validEnd := offset
+	multiStart := int64(-1) // 未结束的事务的起始位置
+	for {
+		start := r.offset
+		cmd, err := r.readCommand()
+		if err == io.EOF {
+			if multiStart >= 0 {
+				return multiStart, &CorruptedError{Offset: multiStart, Truncated: true, Reason: "MULTI without EXEC"}
+			}
+			return validEnd, nil
+		}
+		if err != nil {
+			return validEnd, err
+		}
+		switch strings.ToLower(string(cmd[0])) {
+		case "multi":
+			multiStart = start
+		case "exec", "discard":
+			multiStart = -1
+		}
+		if multiStart < 0 {
+			validEnd = r.offset
+		}
+		if !consumer(cmd, r.offset) {
+			return validEnd, nil
+		}
+	}
+}
+
+// CheckResult aof文件的校验结果
+type CheckResult struct {
+	Size      int64 // 文件大小
+	ValidSize int64 // 文件开头完整部分的大小
+	Preamble  bool  // 是否以rdb数据开头
+	Commands  int   // 读取到的完整命令数量，不包含rdb部分
+	Err       error // 截断或者损坏的原因，文件完整时为nil
+}
+
+// Check 校验aof文件，支持混合格式的文件，文件按照流的方式读取
+func Check(filename string) (*CheckResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Size: info.Size()}
+	src := bufio.NewReader(file)
+	var offset int64
+	if header, _ := src.Peek(rdb.HeaderSize); rdb.IsRDB(header) {
+		result.Preamble = true
+		n, err := rdb.ParseReader(src, nil)
+		if err != nil {
+			result.Err = &CorruptedError{Offset: 0, Reason: "invalid rdb preamble: " + err.Error()}
+			return result, nil
+		}
+		offset = n
+	}
+	result.ValidSize, result.Err = ReadCommands(src, offset, func(constant.CommandLine, int64) bool {
+		result.Commands++
+		return true
+	})
+	return result, nil
+}
+
+// parseLoadTruncated 解析 aofLoadTruncated 配置，未配置时允许截断
+func parseLoadTruncated(raw string) bool {
+	switch strings.ToLower(raw) {
+	case "no", "false":
+		return false
+	}
+	return true
+}
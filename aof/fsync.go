@@ -0,0 +1,72 @@
+package aof
+
+import (
+	"redis-go/lib/logger"
+	"strings"
+	"time"
+)
+
+// aof刷盘策略，和redis的 appendfsync 配置保持一致
+const (
+	FsyncAlways   = "always"   // 每次写入后立即刷盘，最多丢失一批命令
+	FsyncEverySec = "everysec" // 每秒在后台刷盘一次，最多丢失一秒的数据
+	FsyncNo       = "no"       // 不主动刷盘，由操作系统决定何时写入磁盘
+)
+
+// parseFsyncPolicy 解析刷盘策略，未配置或者配置错误时使用 everysec
+func parseFsyncPolicy(policy string) string {
+	switch strings.ToLower(policy) {
+	case FsyncAlways, FsyncNo:
+		return strings.ToLower(policy)
+	case "", FsyncEverySec:
+		return FsyncEverySec
+	}
+	logger.Error("[aof] unknown appendfsync policy, use everysec instead: " + policy)
+	return FsyncEverySec
+}
+
+// fsync 将已经写入的数据刷盘
+func (handler *AofHandler) fsync() {
+	handler.fileMu.Lock()
+	defer handler.fileMu.Unlock()
+	pending := handler.pendingBytes.Load()
+	if err := handler.aofFile.Sync(); err != nil {
+		logger.Error("[aof] fsync failed", err)
+		handler.lastFsyncErr.Store(&err)
+		return
+	}
+	handler.lastFsyncErr.Store(nil)
+	handler.pendingBytes.Add(-pending)
+	handler.lastFsync.Store(time.Now().UnixMilli())
+}
+
+// fsyncEverySecond everysec 策略下的后台刷盘任务
+func (handler *AofHandler) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if handler.pendingBytes.Load() > 0 {
+				handler.fsync()
+			}
+		case <-handler.closeChan:
+			return
+		}
+	}
+}
+
+// FsyncPolicy 当前使用的刷盘策略
+func (handler *AofHandler) FsyncPolicy() string {
+	return handler.fsyncPolicy
+}
+
+// LastFsyncTime 上一次刷盘的时间
+func (handler *AofHandler) LastFsyncTime() time.Time {
+	return time.UnixMilli(handler.lastFsync.Load())
+}
+
+// PendingBytes 已经写入文件但尚未刷盘的字节数
+func (handler *AofHandler) PendingBytes() int64 {
+	return handler.pendingBytes.Load()
+}
@@ -0,0 +1,84 @@
+package aof
+
+import (
+	"redis-go/constant"
+	"redis-go/datastruct/dict"
+	"redis-go/datastruct/list"
+	"redis-go/datastruct/set"
+	"redis-go/datastruct/sortedset"
+	databaseface "redis-go/interface/database"
+	"redis-go/lib/utils"
+	"strconv"
+	"time"
+)
+
+// 将内存中的数据实体转换为可以重建该数据的命令，用于aof重写
+
+// EntityToCmd 将数据实体转换为写入命令，不支持的类型返回nil
+func EntityToCmd(key string, entity *databaseface.DataEntity) constant.CommandLine {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return utils.ToCmdLineWithName("SET", []byte(key), val)
+	case list.List:
+		return listToCmd(key, val)
+	case dict.Dict:
+		return hashToCmd(key, val)
+	case *set.Set:
+		return setToCmd(key, val)
+	case *sortedset.SortedSet:
+		return zSetToCmd(key, val)
+	}
+	return nil
+}
+
+func listToCmd(key string, l list.List) constant.CommandLine {
+	args := make([][]byte, 0, 2+l.Len())
+	args = append(args, []byte("RPUSH"), []byte(key))
+	l.ForEach(func(i int, val interface{}) bool {
+		args = append(args, val.([]byte))
+		return true
+	})
+	return args
+}
+
+func hashToCmd(key string, hash dict.Dict) constant.CommandLine {
+	args := make([][]byte, 0, 2+hash.Len()*2)
+	args = append(args, []byte("HSET"), []byte(key))
+	hash.ForEach(func(field string, val interface{}) bool {
+		args = append(args, []byte(field), val.([]byte))
+		return true
+	})
+	return args
+}
+
+func setToCmd(key string, s *set.Set) constant.CommandLine {
+	args := make([][]byte, 0, 2+s.Len())
+	args = append(args, []byte("SADD"), []byte(key))
+	s.ForEach(func(member string) bool {
+		args = append(args, []byte(member))
+		return true
+	})
+	return args
+}
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) constant.CommandLine {
+	args := make([][]byte, 0, 2+zset.Len()*2)
+	args = append(args, []byte("ZADD"), []byte(key))
+	if zset.Len() == 0 {
+		return args
+	}
+	zset.ForEachByRank(0, zset.Len(), false, func(element *sortedset.Element) bool {
+		score := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		args = append(args, []byte(score), []byte(element.Member))
+		return true
+	})
+	return args
+}
+
+// MakeExpireCmd 生成设置过期时间的命令，过期时间统一使用绝对时间
+func MakeExpireCmd(key string, expireTime time.Time) constant.CommandLine {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(expireTime.UnixMilli(), 10))
+}
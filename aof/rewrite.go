@@ -0,0 +1,214 @@
+package aof
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"redis-go/lib/logger"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// aof重写，将当前内存中的数据转换为最少的命令写入新文件，替换掉不断追加的旧文件
+// 重写流程：
+// 1. StartRewrite 向管道中发送开始信号，信号之后的命令在写入旧文件的同时会缓存起来
+// 2. 调用方在信号发出时刻的数据快照基础上生成命令，通过 FinishRewrite 写入临时文件
+// 3. 处理管道的协程收到结束信号后，将缓存的命令追加到临时文件，原子地替换掉旧文件
+// 开启 aofUseRdbPreamble 时数据快照是rdb格式，重写后的文件由rdb文件头和resp格式的命令两部分组成
+
+// ErrRewriteInProgress 已经有重写任务在执行
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// ErrAofClosed aof已经关闭
+var ErrAofClosed = errors.New("ERR append only file is closed")
+
+const (
+	rewriteStart  = iota // 开始缓存命令
+	rewriteFinish        // 缓存的命令追加到临时文件后替换旧文件
+	rewriteAbort         // 放弃重写，丢弃缓存的命令
+)
+
+// rewriteSignal aof重写的控制信号，通过管道传递，保证和命令的先后顺序一致
+type rewriteSignal struct {
+	kind    int
+	tmpFile *os.File   // 结束信号携带的临时文件，已经写入了数据快照
+	done    chan error // 处理完成的通知
+}
+
+// IsRewriting 是否正在进行aof重写
+func (handler *AofHandler) IsRewriting() bool {
+	return handler.rewriting.Load()
+}
+
+// StartRewrite 开始aof重写，调用方需要保证在调用期间没有新的命令写入
+// 之后写入的命令都会被缓存起来，调用方此时生成的数据快照和缓存的命令共同组成完整的数据
+func (handler *AofHandler) StartRewrite() error {
+	if !handler.rewriteLock.TryLock() {
+		return ErrRewriteInProgress
+	}
+	handler.rewriting.Store(true)
+	if !handler.send(&payload{signal: &rewriteSignal{kind: rewriteStart}}) {
+		handler.rewriting.Store(false)
+		handler.rewriteLock.Unlock()
+		return ErrAofClosed
+	}
+	return nil
+}
+
+// FinishRewrite 将数据快照写入临时文件，并通知处理协程完成文件替换
+func (handler *AofHandler) FinishRewrite(snapshot []byte) error {
+	defer func() {
+		handler.rewriting.Store(false)
+		handler.rewriteLock.Unlock()
+	}()
+	dir, base := filepath.Split(handler.aofFileName)
+	if dir == "" {
+		dir = "."
+	}
+	tmpFile, err := os.CreateTemp(dir, base+".rewrite-*")
+	if err == nil {
+		_, err = tmpFile.Write(snapshot)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if err != nil {
+		logger.Error("[aof rewrite] write snapshot failed", err)
+		if tmpFile != nil {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpFile.Name())
+		}
+		handler.sendRewriteSignal(&rewriteSignal{kind: rewriteAbort})
+		return err
+	}
+	err = handler.sendRewriteSignal(&rewriteSignal{kind: rewriteFinish, tmpFile: tmpFile})
+	if errors.Is(err, ErrAofClosed) {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// AbortRewrite 放弃重写，调用方生成数据快照失败时使用
+func (handler *AofHandler) AbortRewrite() {
+	defer func() {
+		handler.rewriting.Store(false)
+		handler.rewriteLock.Unlock()
+	}()
+	_ = handler.sendRewriteSignal(&rewriteSignal{kind: rewriteAbort})
+}
+
+// sendRewriteSignal 发送控制信号并等待处理完成
+func (handler *AofHandler) sendRewriteSignal(signal *rewriteSignal) error {
+	signal.done = make(chan error, 1)
+	if !handler.send(&payload{signal: signal}) {
+		return ErrAofClosed
+	}
+	return <-signal.done
+}
+
+// handleRewriteSignal 处理重写的控制信号，在处理管道的协程中执行
+func (handler *AofHandler) handleRewriteSignal(signal *rewriteSignal) {
+	var err error
+	switch signal.kind {
+	case rewriteStart:
+		handler.buffering = true
+		handler.rewriteBuf = nil
+		handler.rewriteDB = -1
+	case rewriteFinish:
+		err = handler.replaceAofFile(signal.tmpFile)
+		handler.buffering = false
+		handler.rewriteBuf = nil
+	case rewriteAbort:
+		handler.buffering = false
+		handler.rewriteBuf = nil
+	}
+	if signal.done != nil {
+		signal.done <- err
+	}
+}
+
+// appendRewriteBuf 缓存重写期间写入的命令
+func (handler *AofHandler) appendRewriteBuf(pl *payload) {
+	if pl.dbIndex != handler.rewriteDB {
+		selectCmd := reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(pl.dbIndex))).ToBytes()
+		handler.rewriteBuf = slices.Concat(handler.rewriteBuf, selectCmd)
+		handler.rewriteDB = pl.dbIndex
+	}
+	for _, cmd := range pl.cmds {
+		handler.rewriteBuf = slices.Concat(handler.rewriteBuf, reply.MakeMultiBulkReply(cmd).ToBytes())
+	}
+}
+
+// replaceAofFile 将缓存的命令追加到临时文件，并用临时文件替换旧文件
+func (handler *AofHandler) replaceAofFile(tmpFile *os.File) error {
+	tmpName := tmpFile.Name()
+	_, err := tmpFile.Write(handler.rewriteBuf)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, handler.aofFileName)
+	}
+	if err != nil {
+		logger.Error("[aof rewrite] replace aof file failed", err)
+		_ = os.Remove(tmpName)
+		return err
+	}
+	// 旧文件已经被替换，重新打开新文件继续追加
+	file, err := os.OpenFile(handler.aofFileName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		logger.Error("[aof rewrite] reopen aof file failed", err)
+		return err
+	}
+	// 替换文件时不能和后台刷盘同时进行，新文件的内容在替换前已经刷盘
+	handler.fileMu.Lock()
+	_ = handler.aofFile.Close()
+	handler.aofFile = file
+	handler.pendingBytes.Store(0)
+	handler.lastFsync.Store(time.Now().UnixMilli())
+	handler.fileMu.Unlock()
+	// 新文件末尾所在的db就是缓存命令最后所在的db，没有缓存命令时无法确定
+	handler.currDB = handler.rewriteDB
+	if info, err := file.Stat(); err == nil {
+		handler.fileSize.Store(info.Size())
+		handler.baseSize.Store(info.Size())
+	}
+	logger.Info("[aof rewrite] rewrite aof file success")
+	return nil
+}
+
+// NeedRewrite 判断aof文件是否需要自动重写
+// 文件大小超过 autoAofRewriteMinSize，并且相比上一次重写增长超过 autoAofRewritePercentage 时触发
+func (handler *AofHandler) NeedRewrite() bool {
+	percentage := handler.rewritePercentage
+	if percentage <= 0 || handler.IsRewriting() {
+		return false
+	}
+	size := handler.fileSize.Load()
+	if size < handler.rewriteMinSize {
+		return false
+	}
+	base := handler.baseSize.Load()
+	if base <= 0 {
+		base = 1
+	}
+	return (size-base)*100/base >= int64(percentage)
+}
+
+// FileSize 当前aof文件的大小
+func (handler *AofHandler) FileSize() int64 {
+	return handler.fileSize.Load()
+}
+
+// BaseSize 启动或者上一次重写之后aof文件的大小
+func (handler *AofHandler) BaseSize() int64 {
+	return handler.baseSize.Load()
+}
@@ -0,0 +1,187 @@
+package cluster
+
+import (
+	"errors"
+	"redis-go/config"
+	"redis-go/database"
+	databaseface "redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/consistenthash"
+	"redis-go/lib/logger"
+	"redis-go/lib/pool"
+	"redis-go/lib/utils"
+	"redis-go/resp/client"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 集群模式，每个节点保存一部分key，通过一致性哈希确定key所在的节点
+// 客户端可以连接任意节点，key不在当前节点时由当前节点转发给对应的节点执行，再把结果返回给客户端
+
+const (
+	virtualNodes = 100 // 每个节点在哈希环上的虚拟节点数量
+	maxIdlePeers = 16  // 每个节点最多缓存的空闲连接数量
+)
+
+// relayCmd 节点之间转发命令时使用的内部命令，收到后直接在本地执行，不再进行路由
+const relayCmd = "_relay"
+
+// peerClient 到其他节点的连接，记录当前选择的db，切换db时才需要发送select
+type peerClient struct {
+	*client.Client
+	dbIndex int
+}
+
+// ClusterDatabase 集群模式的数据库，根据key把命令路由到对应的节点执行
+type ClusterDatabase struct {
+	self       string
+	nodes      []string
+	peerPicker *consistenthash.Map
+	peerPools  map[string]*pool.Pool[*peerClient]
+	db         *database.StandaloneDatabase // 当前节点保存的数据
+	txSeq      atomic.Uint64                // 分布式事务id的序号
+}
+
+// MakeClusterDatabase 根据配置文件中的 self 和 peers 创建集群数据库
+func MakeClusterDatabase() *ClusterDatabase {
+	return NewClusterDatabase(config.Properties.Self, config.Properties.Peers)
+}
+
+// NewClusterDatabase 创建集群数据库，self 为当前节点的地址，peers 为其他节点的地址
+func NewClusterDatabase(self string, peers []string) *ClusterDatabase {
+	c := &ClusterDatabase{
+		self:       self,
+		nodes:      []string{self},
+		peerPicker: consistenthash.New(virtualNodes, nil),
+		peerPools:  make(map[string]*pool.Pool[*peerClient]),
+		db:         database.NewStandaloneDatabase(),
+	}
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer == "" || peer == self {
+			continue
+		}
+		c.nodes = append(c.nodes, peer)
+		c.peerPools[peer] = makePeerPool(peer)
+	}
+	c.peerPicker.AddNode(c.nodes...)
+	return c
+}
+
+func makePeerPool(addr string) *pool.Pool[*peerClient] {
+	factory := func() (*peerClient, error) {
+		cli, err := client.MakeClient(addr)
+		if err != nil {
+			return nil, err
+		}
+		// 集群中的节点使用相同的密码
+		if password := config.Properties.RequirePass; password != "" {
+			res, err := cli.Send(utils.ToCmdLine("auth", password))
+			if errReply, ok := res.(*reply.StandardErrorReply); ok {
+				err = errors.New(errReply.Status)
+			}
+			if err != nil {
+				_ = cli.Close()
+				return nil, err
+			}
+		}
+		return &peerClient{Client: cli, dbIndex: -1}, nil
+	}
+	finalizer := func(cli *peerClient) {
+		_ = cli.Close()
+	}
+	return pool.New(factory, finalizer, maxIdlePeers)
+}
+
+// Exec 执行命令，需要的话转发给其他节点
+func (c *ClusterDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("error occurs when processing command in cluster", err)
+		}
+	}()
+	cmdName := strings.ToLower(string(args[0]))
+	// 转发之前检查认证和acl权限，其他节点上的连接已经认证过
+	if errReply := c.db.CheckAccess(client, args); errReply != nil {
+		return errReply
+	}
+	if cmdFunc, ok := router[cmdName]; ok {
+		return cmdFunc(c, client, args)
+	}
+	return defaultFunc(c, client, args)
+}
+
+// SetClients 设置当前所有的客户端连接，client 命令在本地数据库执行
+func (c *ClusterDatabase) SetClients(clients databaseface.Clients) {
+	c.db.SetClients(clients)
+}
+
+// AfterClientClose 客户端连接关闭
+func (c *ClusterDatabase) AfterClientClose(client resp.Connection) {
+	c.db.AfterClientClose(client)
+}
+
+// Close 关闭到其他节点的连接和本地数据库
+func (c *ClusterDatabase) Close() {
+	for _, peerPool := range c.peerPools {
+		peerPool.Close()
+	}
+	c.db.Close()
+}
+
+// execLocal 在当前节点执行命令，不再进行路由
+func (c *ClusterDatabase) execLocal(client resp.Connection, args [][]byte) resp.Reply {
+	switch strings.ToLower(string(args[0])) {
+	case prepareCmd, commitCmd, rollbackCmd:
+		return execTxCmd(c, client, args)
+	}
+	return c.db.Exec(client, args)
+}
+
+// relay 把命令交给 peer 节点执行，peer 为当前节点时直接在本地执行
+func (c *ClusterDatabase) relay(peer string, client resp.Connection, args [][]byte) resp.Reply {
+	if peer == c.self {
+		return c.execLocal(client, args)
+	}
+	peerPool, ok := c.peerPools[peer]
+	if !ok {
+		return reply.MakeStandardErrorReply("ERR unknown peer " + peer)
+	}
+	cli, err := peerPool.Get()
+	if err != nil {
+		return reply.MakeStandardErrorReply("ERR connect to peer " + peer + " failed: " + err.Error())
+	}
+	// 其他节点上的db需要和客户端当前选择的db一致
+	dbIndex := client.GetDBIndex()
+	if cli.dbIndex != dbIndex {
+		res, err := cli.Send(utils.ToCmdLine(relayCmd, "select", strconv.Itoa(dbIndex)))
+		if err != nil {
+			_ = cli.Close()
+			return reply.MakeStandardErrorReply("ERR relay to peer " + peer + " failed: " + err.Error())
+		}
+		if reply.IsErrReply(res) {
+			peerPool.Put(cli)
+			return res
+		}
+		cli.dbIndex = dbIndex
+	}
+	res, err := cli.Send(append([][]byte{[]byte(relayCmd)}, args...))
+	if err != nil {
+		// 连接出错后无法确定连接的状态，直接丢弃
+		_ = cli.Close()
+		return reply.MakeStandardErrorReply("ERR relay to peer " + peer + " failed: " + err.Error())
+	}
+	peerPool.Put(cli)
+	return res
+}
+
+// broadcast 把命令发送给所有节点执行，返回每个节点的执行结果
+func (c *ClusterDatabase) broadcast(client resp.Connection, args [][]byte) map[string]resp.Reply {
+	result := make(map[string]resp.Reply, len(c.nodes))
+	for _, node := range c.nodes {
+		result[node] = c.relay(node, client, args)
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"redis-go/database"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"strings"
+)
+
+// CmdFunc 集群模式下需要特殊处理的命令
+type CmdFunc func(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply
+
+var router = makeRouter()
+
+func makeRouter() map[string]CmdFunc {
+	routerMap := map[string]CmdFunc{
+		relayCmd:   execRelay,
+		"flush":    execFlush,
+		"keys":     execKeys,
+		"publish":  execPublish,
+		"mget":     execMGet,
+		"exists":   execExists,
+		"del":      execDel,
+		"rename":   execRename,
+		"renamenx": execRename,
+		"msetnx":   execMSetNX,
+	}
+	// 事务涉及的key可能分布在不同的节点上，暂不支持
+	for _, cmdName := range []string{"multi", "exec", "discard", "watch", "unwatch"} {
+		routerMap[cmdName] = execNotSupported
+	}
+	return routerMap
+}
+
+// defaultFunc 根据命令涉及的key确定执行的节点，不涉及key的命令在本地执行
+func defaultFunc(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	writeKeys, readKeys, ok := database.GetRelatedKeys(args)
+	if !ok {
+		return c.db.Exec(client, args)
+	}
+	peer := ""
+	for _, key := range append(writeKeys, readKeys...) {
+		node := c.peerPicker.PickNode(key)
+		if peer != "" && node != peer {
+			return reply.MakeStandardErrorReply("ERR keys in request don't hash to the same node")
+		}
+		peer = node
+	}
+	return c.relay(peer, client, args)
+}
+
+// execRelay 其他节点转发过来的命令，直接在本地执行
+func execRelay(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply(relayCmd)
+	}
+	// 事务命令在本地执行时不经过 StandaloneDatabase.Exec，需要在这里检查命令和其中涉及的key的权限
+	switch strings.ToLower(string(args[1])) {
+	case prepareCmd, commitCmd, rollbackCmd:
+		if errReply := c.db.CheckAccess(client, args[1:]); errReply != nil {
+			return errReply
+		}
+		if strings.EqualFold(string(args[1]), prepareCmd) && len(args) > 3 {
+			if errReply := c.db.CheckTxAccess(client, args[3:]); errReply != nil {
+				return errReply
+			}
+		}
+	}
+	return c.execLocal(client, args[1:])
+}
+
+// execNotSupported 集群模式下不支持的命令
+func execNotSupported(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	return reply.MakeStandardErrorReply("ERR command '" + strings.ToLower(string(args[0])) + "' is not supported in cluster mode")
+}
+
+// execFlush 清空所有节点上的数据
+func execFlush(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	for _, res := range c.broadcast(client, args) {
+		if reply.IsErrReply(res) {
+			return res
+		}
+	}
+	return reply.MakeOKReply()
+}
+
+// execKeys 合并所有节点上匹配的key
+func execKeys(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	var keys [][]byte
+	for _, res := range c.broadcast(client, args) {
+		if reply.IsErrReply(res) {
+			return res
+		}
+		if multiBulk, ok := res.(*reply.MultiBulkReply); ok {
+			keys = append(keys, multiBulk.Args...)
+		}
+	}
+	if len(keys) == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return reply.MakeMultiBulkReply(keys)
+}
+
+// execPublish 订阅者可能连接在任意节点上，消息需要发布到所有节点，返回收到消息的订阅者总数
+func execPublish(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	var count int64
+	for _, res := range c.broadcast(client, args) {
+		if reply.IsErrReply(res) {
+			return res
+		}
+		if intReply, ok := res.(*reply.IntReply); ok {
+			count += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(count)
+}
+
+// groupByNode 按照所在的节点对key进行分组，记录每个key在参数中的位置
+func (c *ClusterDatabase) groupByNode(keys [][]byte) (map[string][][]byte, map[string][]int) {
+	groups := make(map[string][][]byte)
+	indexes := make(map[string][]int)
+	for i, key := range keys {
+		node := c.peerPicker.PickNode(string(key))
+		groups[node] = append(groups[node], key)
+		indexes[node] = append(indexes[node], i)
+	}
+	return groups, indexes
+}
+
+// execMGet 分别从每个节点读取key，再按照原来的顺序合并结果
+func execMGet(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("mget")
+	}
+	groups, indexes := c.groupByNode(args[1:])
+	result := make([][]byte, len(args)-1)
+	for node, keys := range groups {
+		res := c.relay(node, client, append([][]byte{args[0]}, keys...))
+		if reply.IsErrReply(res) {
+			return res
+		}
+		multiBulk, ok := res.(*reply.MultiBulkReply)
+		if !ok || len(multiBulk.Args) != len(keys) {
+			return reply.MakeStandardErrorReply("ERR unexpected reply from peer " + node)
+		}
+		for i, value := range multiBulk.Args {
+			result[indexes[node][i]] = value
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execExists 分别在每个节点上统计存在的key，再求和
+func execExists(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("exists")
+	}
+	groups, _ := c.groupByNode(args[1:])
+	var count int64
+	for node, keys := range groups {
+		res := c.relay(node, client, append([][]byte{args[0]}, keys...))
+		if reply.IsErrReply(res) {
+			return res
+		}
+		if intReply, ok := res.(*reply.IntReply); ok {
+			count += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(count)
+}
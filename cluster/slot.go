@@ -0,0 +1,55 @@
+package cluster
+
+import "strings"
+
+// 和redis cluster一致的哈希槽计算，key通过 CRC16(key) mod 16384 映射到槽
+// key中包含 {tag} 时只使用tag计算，保证相关的key分配到同一个槽
+
+// SlotCount 哈希槽的数量
+const SlotCount = 16384
+
+// crc16Table CRC16-CCITT(XMODEM)查找表，多项式为0x1021
+var crc16Table = makeCrc16Table()
+
+func makeCrc16Table() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// crc16 计算CRC16校验值
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// KeySlot 计算key所在的哈希槽
+func KeySlot(key string) int {
+	return int(crc16([]byte(hashTag(key)))) % SlotCount
+}
+
+// hashTag 获取key中第一个 { 和之后第一个 } 之间的内容，内容为空或者不存在时使用整个key
+func hashTag(key string) string {
+	beg := strings.IndexByte(key, '{')
+	if beg == -1 {
+		return key
+	}
+	end := strings.IndexByte(key[beg+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[beg+1 : beg+1+end]
+}
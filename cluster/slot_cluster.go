@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net"
+	"redis-go/config"
+	"redis-go/database"
+	databaseface "redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redis cluster 模式，16384个哈希槽平均分配给所有节点
+// 和 ClusterDatabase 不同，key不在当前节点时不转发命令，而是返回 MOVED 让客户端直接访问负责的节点，
+// 槽正在迁移时，已经迁走的key返回 ASK，客户端先发送 ASKING 再到目标节点执行命令
+
+// slotNode 集群中的节点
+type slotNode struct {
+	id   string // 节点id，使用地址的sha1，所有节点计算出的结果一致
+	addr string
+	host string
+	port int
+}
+
+func makeSlotNode(addr string) (*slotNode, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, errors.New("invalid port in address " + addr)
+	}
+	sum := sha1.Sum([]byte(addr))
+	return &slotNode{
+		id:   hex.EncodeToString(sum[:]),
+		addr: addr,
+		host: host,
+		port: port,
+	}, nil
+}
+
+// SlotClusterDatabase 使用哈希槽的集群数据库，只执行属于当前节点的key
+type SlotClusterDatabase struct {
+	self  *slotNode
+	nodes []*slotNode // 按照地址排序，所有节点的顺序一致
+
+	mu        sync.RWMutex
+	slots     []*slotNode       // 槽 -> 负责的节点
+	migrating map[int]*slotNode // 正在迁出的槽 -> 目标节点
+	importing map[int]*slotNode // 正在迁入的槽 -> 源节点
+
+	asking sync.Map // 执行了 ASKING 的客户端，只对下一条命令有效
+	db     *database.StandaloneDatabase
+}
+
+// MakeSlotClusterDatabase 根据配置文件中的 self 和 peers 创建集群数据库
+func MakeSlotClusterDatabase() *SlotClusterDatabase {
+	return NewSlotClusterDatabase(config.Properties.Self, config.Properties.Peers)
+}
+
+// NewSlotClusterDatabase 创建集群数据库，按照地址排序后依次为每个节点分配连续的哈希槽
+func NewSlotClusterDatabase(self string, peers []string) *SlotClusterDatabase {
+	selfNode, err := makeSlotNode(self)
+	if err != nil {
+		logger.Error("invalid cluster self address "+self, err)
+		panic("fatal error")
+	}
+	c := &SlotClusterDatabase{
+		self:      selfNode,
+		nodes:     []*slotNode{selfNode},
+		slots:     make([]*slotNode, SlotCount),
+		migrating: make(map[int]*slotNode),
+		importing: make(map[int]*slotNode),
+		db:        database.NewStandaloneDatabase(),
+	}
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer == "" || peer == self {
+			continue
+		}
+		node, err := makeSlotNode(peer)
+		if err != nil {
+			logger.Error("invalid cluster peer address "+peer, err)
+			continue
+		}
+		c.nodes = append(c.nodes, node)
+	}
+	sort.Slice(c.nodes, func(i, j int) bool {
+		return c.nodes[i].addr < c.nodes[j].addr
+	})
+	for i, node := range c.nodes {
+		for slot := i * SlotCount / len(c.nodes); slot < (i+1)*SlotCount/len(c.nodes); slot++ {
+			c.slots[slot] = node
+		}
+	}
+	return c
+}
+
+// Exec 执行命令，key不属于当前节点时返回重定向
+func (c *SlotClusterDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	if errReply := c.db.CheckAccess(client, args); errReply != nil {
+		return errReply
+	}
+	switch cmdName {
+	case "cluster":
+		return c.execCluster(args[1:])
+	case "asking":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("asking")
+		}
+		c.asking.Store(client, struct{}{})
+		return reply.MakeOKReply()
+	case "select":
+		// redis cluster 只有一个db
+		if len(args) == 2 && string(args[1]) != "0" {
+			return reply.MakeStandardErrorReply("ERR SELECT is not allowed in cluster mode")
+		}
+	}
+	_, asking := c.asking.LoadAndDelete(client)
+	if errReply := c.checkSlot(client, args, asking); errReply != nil {
+		// 事务中的命令重定向时整个事务都不能执行
+		if client.InMultiState() {
+			client.AddTxError(errors.New(errReply.Status))
+		}
+		return errReply
+	}
+	return c.db.Exec(client, args)
+}
+
+// commandKeys 获取命令涉及的key
+func commandKeys(args [][]byte) []string {
+	if strings.EqualFold(string(args[0]), "watch") {
+		keys := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			keys = append(keys, string(arg))
+		}
+		return keys
+	}
+	writeKeys, readKeys, ok := database.GetRelatedKeys(args)
+	if !ok {
+		return nil
+	}
+	return append(writeKeys, readKeys...)
+}
+
+// checkSlot 检查命令涉及的key是否都由当前节点负责，可以在当前节点执行时返回nil
+func (c *SlotClusterDatabase) checkSlot(client resp.Connection, args [][]byte, asking bool) *reply.StandardErrorReply {
+	keys := commandKeys(args)
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if KeySlot(key) != slot {
+			return reply.MakeStandardErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	c.mu.RLock()
+	owner, migrating, importing := c.slots[slot], c.migrating[slot], c.importing[slot]
+	c.mu.RUnlock()
+	if owner == c.self {
+		if migrating == nil {
+			return nil
+		}
+		// 槽正在迁出，key已经不在当前节点时由目标节点执行
+		missing := 0
+		for _, key := range keys {
+			if !c.db.KeyExists(client.GetDBIndex(), key) {
+				missing++
+			}
+		}
+		switch missing {
+		case 0:
+			return nil
+		case len(keys):
+			return reply.MakeStandardErrorReply("ASK " + strconv.Itoa(slot) + " " + migrating.addr)
+		default:
+			return reply.MakeStandardErrorReply("TRYAGAIN Multiple keys request during rehashing of slot")
+		}
+	}
+	if importing != nil && asking {
+		return nil
+	}
+	if owner == nil {
+		return reply.MakeStandardErrorReply("CLUSTERDOWN Hash slot not served")
+	}
+	return reply.MakeStandardErrorReply("MOVED " + strconv.Itoa(slot) + " " + owner.addr)
+}
+
+// SetClients 设置当前所有的客户端连接，client 命令在本地数据库执行
+func (c *SlotClusterDatabase) SetClients(clients databaseface.Clients) {
+	c.db.SetClients(clients)
+}
+
+// AfterClientClose 客户端连接关闭
+func (c *SlotClusterDatabase) AfterClientClose(client resp.Connection) {
+	c.asking.Delete(client)
+	c.db.AfterClientClose(client)
+}
+
+// Close 关闭本地数据库
+func (c *SlotClusterDatabase) Close() {
+	c.db.Close()
+}
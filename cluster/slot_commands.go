@@ -0,0 +1,243 @@
+package cluster
+
+import (
+	"fmt"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// cluster 命令，客户端通过这些命令获取槽的分布
+
+// slotRange 同一个节点负责的一段连续的槽
+type slotRange struct {
+	start, end int
+	node       *slotNode
+}
+
+// slotRanges 按照槽的顺序返回每个节点负责的连续区间，没有分配的槽不返回
+func (c *SlotClusterDatabase) slotRanges() []slotRange {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ranges []slotRange
+	for slot, node := range c.slots {
+		if node == nil {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].node == node && ranges[n-1].end == slot-1 {
+			ranges[n-1].end = slot
+			continue
+		}
+		ranges = append(ranges, slotRange{start: slot, end: slot, node: node})
+	}
+	return ranges
+}
+
+func (c *SlotClusterDatabase) findNode(id string) *slotNode {
+	for _, node := range c.nodes {
+		if node.id == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// execCluster cluster subcommand [arg ...]
+func (c *SlotClusterDatabase) execCluster(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("cluster")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "keyslot":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("cluster|keyslot")
+		}
+		return reply.MakeIntReply(int64(KeySlot(string(args[1]))))
+	case "myid":
+		return reply.MakeBulkReply([]byte(c.self.id))
+	case "slots":
+		return c.execClusterSlots()
+	case "shards":
+		return c.execClusterShards()
+	case "nodes":
+		return c.execClusterNodes()
+	case "info":
+		return c.execClusterInfo()
+	case "setslot":
+		return c.execClusterSetSlot(args[1:])
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCmd + "'. Try CLUSTER HELP.")
+}
+
+// execClusterSlots cluster slots，每个区间返回 [start, end, [host, port, id]]
+func (c *SlotClusterDatabase) execClusterSlots() resp.Reply {
+	ranges := c.slotRanges()
+	result := make([]resp.Reply, 0, len(ranges))
+	for _, r := range ranges {
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(int64(r.start)),
+			reply.MakeIntReply(int64(r.end)),
+			reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeBulkReply([]byte(r.node.host)),
+				reply.MakeIntReply(int64(r.node.port)),
+				reply.MakeBulkReply([]byte(r.node.id)),
+			}),
+		}))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execClusterShards cluster shards，每个节点是一个分片，返回分片负责的槽和分片中的节点
+func (c *SlotClusterDatabase) execClusterShards() resp.Reply {
+	ranges := c.slotRanges()
+	result := make([]resp.Reply, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		slots := make([]resp.Reply, 0)
+		for _, r := range ranges {
+			if r.node == node {
+				slots = append(slots, reply.MakeIntReply(int64(r.start)), reply.MakeIntReply(int64(r.end)))
+			}
+		}
+		nodeInfo := reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("id")), reply.MakeBulkReply([]byte(node.id)),
+			reply.MakeBulkReply([]byte("port")), reply.MakeIntReply(int64(node.port)),
+			reply.MakeBulkReply([]byte("ip")), reply.MakeBulkReply([]byte(node.host)),
+			reply.MakeBulkReply([]byte("endpoint")), reply.MakeBulkReply([]byte(node.host)),
+			reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+			reply.MakeBulkReply([]byte("replication-offset")), reply.MakeIntReply(0),
+			reply.MakeBulkReply([]byte("health")), reply.MakeBulkReply([]byte("online")),
+		})
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("slots")), reply.MakeMultiRawReply(slots),
+			reply.MakeBulkReply([]byte("nodes")), reply.MakeMultiRawReply([]resp.Reply{nodeInfo}),
+		}))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execClusterNodes cluster nodes，每行一个节点
+// <id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func (c *SlotClusterDatabase) execClusterNodes() resp.Reply {
+	ranges := c.slotRanges()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	builder := &strings.Builder{}
+	for _, node := range c.nodes {
+		flags := "master"
+		if node == c.self {
+			flags = "myself,master"
+		}
+		builder.WriteString(fmt.Sprintf("%s %s@%d %s - 0 0 0 connected", node.id, node.addr, node.port+10000, flags))
+		for _, r := range ranges {
+			if r.node != node {
+				continue
+			}
+			if r.start == r.end {
+				builder.WriteString(" " + strconv.Itoa(r.start))
+			} else {
+				builder.WriteString(fmt.Sprintf(" %d-%d", r.start, r.end))
+			}
+		}
+		if node == c.self {
+			for slot, target := range c.migrating {
+				builder.WriteString(fmt.Sprintf(" [%d->-%s]", slot, target.id))
+			}
+			for slot, source := range c.importing {
+				builder.WriteString(fmt.Sprintf(" [%d-<-%s]", slot, source.id))
+			}
+		}
+		builder.WriteString("\n")
+	}
+	return reply.MakeBulkReply([]byte(builder.String()))
+}
+
+// execClusterInfo cluster info
+func (c *SlotClusterDatabase) execClusterInfo() resp.Reply {
+	c.mu.RLock()
+	assigned := 0
+	for _, node := range c.slots {
+		if node != nil {
+			assigned++
+		}
+	}
+	c.mu.RUnlock()
+	state := "ok"
+	if assigned < SlotCount {
+		state = "fail"
+	}
+	builder := &strings.Builder{}
+	fields := []struct {
+		key   string
+		value any
+	}{
+		{"cluster_state", state},
+		{"cluster_slots_assigned", assigned},
+		{"cluster_slots_ok", assigned},
+		{"cluster_slots_pfail", 0},
+		{"cluster_slots_fail", 0},
+		{"cluster_known_nodes", len(c.nodes)},
+		{"cluster_size", len(c.nodes)},
+		{"cluster_current_epoch", 0},
+		{"cluster_my_epoch", 0},
+	}
+	for _, field := range fields {
+		builder.WriteString(field.key + ":" + fmt.Sprint(field.value) + reply.CRLF)
+	}
+	return reply.MakeBulkReply([]byte(builder.String()))
+}
+
+// execClusterSetSlot 迁移槽，只修改当前节点上的状态，需要分别在源节点和目标节点上执行
+// cluster setslot <slot> migrating <node-id> | importing <node-id> | node <node-id> | stable
+func (c *SlotClusterDatabase) execClusterSetSlot(args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("cluster|setslot")
+	}
+	slot, err := strconv.Atoi(string(args[0]))
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return reply.MakeStandardErrorReply("ERR Invalid or out of range slot")
+	}
+	action := strings.ToLower(string(args[1]))
+	if action == "stable" {
+		if len(args) != 2 {
+			return reply.MakeSyntaxErrReply()
+		}
+		c.mu.Lock()
+		delete(c.migrating, slot)
+		delete(c.importing, slot)
+		c.mu.Unlock()
+		return reply.MakeOKReply()
+	}
+	if len(args) != 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	node := c.findNode(string(args[2]))
+	if node == nil {
+		return reply.MakeStandardErrorReply("ERR I don't know about node " + string(args[2]))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch action {
+	case "migrating":
+		if c.slots[slot] != c.self {
+			return reply.MakeStandardErrorReply("ERR I'm not the owner of hash slot " + strconv.Itoa(slot))
+		}
+		if node == c.self {
+			return reply.MakeStandardErrorReply("ERR I'm already the owner of hash slot " + strconv.Itoa(slot))
+		}
+		c.migrating[slot] = node
+	case "importing":
+		if c.slots[slot] == c.self {
+			return reply.MakeStandardErrorReply("ERR I'm already the owner of hash slot " + strconv.Itoa(slot))
+		}
+		c.importing[slot] = node
+	case "node":
+		c.slots[slot] = node
+		delete(c.migrating, slot)
+		delete(c.importing, slot)
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	return reply.MakeOKReply()
+}
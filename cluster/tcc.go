@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"redis-go/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// 分布式事务的协调者，涉及多个节点的 del，rename，renamenx，msetnx 通过 try-commit-rollback 保证原子性
+// 1. 依次在每个节点上准备命令，节点锁定key并记录undo日志
+// 2. 所有节点准备成功后依次提交，任意节点准备或者提交失败时回滚所有节点
+
+// 分布式事务中使用的内部命令，只能在节点之间转发
+const (
+	prepareCmd  = "_prepare"
+	commitCmd   = "_commit"
+	rollbackCmd = "_rollback"
+)
+
+// txPart 事务在一个节点上执行的命令
+type txPart struct {
+	node    string
+	cmdLine [][]byte
+}
+
+// newTxID 生成集群内唯一的事务id
+func (c *ClusterDatabase) newTxID() string {
+	return c.self + "-" + strconv.FormatUint(c.txSeq.Add(1), 10)
+}
+
+// execTxCmd 执行协调者发送过来的事务命令
+func execTxCmd(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	switch strings.ToLower(string(args[0])) {
+	case prepareCmd:
+		return c.db.PrepareTx(client, args[1:])
+	case commitCmd:
+		return c.db.CommitTx(args[1:])
+	default:
+		return c.db.RollbackTx(args[1:])
+	}
+}
+
+// prepareTx 在节点上准备命令
+func (c *ClusterDatabase) prepareTx(client resp.Connection, txID string, part txPart) resp.Reply {
+	args := append([][]byte{[]byte(prepareCmd), []byte(txID)}, part.cmdLine...)
+	return c.relay(part.node, client, args)
+}
+
+// commitTx 在所有节点上提交事务，返回每个节点的执行结果，任意节点提交失败时回滚所有节点
+func (c *ClusterDatabase) commitTx(client resp.Connection, txID string, parts []txPart) ([]resp.Reply, resp.Reply) {
+	results := make([]resp.Reply, len(parts))
+	for i, part := range parts {
+		res := c.relay(part.node, client, [][]byte{[]byte(commitCmd), []byte(txID)})
+		if reply.IsErrReply(res) {
+			c.rollbackTx(client, txID, parts)
+			return nil, res
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// rollbackTx 在所有节点上回滚事务
+func (c *ClusterDatabase) rollbackTx(client resp.Connection, txID string, parts []txPart) {
+	for _, part := range parts {
+		res := c.relay(part.node, client, [][]byte{[]byte(rollbackCmd), []byte(txID)})
+		if reply.IsErrReply(res) {
+			logger.Error("[transaction] rollback " + txID + " on " + part.node + " failed: " + string(res.ToBytes()))
+		}
+	}
+}
+
+// execTx 在多个节点上原子地执行命令，准备失败时返回对应节点的错误
+func (c *ClusterDatabase) execTx(client resp.Connection, parts []txPart) ([]resp.Reply, resp.Reply) {
+	txID := c.newTxID()
+	for i, part := range parts {
+		if res := c.prepareTx(client, txID, part); reply.IsErrReply(res) {
+			c.rollbackTx(client, txID, parts[:i])
+			return nil, res
+		}
+	}
+	return c.commitTx(client, txID, parts)
+}
+
+// groupParts 按照节点对key进行分组，每组生成一条命令，节点的顺序和key第一次出现的顺序一致
+func (c *ClusterDatabase) groupParts(cmdName string, args [][]byte, step int) []txPart {
+	var parts []txPart
+	index := make(map[string]int)
+	for i := 0; i+step <= len(args); i += step {
+		node := c.peerPicker.PickNode(string(args[i]))
+		idx, ok := index[node]
+		if !ok {
+			idx = len(parts)
+			index[node] = idx
+			parts = append(parts, txPart{node: node, cmdLine: [][]byte{[]byte(cmdName)}})
+		}
+		parts[idx].cmdLine = append(parts[idx].cmdLine, args[i:i+step]...)
+	}
+	return parts
+}
+
+// execDel del key [key ...]，key分布在多个节点时通过事务删除
+func execDel(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("del")
+	}
+	parts := c.groupParts("del", args[1:], 1)
+	if len(parts) == 1 {
+		return c.relay(parts[0].node, client, args)
+	}
+	results, errReply := c.execTx(client, parts)
+	if errReply != nil {
+		return errReply
+	}
+	var deleted int64
+	for _, res := range results {
+		if intReply, ok := res.(*reply.IntReply); ok {
+			deleted += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+// execMSetNX msetnx key value [key value ...]，任意key已经存在时所有key都不写入
+func execMSetNX(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("msetnx")
+	}
+	parts := c.groupParts("msetnx", args[1:], 2)
+	if len(parts) == 1 {
+		return c.relay(parts[0].node, client, args)
+	}
+	_, errReply := c.execTx(client, parts)
+	if errReply != nil {
+		if isKeyExistsErr(errReply) {
+			return reply.MakeIntReply(0)
+		}
+		return errReply
+	}
+	return reply.MakeIntReply(1)
+}
+
+// execRename rename/renamenx src dst，两个key在不同的节点时，源节点删除key，目标节点使用源节点的数据重建key
+func execRename(c *ClusterDatabase, client resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	if len(args) != 3 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	srcNode := c.peerPicker.PickNode(string(args[1]))
+	dstNode := c.peerPicker.PickNode(string(args[2]))
+	if srcNode == dstNode {
+		return c.relay(srcNode, client, args)
+	}
+	// 目标节点需要源节点准备阶段返回的数据，两个节点依次准备
+	txID := c.newTxID()
+	src := txPart{node: srcNode, cmdLine: [][]byte{[]byte("renamefrom"), args[1], args[2]}}
+	res := c.prepareTx(client, txID, src)
+	if reply.IsErrReply(res) {
+		return res
+	}
+	data, ok := res.(*reply.BulkReply)
+	if !ok {
+		c.rollbackTx(client, txID, []txPart{src})
+		return reply.MakeStandardErrorReply("ERR unexpected reply from peer " + srcNode)
+	}
+	dstCmd := "renameto"
+	if cmdName == "renamenx" {
+		dstCmd = "renamenxto"
+	}
+	dst := txPart{node: dstNode, cmdLine: [][]byte{[]byte(dstCmd), args[2], data.Arg}}
+	if res := c.prepareTx(client, txID, dst); reply.IsErrReply(res) {
+		c.rollbackTx(client, txID, []txPart{src})
+		return res
+	}
+	if _, errReply := c.commitTx(client, txID, []txPart{src, dst}); errReply != nil {
+		return errReply
+	}
+	return reply.MakeOKReply()
+}
+
+// isKeyExistsErr 判断是否为目标key已经存在的错误
+func isKeyExistsErr(res resp.Reply) bool {
+	errReply, ok := res.(*reply.StandardErrorReply)
+	return ok && errReply.Status == database.ErrKeyExists
+}
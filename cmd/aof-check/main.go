@@ -0,0 +1,67 @@
+// aof-check 校验aof文件是否完整，--fix 时将文件截断到最后一条完整的命令
+//
+// 用法: aof-check [--fix] <file.aof>
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"redis-go/aof"
+	"strings"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "truncate the file to the last valid command")
+	yes := flag.Bool("y", false, "do not ask for confirmation when fixing")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--fix] [-y] <file.aof>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	filename := flag.Arg(0)
+	result, err := aof.Check(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot read aof file:", err)
+		os.Exit(1)
+	}
+	if result.Preamble {
+		fmt.Println("RDB preamble detected")
+	}
+	fmt.Printf("AOF analyzed: size=%d, ok_up_to=%d, diff=%d, commands=%d\n",
+		result.Size, result.ValidSize, result.Size-result.ValidSize, result.Commands)
+	if result.Err == nil {
+		fmt.Println("AOF is valid")
+		return
+	}
+	fmt.Println(result.Err)
+	if !*fix {
+		fmt.Println("AOF is not valid. Use the --fix option to try fixing it.")
+		os.Exit(1)
+	}
+	if !aof.IsTruncated(result.Err) {
+		fmt.Println("The file is corrupted in the middle, all data after the corruption will be lost!")
+	}
+	if !*yes && !confirm(fmt.Sprintf("This will shrink the AOF from %d bytes, with %d bytes, to %d bytes",
+		result.Size, result.Size-result.ValidSize, result.ValidSize)) {
+		fmt.Println("Aborted")
+		os.Exit(1)
+	}
+	if err := os.Truncate(filename, result.ValidSize); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to truncate AOF:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully truncated AOF")
+}
+
+// confirm 等待用户确认
+func confirm(msg string) bool {
+	fmt.Print(msg + "\nContinue? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(answer), "y")
+}
@@ -15,11 +15,42 @@ type ServerProperties struct {
 	Port           int      `cfg:"port"`
 	AppendOnly     bool     `cfg:"appendOnly"`
 	AppendFilename string   `cfg:"appendFilename"`
+	AppendFsync    string   `cfg:"appendFsync"` // aof刷盘策略 always/everysec/no，默认为 everysec
 	MaxClients     int      `cfg:"maxClients"`
 	RequirePass    string   `cfg:"requirePass"`
 	Databases      int      `cfg:"databases"`
 	Peers          []string `cfg:"peers"`
 	Self           string   `cfg:"self"`
+
+	// aof自动重写，文件大小超过 AutoAofRewriteMinSize 字节并且相比上一次重写后增长了 AutoAofRewritePercentage% 时触发
+	// AutoAofRewritePercentage 为0时关闭自动重写
+	AutoAofRewritePercentage int `cfg:"autoAofRewritePercentage"`
+	AutoAofRewriteMinSize    int `cfg:"autoAofRewriteMinSize"`
+
+	// rdb快照，Save 为 "<seconds> <changes> [<seconds> <changes> ...]" 格式的自动保存规则
+	// 在 seconds 秒内至少发生了 changes 次写入时触发 bgsave，为空时关闭自动保存
+	DbFilename string `cfg:"dbFilename"`
+	Save       string `cfg:"save"`
+
+	// aof重写时是否使用rdb格式的数据快照作为文件头，之后追加的命令仍然是resp格式
+	AofUseRdbPreamble bool `cfg:"aofUseRdbPreamble"`
+	// aof文件末尾的命令不完整时的处理方式，yes 截断到最后一条完整的命令后继续启动，no 拒绝启动，默认为 yes
+	AofLoadTruncated string `cfg:"aofLoadTruncated"`
+
+	// 主从复制积压缓冲区的大小，单位为字节，从节点断线重连时请求的偏移量在缓冲区中时只需要部分同步，默认为1MB
+	ReplBacklogSize int `cfg:"replBacklogSize"`
+	// 从节点输出缓冲区的上限，单位为字节，等待发送给从节点的命令流超过上限时断开从节点，默认为256MB
+	ReplicaOutputBufferLimit int `cfg:"replicaOutputBufferLimit"`
+	// 主节点需要认证时从节点使用的用户名和密码，MasterUser 为空时以 default 用户认证
+	MasterUser string `cfg:"masterUser"`
+	MasterAuth string `cfg:"masterAuth"`
+
+	// 集群模式下使用redis cluster的哈希槽，key不在当前节点时返回 MOVED/ASK 重定向，由客户端直接访问对应的节点
+	// 为 false 时当前节点代替客户端把命令转发给对应的节点
+	ClusterEnabled bool `cfg:"clusterEnabled"`
+
+	// acl文件，每行的格式为 user <name> [rule ...]，启动时加载，ACL SAVE 时写入
+	AclFile string `cfg:"aclFile"`
 }
 
 var Properties *ServerProperties // 全局的配置项
@@ -96,11 +127,13 @@ func parseLine(line string) (string, string, error) {
 	if strings.HasPrefix(line, "#") {
 		return "", "", errors.New("invalid config line")
 	}
-	configLine := strings.SplitAfter(line, " ")
-	if len(configLine) != 2 {
+	// 配置项的值可能包含空格(如 save 900 1 300 10)，这里只按照第一个空格进行切分
+	// 配置项的名称不区分大小写，值保持原样(如文件名，密码)
+	key, val, ok := strings.Cut(strings.TrimSpace(line), " ")
+	if !ok {
 		return "", "", errors.New("invalid config line")
 	}
-	return strings.ToLower(strings.TrimSpace(configLine[0])), strings.ToLower(strings.TrimSpace(configLine[1])), nil
+	return strings.ToLower(key), strings.TrimSpace(val), nil
 
 }
 
@@ -0,0 +1,641 @@
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"redis-go/interface/resp"
+	"redis-go/lib/wildcard"
+	"redis-go/resp/reply"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// acl访问控制，每个用户可以设置密码、允许执行的命令、允许访问的key和频道，规则的语法和redis保持一致
+// 没有密码的 default 用户启用时，新的连接自动以 default 用户认证
+// 用户对象创建之后不再修改，修改用户时复制一份再整体替换，检查权限时不需要加锁
+
+// acl中的命令分类
+const (
+	catKeyspace    = "keyspace"
+	catRead        = "read"
+	catWrite       = "write"
+	catString      = "string"
+	catList        = "list"
+	catHash        = "hash"
+	catSet         = "set"
+	catSortedSet   = "sortedset"
+	catPubSub      = "pubsub"
+	catAdmin       = "admin"
+	catDangerous   = "dangerous"
+	catConnection  = "connection"
+	catTransaction = "transaction"
+)
+
+var aclCategories = []string{
+	catKeyspace, catRead, catWrite, catString, catList, catHash, catSet, catSortedSet,
+	catPubSub, catAdmin, catDangerous, catConnection, catTransaction,
+}
+
+// specialCommands 不在cmdTable中，由 StandaloneDatabase 和 DB 直接处理的命令的分类
+var specialCommands = map[string][]string{
+	"select":       {catKeyspace},
+	"auth":         {catConnection},
+	"hello":        {catConnection},
+	"multi":        {catTransaction},
+	"exec":         {catTransaction},
+	"discard":      {catTransaction},
+	"watch":        {catTransaction},
+	"unwatch":      {catTransaction},
+	"subscribe":    {catPubSub},
+	"unsubscribe":  {catPubSub},
+	"psubscribe":   {catPubSub},
+	"punsubscribe": {catPubSub},
+	"publish":      {catPubSub},
+	"pubsub":       {catPubSub},
+	"bgrewriteaof": {catAdmin, catDangerous},
+	"save":         {catAdmin, catDangerous},
+	"bgsave":       {catAdmin, catDangerous},
+	"lastsave":     {catAdmin, catDangerous},
+	"replicaof":    {catAdmin, catDangerous},
+	"slaveof":      {catAdmin, catDangerous},
+	"sync":         {catAdmin, catDangerous},
+	"psync":        {catAdmin, catDangerous},
+	"replconf":     {catAdmin, catDangerous},
+	"role":         {catAdmin, catDangerous},
+	"info":         {catDangerous},
+	"acl":          {catAdmin, catDangerous},
+	"client":       {catAdmin, catDangerous, catConnection},
+	// 集群模式的命令和节点之间使用的内部命令
+	"cluster":   {catAdmin, catDangerous},
+	"asking":    {catAdmin, catDangerous},
+	"_relay":    {catAdmin, catDangerous},
+	"_prepare":  {catAdmin, catDangerous},
+	"_commit":   {catAdmin, catDangerous},
+	"_rollback": {catAdmin, catDangerous},
+}
+
+// commandCategories 获取命令所属的分类，命令不存在时返回false
+func commandCategories(name string) ([]string, bool) {
+	if cmd, ok := cmdTable[name]; ok {
+		return cmd.categories, true
+	}
+	categories, ok := specialCommands[name]
+	return categories, ok
+}
+
+// allCommandNames 所有命令的名称，按照字母排序
+func allCommandNames() []string {
+	names := make([]string, 0, len(cmdTable)+len(specialCommands))
+	for name := range cmdTable {
+		names = append(names, name)
+	}
+	for name := range specialCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// categoryCommands 分类中的所有命令
+func categoryCommands(category string) []string {
+	var names []string
+	for _, name := range allCommandNames() {
+		categories, _ := commandCategories(name)
+		for _, c := range categories {
+			if c == category {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func isACLCategory(category string) bool {
+	for _, c := range aclCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// aclUser acl用户
+type aclUser struct {
+	name      string
+	enabled   bool
+	nopass    bool
+	passwords []string // 密码的sha256
+	// 允许执行的命令，cmdRules 记录设置命令权限的规则，用于输出用户的描述
+	allowed  map[string]bool
+	cmdRules []string
+	// 允许访问的key和频道的模式
+	keyPatterns     []string
+	keyMatchers     []*wildcard.Pattern
+	channelPatterns []string
+	channelMatchers []*wildcard.Pattern
+}
+
+// newACLUser 创建用户，新用户没有启用，没有密码，不能执行任何命令
+func newACLUser(name string) *aclUser {
+	return &aclUser{
+		name:     name,
+		allowed:  make(map[string]bool),
+		cmdRules: []string{"-@all"},
+	}
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for name, ok := range u.allowed {
+		c.allowed[name] = ok
+	}
+	c.cmdRules = append([]string(nil), u.cmdRules...)
+	c.keyPatterns = append([]string(nil), u.keyPatterns...)
+	c.keyMatchers = append([]*wildcard.Pattern(nil), u.keyMatchers...)
+	c.channelPatterns = append([]string(nil), u.channelPatterns...)
+	c.channelMatchers = append([]*wildcard.Pattern(nil), u.channelMatchers...)
+	return &c
+}
+
+// aclRuleError 规则错误，和redis的错误信息保持一致
+func aclRuleError(rule string, reason string) error {
+	return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, reason)
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func isPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRule 应用一条acl规则
+func (u *aclUser) applyRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case "allkeys":
+		return u.applyRule("~*")
+	case "resetkeys":
+		u.keyPatterns, u.keyMatchers = nil, nil
+	case "allchannels":
+		return u.applyRule("&*")
+	case "resetchannels":
+		u.channelPatterns, u.channelMatchers = nil, nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "nocommands", "off"} {
+			_ = u.applyRule(r)
+		}
+	default:
+		return u.applyPatternRule(rule)
+	}
+	return nil
+}
+
+// applyPatternRule 应用带参数的规则，如 >password，~pattern，+command
+func (u *aclUser) applyPatternRule(rule string) error {
+	if len(rule) < 2 {
+		return aclRuleError(rule, "Syntax error")
+	}
+	value := rule[1:]
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(value))
+	case '<':
+		if !u.removePassword(hashPassword(value)) {
+			return aclRuleError(rule, "The password you are trying to remove from the user does not exist")
+		}
+	case '#':
+		if !isPasswordHash(value) {
+			return aclRuleError(rule, "The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPassword(value)
+	case '!':
+		if !u.removePassword(value) {
+			return aclRuleError(rule, "The password you are trying to remove from the user does not exist")
+		}
+	case '~':
+		if value == "*" {
+			u.keyPatterns, u.keyMatchers = nil, nil
+		}
+		u.keyPatterns = append(u.keyPatterns, value)
+		u.keyMatchers = append(u.keyMatchers, wildcard.CompilePattern(value))
+	case '&':
+		if value == "*" {
+			u.channelPatterns, u.channelMatchers = nil, nil
+		}
+		u.channelPatterns = append(u.channelPatterns, value)
+		u.channelMatchers = append(u.channelMatchers, wildcard.CompilePattern(value))
+	case '+', '-':
+		return u.applyCommandRule(rule)
+	default:
+		return aclRuleError(rule, "Syntax error")
+	}
+	return nil
+}
+
+// applyCommandRule +command，-command，+@category，-@category
+func (u *aclUser) applyCommandRule(rule string) error {
+	allow := rule[0] == '+'
+	name := strings.ToLower(rule[1:])
+	var names []string
+	switch {
+	case name == "@all":
+		names = allCommandNames()
+		u.allowed = make(map[string]bool)
+		u.cmdRules = nil
+	case strings.HasPrefix(name, "@"):
+		if !isACLCategory(name[1:]) {
+			return aclRuleError(rule, "Unknown command or category name in ACL")
+		}
+		names = categoryCommands(name[1:])
+	default:
+		if _, ok := commandCategories(name); !ok {
+			return aclRuleError(rule, "Unknown command or category name in ACL")
+		}
+		names = []string{name}
+	}
+	for _, n := range names {
+		if allow {
+			u.allowed[n] = true
+		} else {
+			delete(u.allowed, n)
+		}
+	}
+	u.cmdRules = append(u.cmdRules, rule[:1]+name)
+	return nil
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) removePassword(hash string) bool {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassword 检查密码，使用固定时间的比较防止通过响应时间猜测密码
+func (u *aclUser) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := []byte(hashPassword(password))
+	matched := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(p)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// canRun 是否可以执行命令，没有注册分类的命令默认不允许执行
+func (u *aclUser) canRun(cmdName string) bool {
+	return u.allowed[cmdName]
+}
+
+func (u *aclUser) canAccessKey(key string) bool {
+	for _, matcher := range u.keyMatchers {
+		if matcher.IsMatch(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel 是否可以访问频道，psubscribe 的模式需要和允许的模式完全相同
+func (u *aclUser) canAccessChannel(channel string, isPattern bool) bool {
+	for i, matcher := range u.channelMatchers {
+		if u.channelPatterns[i] == "*" || (!isPattern && matcher.IsMatch(channel)) || (isPattern && u.channelPatterns[i] == channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe 用户的规则描述，可以直接作为acl文件中的一行
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.name}
+	if u.enabled {
+		parts = append(parts, "on")
+	} else {
+		parts = append(parts, "off")
+	}
+	if u.nopass {
+		parts = append(parts, "nopass")
+	}
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	for _, p := range u.keyPatterns {
+		parts = append(parts, "~"+p)
+	}
+	if len(u.channelPatterns) == 0 {
+		parts = append(parts, "resetchannels")
+	}
+	for _, p := range u.channelPatterns {
+		parts = append(parts, "&"+p)
+	}
+	parts = append(parts, u.cmdRules...)
+	return strings.Join(parts, " ")
+}
+
+// aclState 所有的acl用户
+type aclState struct {
+	mu          sync.RWMutex
+	users       map[string]*aclUser
+	requirePass string // default 用户的密码
+	file        string // acl文件，为空时不使用文件
+	log         *aclLog
+}
+
+// makeACL 创建acl，配置了acl文件时从文件中加载用户
+func makeACL(requirePass string, file string) (*aclState, error) {
+	a := &aclState{
+		users:       make(map[string]*aclUser),
+		requirePass: requirePass,
+		file:        file,
+		log:         makeACLLog(aclLogMaxLen),
+	}
+	a.users[defaultUser] = a.makeDefaultUser()
+	if file != "" {
+		if err := a.loadFile(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// makeDefaultUser 创建 default 用户，可以执行所有命令，配置了 requirePass 时需要使用密码认证
+func (a *aclState) makeDefaultUser() *aclUser {
+	user := newACLUser(defaultUser)
+	rules := []string{"on", "~*", "&*", "+@all", "nopass"}
+	if a.requirePass != "" {
+		rules[len(rules)-1] = ">" + a.requirePass
+	}
+	for _, rule := range rules {
+		_ = user.applyRule(rule)
+	}
+	return user
+}
+
+func (a *aclState) getUser(name string) *aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.users[name]
+}
+
+// authenticate 校验用户名和密码，用户不存在或者没有启用时失败
+func (a *aclState) authenticate(username, password string) bool {
+	user := a.getUser(username)
+	return user != nil && user.enabled && user.checkPassword(password)
+}
+
+// defaultNoPass default 用户启用并且不需要密码，新连接自动认证
+func (a *aclState) defaultNoPass() bool {
+	user := a.getUser(defaultUser)
+	return user != nil && user.enabled && user.nopass
+}
+
+// setUser 修改或者创建用户，任意规则错误时不做修改
+func (a *aclState) setUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user, ok := a.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newACLUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.applyRule(rule); err != nil {
+			return err
+		}
+	}
+	a.users[name] = user
+	return nil
+}
+
+// deleteUsers 删除用户，返回删除的数量，default 用户不能删除
+func (a *aclState) deleteUsers(names []string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, name := range names {
+		if name == defaultUser {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := a.users[name]; ok {
+			delete(a.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// sortedUsers 按照名称排序的所有用户
+func (a *aclState) sortedUsers() []*aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	users := make([]*aclUser, 0, len(a.users))
+	for _, user := range a.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name < users[j].name
+	})
+	return users
+}
+
+// loadFile 从acl文件加载所有用户，每行的格式为 user <name> [rule ...]，文件中没有 default 用户时使用默认的配置
+// 文件中有任何错误时不做修改
+func (a *aclState) loadFile() error {
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	users := make(map[string]*aclUser)
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: line should start with user keyword", a.file, i+1)
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", a.file, i+1, name)
+		}
+		user := newACLUser(name)
+		for _, rule := range fields[2:] {
+			if err := user.applyRule(rule); err != nil {
+				return fmt.Errorf("%s:%d: %s", a.file, i+1, err.Error())
+			}
+		}
+		users[name] = user
+	}
+	if _, ok := users[defaultUser]; !ok {
+		users[defaultUser] = a.makeDefaultUser()
+	}
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	return nil
+}
+
+// saveFile 将所有用户写入acl文件
+func (a *aclState) saveFile() error {
+	builder := &strings.Builder{}
+	for _, user := range a.sortedUsers() {
+		builder.WriteString(user.describe() + "\n")
+	}
+	return writeFileAtomic(a.file, []byte(builder.String()))
+}
+
+// CheckAccess 检查连接是否可以执行命令：未认证的连接只能执行 auth，hello 和 ping，
+// 已认证的连接需要有执行命令和访问命令涉及的key、频道的权限，服务端内部使用的连接没有用户，不做检查
+func (s *StandaloneDatabase) CheckAccess(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	if client == nil {
+		return nil
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if !client.IsAuthenticated() {
+		// default 用户不需要密码时，新连接自动以 default 用户认证
+		if !s.acl.defaultNoPass() {
+			switch cmdName {
+			case "auth", "hello", "ping":
+				return nil
+			}
+			return reply.MakeStandardErrorReply(noAuthErr)
+		}
+		client.SetAuthenticated(true)
+		client.SetUser(defaultUser)
+	}
+	if cmdName == "auth" || cmdName == "hello" || client.GetUser() == "" {
+		return nil
+	}
+	user := s.acl.getUser(client.GetUser())
+	if user == nil {
+		// 用户已经被删除，需要重新认证
+		client.SetAuthenticated(false)
+		return reply.MakeStandardErrorReply(noAuthErr)
+	}
+	if errReply := s.checkPermission(client, user, cmdName, cmdLine); errReply != nil {
+		if client.InMultiState() {
+			client.AddTxError(errors.New(errReply.Status))
+		}
+		return errReply
+	}
+	return nil
+}
+
+// CheckTxAccess 检查连接是否可以访问分布式事务准备的命令涉及的key，事务命令不在cmdTable中，只检查key的权限
+func (s *StandaloneDatabase) CheckTxAccess(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	if client == nil || client.GetUser() == "" || len(cmdLine) < 2 {
+		return nil
+	}
+	user := s.acl.getUser(client.GetUser())
+	if user == nil {
+		client.SetAuthenticated(false)
+		return reply.MakeStandardErrorReply(noAuthErr)
+	}
+	cmd, ok := txCmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok {
+		return nil
+	}
+	keys, _ := cmd.prepare(cmdLine[1:])
+	for _, key := range keys {
+		if !user.canAccessKey(key) {
+			s.acl.log.add("key", "toplevel", key, user.name, client)
+			return reply.MakeStandardErrorReply("NOPERM No permissions to access a key")
+		}
+	}
+	return nil
+}
+
+// checkPermission 检查用户是否有执行命令的权限，没有权限时记录到acl日志
+func (s *StandaloneDatabase) checkPermission(client resp.Connection, user *aclUser, cmdName string, cmdLine [][]byte) *reply.StandardErrorReply {
+	context := "toplevel"
+	if client.InMultiState() {
+		context = "multi"
+	}
+	if !user.canRun(cmdName) {
+		s.acl.log.add("command", context, cmdName, user.name, client)
+		return reply.MakeStandardErrorReply(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.name, cmdName))
+	}
+	keys := make([]string, 0)
+	if cmdName == "watch" {
+		for _, arg := range cmdLine[1:] {
+			keys = append(keys, string(arg))
+		}
+	} else if writeKeys, readKeys, ok := GetRelatedKeys(cmdLine); ok {
+		keys = append(writeKeys, readKeys...)
+	}
+	for _, key := range keys {
+		if !user.canAccessKey(key) {
+			s.acl.log.add("key", context, key, user.name, client)
+			return reply.MakeStandardErrorReply("NOPERM No permissions to access a key")
+		}
+	}
+	var channels [][]byte
+	switch cmdName {
+	case "publish":
+		if len(cmdLine) > 1 {
+			channels = cmdLine[1:2]
+		}
+	case "subscribe", "psubscribe":
+		channels = cmdLine[1:]
+	}
+	for _, channel := range channels {
+		if !user.canAccessChannel(string(channel), cmdName == "psubscribe") {
+			s.acl.log.add("channel", context, string(channel), user.name, client)
+			return reply.MakeStandardErrorReply("NOPERM No permissions to access a channel")
+		}
+	}
+	return nil
+}
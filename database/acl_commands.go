@@ -0,0 +1,194 @@
+package database
+
+import (
+	"fmt"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// acl命令
+// acl setuser|getuser|deluser|list|users|whoami|cat|log|save|load
+
+// execACL acl subcommand [arg ...]
+func (s *StandaloneDatabase) execACL(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "setuser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|setuser")
+		}
+		rules := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			rules = append(rules, string(arg))
+		}
+		if err := s.acl.setUser(string(args[0]), rules); err != nil {
+			return reply.MakeStandardErrorReply("ERR " + err.Error())
+		}
+		return reply.MakeOKReply()
+	case "getuser":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("acl|getuser")
+		}
+		return s.execACLGetUser(string(args[0]))
+	case "deluser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|deluser")
+		}
+		names := make([]string, 0, len(args))
+		for _, arg := range args {
+			names = append(names, string(arg))
+		}
+		deleted, err := s.acl.deleteUsers(names)
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR " + err.Error())
+		}
+		return reply.MakeIntReply(int64(deleted))
+	case "list", "users":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|" + subCmd)
+		}
+		users := s.acl.sortedUsers()
+		result := make([][]byte, 0, len(users))
+		for _, user := range users {
+			if subCmd == "list" {
+				result = append(result, []byte(user.describe()))
+			} else {
+				result = append(result, []byte(user.name))
+			}
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "whoami":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|whoami")
+		}
+		user := client.GetUser()
+		if user == "" {
+			user = defaultUser
+		}
+		return reply.MakeBulkReply([]byte(user))
+	case "cat":
+		return execACLCat(args)
+	case "log":
+		return s.execACLLog(args)
+	case "save", "load":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|" + subCmd)
+		}
+		if s.acl.file == "" {
+			return reply.MakeStandardErrorReply("ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+		}
+		var err error
+		if subCmd == "save" {
+			err = s.acl.saveFile()
+		} else {
+			err = s.acl.loadFile()
+		}
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR " + err.Error())
+		}
+		return reply.MakeOKReply()
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// execACLGetUser 返回用户的标志、密码和权限，用户不存在时返回nil
+func (s *StandaloneDatabase) execACLGetUser(name string) resp.Reply {
+	user := s.acl.getUser(name)
+	if user == nil {
+		return reply.MakeNullBulkReply()
+	}
+	flags := make([][]byte, 0, 2)
+	if user.enabled {
+		flags = append(flags, []byte("on"))
+	} else {
+		flags = append(flags, []byte("off"))
+	}
+	if user.nopass {
+		flags = append(flags, []byte("nopass"))
+	}
+	passwords := make([][]byte, 0, len(user.passwords))
+	for _, p := range user.passwords {
+		passwords = append(passwords, []byte(p))
+	}
+	keys := make([]string, 0, len(user.keyPatterns))
+	for _, p := range user.keyPatterns {
+		keys = append(keys, "~"+p)
+	}
+	channels := make([]string, 0, len(user.channelPatterns))
+	for _, p := range user.channelPatterns {
+		channels = append(channels, "&"+p)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")), reply.MakeMultiBulkReply(flags),
+		reply.MakeBulkReply([]byte("passwords")), reply.MakeMultiBulkReply(passwords),
+		reply.MakeBulkReply([]byte("commands")), reply.MakeBulkReply([]byte(strings.Join(user.cmdRules, " "))),
+		reply.MakeBulkReply([]byte("keys")), reply.MakeBulkReply([]byte(strings.Join(keys, " "))),
+		reply.MakeBulkReply([]byte("channels")), reply.MakeBulkReply([]byte(strings.Join(channels, " "))),
+	})
+}
+
+// execACLCat acl cat [category]，不指定分类时返回所有分类，否则返回分类中的命令
+func execACLCat(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("acl|cat")
+	}
+	var names []string
+	if len(args) == 0 {
+		names = aclCategories
+	} else {
+		category := strings.ToLower(string(args[0]))
+		if !isACLCategory(category) {
+			return reply.MakeStandardErrorReply("ERR Unknown category '" + category + "'")
+		}
+		names = categoryCommands(category)
+	}
+	result := make([][]byte, 0, len(names))
+	for _, name := range names {
+		result = append(result, []byte(name))
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execACLLog acl log [count | reset]
+func (s *StandaloneDatabase) execACLLog(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("acl|log")
+	}
+	count := 10
+	if len(args) == 1 {
+		if strings.EqualFold(string(args[0]), "reset") {
+			s.acl.log.reset()
+			return reply.MakeOKReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	now := time.Now()
+	entries := s.acl.log.list(count)
+	result := make([]resp.Reply, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("count")), reply.MakeIntReply(int64(entry.count)),
+			reply.MakeBulkReply([]byte("reason")), reply.MakeBulkReply([]byte(entry.reason)),
+			reply.MakeBulkReply([]byte("context")), reply.MakeBulkReply([]byte(entry.context)),
+			reply.MakeBulkReply([]byte("object")), reply.MakeBulkReply([]byte(entry.object)),
+			reply.MakeBulkReply([]byte("username")), reply.MakeBulkReply([]byte(entry.username)),
+			reply.MakeBulkReply([]byte("age-seconds")), reply.MakeBulkReply([]byte(fmt.Sprintf("%.3f", now.Sub(entry.created).Seconds()))),
+			reply.MakeBulkReply([]byte("client-info")), reply.MakeBulkReply([]byte(entry.clientInfo)),
+			reply.MakeBulkReply([]byte("entry-id")), reply.MakeIntReply(entry.id),
+			reply.MakeBulkReply([]byte("timestamp-created")), reply.MakeIntReply(entry.created.UnixMilli()),
+			reply.MakeBulkReply([]byte("timestamp-last-updated")), reply.MakeIntReply(entry.updated.UnixMilli()),
+		}))
+	}
+	return reply.MakeMultiRawReply(result)
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"redis-go/interface/resp"
+	"sync"
+	"time"
+)
+
+// acl日志，环形保存最近被拒绝的命令和失败的认证，相同的记录在一段时间内合并计数
+
+const (
+	aclLogMaxLen      = 128
+	aclLogGroupWindow = 60 * time.Second // 间隔小于这个时间的相同记录合并为一条
+)
+
+// aclLogEntry 一条acl日志
+type aclLogEntry struct {
+	id         int64
+	count      int
+	reason     string // command，key，channel，auth
+	context    string // toplevel，multi
+	object     string // 被拒绝的命令、key或者频道
+	username   string
+	clientInfo string
+	created    time.Time
+	updated    time.Time
+}
+
+// aclLog acl日志的环形缓冲区
+type aclLog struct {
+	mu      sync.Mutex
+	entries []*aclLogEntry
+	head    int // 下一次写入的位置
+	size    int
+	nextID  int64
+}
+
+func makeACLLog(maxLen int) *aclLog {
+	return &aclLog{
+		entries: make([]*aclLogEntry, maxLen),
+	}
+}
+
+// at 第i新的记录
+func (l *aclLog) at(i int) *aclLogEntry {
+	n := len(l.entries)
+	return l.entries[(l.head-1-i+n)%n]
+}
+
+// add 记录一次拒绝，和最近的相同记录合并
+func (l *aclLog) add(reason, context, object, username string, client resp.Connection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for i := 0; i < l.size; i++ {
+		entry := l.at(i)
+		if entry.reason == reason && entry.context == context && entry.object == object &&
+			entry.username == username && now.Sub(entry.updated) < aclLogGroupWindow {
+			entry.count++
+			entry.updated = now
+			return
+		}
+	}
+	l.entries[l.head] = &aclLogEntry{
+		id:         l.nextID,
+		count:      1,
+		reason:     reason,
+		context:    context,
+		object:     object,
+		username:   username,
+		clientInfo: "addr=" + client.RemoteAddr() + " user=" + client.GetUser(),
+		created:    now,
+		updated:    now,
+	}
+	l.nextID++
+	l.head = (l.head + 1) % len(l.entries)
+	if l.size < len(l.entries) {
+		l.size++
+	}
+}
+
+// list 最新的 count 条记录，count 小于0时返回所有记录
+func (l *aclLog) list(count int) []aclLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 || count > l.size {
+		count = l.size
+	}
+	result := make([]aclLogEntry, count)
+	for i := range result {
+		result[i] = *l.at(i)
+	}
+	return result
+}
+
+func (l *aclLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.entries)
+	l.head, l.size = 0, 0
+}
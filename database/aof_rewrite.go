@@ -0,0 +1,103 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"redis-go/aof"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strconv"
+	"time"
+)
+
+// aof重写的调度，数据快照由database生成，文件的替换由aofHandler完成
+
+var errAofDisabled = errors.New("ERR Background append only file rewriting is only available when appendonly is enabled")
+
+// execBGRewriteAof bgrewriteaof，在后台执行aof重写
+func (s *StandaloneDatabase) execBGRewriteAof(args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("bgrewriteaof")
+	}
+	if s.aofHandler == nil {
+		return reply.MakeStandardErrorReply(errAofDisabled.Error())
+	}
+	if s.aofHandler.IsRewriting() {
+		return reply.MakeStandardErrorReply(aof.ErrRewriteInProgress.Error())
+	}
+	go s.bgRewriteAof()
+	return reply.MakeStatusReply("Background append only file rewriting started")
+}
+
+// bgRewriteAof 在后台执行aof重写，只记录错误日志
+func (s *StandaloneDatabase) bgRewriteAof() {
+	if err := s.RewriteAof(); err != nil {
+		logger.Error("[aof rewrite] rewrite aof failed", err)
+	}
+}
+
+// RewriteAof 执行aof重写
+// 只在标记分界点时暂停命令的执行，分界点之后的写入由aofHandler记录在重写缓冲区中，追加在快照之后
+func (s *StandaloneDatabase) RewriteAof() error {
+	if s.aofHandler == nil {
+		return errAofDisabled
+	}
+	started := false
+	mark := func() error {
+		if err := s.aofHandler.StartRewrite(); err != nil {
+			return err
+		}
+		started = true
+		return nil
+	}
+	var snapshot []byte
+	var err error
+	if s.aofUseRdbPreamble {
+		// 混合格式，数据快照使用rdb格式，加载时不需要逐条回放命令
+		snapshot, err = s.dumpSnapshot(mark)
+	} else {
+		snapshot, err = s.dumpCommands(mark)
+	}
+	if err != nil {
+		if started {
+			s.aofHandler.AbortRewrite()
+		}
+		return err
+	}
+	return s.aofHandler.FinishRewrite(snapshot)
+}
+
+// dumpCommands 将分界点时所有db中的数据转换为resp格式的命令，mark 在分界点执行
+func (s *StandaloneDatabase) dumpCommands(mark func() error) ([]byte, error) {
+	// 不同db中的key可能被并发写入快照，每个db使用单独的缓冲区，最后再合并
+	dbBufs := make([]*bytes.Buffer, len(s.dbSet))
+	for i := range s.dbSet {
+		dbBufs[i] = &bytes.Buffer{}
+	}
+	err := s.takeSnapshot(mark, func(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) error {
+		cmd := aof.EntityToCmd(key, entity)
+		if cmd == nil {
+			return nil
+		}
+		dbBufs[dbIndex].Write(reply.MakeMultiBulkReply(cmd).ToBytes())
+		if expiration != nil {
+			dbBufs[dbIndex].Write(reply.MakeMultiBulkReply(aof.MakeExpireCmd(key, *expiration)).ToBytes())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	for i, db := range s.dbSet {
+		if dbBufs[i].Len() == 0 {
+			continue
+		}
+		buf.Write(reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(db.index))).ToBytes())
+		buf.Write(dbBufs[i].Bytes())
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// 密码认证，default 用户需要密码时(配置了 requirePass 或者在acl中设置)，连接需要先通过 auth 或者 hello 认证才能执行其他命令
+// auth password 的形式使用 default 用户认证，auth username password 的形式使用acl中的用户认证
+
+const defaultUser = "default"
+
+const (
+	noAuthErr    = "NOAUTH Authentication required."
+	wrongPassErr = "WRONGPASS invalid username-password pair or user is disabled."
+)
+
+// authenticate 校验用户名和密码，成功时连接以该用户认证，失败时记录到acl日志，已经认证的连接保持原来的用户
+func (s *StandaloneDatabase) authenticate(client resp.Connection, cmdName, username, password string) bool {
+	if !s.acl.authenticate(username, password) {
+		s.acl.log.add("auth", "toplevel", cmdName, username, client)
+		return false
+	}
+	client.SetAuthenticated(true)
+	client.SetUser(username)
+	return true
+}
+
+// execAuth auth [username] password
+func (s *StandaloneDatabase) execAuth(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	username := defaultUser
+	password := string(args[0])
+	if len(args) == 2 {
+		username, password = string(args[0]), string(args[1])
+	} else if s.acl.defaultNoPass() {
+		return reply.MakeStandardErrorReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if !s.authenticate(client, "AUTH", username, password) {
+		return reply.MakeStandardErrorReply(wrongPassErr)
+	}
+	return reply.MakeOKReply()
+}
+
+// execHello hello [protover [AUTH username password] [SETNAME clientname]]，可以同时完成认证，只支持RESP2协议
+func (s *StandaloneDatabase) execHello(client resp.Connection, args [][]byte) resp.Reply {
+	clientName := ""
+	if len(args) > 0 {
+		protover, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR Protocol version is not an integer or out of range")
+		}
+		if protover != 2 {
+			return reply.MakeStandardErrorReply("NOPROTO unsupported protocol version")
+		}
+		for i := 1; i < len(args); i++ {
+			switch {
+			case strings.EqualFold(string(args[i]), "auth") && i+2 < len(args):
+				if !s.authenticate(client, "HELLO", string(args[i+1]), string(args[i+2])) {
+					return reply.MakeStandardErrorReply(wrongPassErr)
+				}
+				i += 2
+			case strings.EqualFold(string(args[i]), "setname") && i+1 < len(args):
+				clientName = string(args[i+1])
+				if !validClientName(clientName) {
+					return reply.MakeStandardErrorReply(invalidClientNameErr)
+				}
+				i++
+			default:
+				return reply.MakeStandardErrorReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+			}
+		}
+	}
+	if !client.IsAuthenticated() && !s.acl.defaultNoPass() {
+		return reply.MakeStandardErrorReply("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if clientName != "" {
+		client.SetName(clientName)
+	}
+	role := "master"
+	if s.repl.master.Load() != nil {
+		role = "replica"
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(serverVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(2),
+		reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(client.GetID()),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte("standalone")),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte(role)),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkReply(),
+	})
+}
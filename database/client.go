@@ -0,0 +1,462 @@
+package database
+
+import (
+	databaseface "redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// client命令
+// client id|getname|setname|list|info|kill|pause|unpause|no-evict|reply
+
+const invalidClientNameErr = "ERR Client names cannot contain spaces, newlines or special characters."
+
+// 暂停客户端的模式，client pause 设置
+const (
+	pauseNone  = iota
+	pauseWrite // 只暂停写入命令
+	pauseAll   // 暂停所有命令
+)
+
+// clientPause 暂停客户端的状态，暂停期间命令会阻塞到暂停结束
+type clientPause struct {
+	mu    sync.Mutex
+	mode  int
+	until time.Time
+	done  chan struct{} // 暂停结束时关闭，唤醒所有等待的命令
+}
+
+// pause 暂停客户端，已经处于暂停状态时取更晚的结束时间和更严格的模式
+func (p *clientPause) pause(mode int, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.currentLocked() == pauseNone {
+		p.mode, p.until = mode, until
+		p.done = make(chan struct{})
+		return
+	}
+	p.mode = max(p.mode, mode)
+	if until.After(p.until) {
+		p.until = until
+	}
+}
+
+// unpause 结束暂停，唤醒所有等待的命令
+func (p *clientPause) unpause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+	p.mode = pauseNone
+}
+
+// currentLocked 获取当前的暂停模式，到达结束时间时自动结束暂停，调用方需要持有 p.mu
+func (p *clientPause) currentLocked() int {
+	if p.mode != pauseNone && !time.Now().Before(p.until) {
+		close(p.done)
+		p.mode, p.done = pauseNone, nil
+	}
+	return p.mode
+}
+
+// isPaused 写入命令是否处于暂停状态，暂停期间不进行主动过期
+func (p *clientPause) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.currentLocked() != pauseNone
+}
+
+// wait 命令被暂停时阻塞到暂停结束
+func (p *clientPause) wait(isWrite bool) {
+	for {
+		p.mu.Lock()
+		mode, until, done := p.currentLocked(), p.until, p.done
+		p.mu.Unlock()
+		if mode == pauseNone || mode == pauseWrite && !isWrite {
+			return
+		}
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// waitUnpause 命令被 client pause 暂停时等待暂停结束，事务中只有 exec 需要等待
+// 主节点的命令流不受暂停影响，否则复制会停滞，replicaof no one 也会一直等待同步协程退出
+func (s *StandaloneDatabase) waitUnpause(client resp.Connection, cmdName string, args [][]byte) {
+	if client == resp.Connection(s.repl.masterClient) {
+		return
+	}
+	if client.InMultiState() && cmdName != "exec" {
+		return
+	}
+	isWrite := cmdName == "publish" || isWriteCommand(cmdName, args[1:])
+	if cmdName == "exec" {
+		for _, cmdLine := range client.GetQueuedCmdLine() {
+			queuedName := strings.ToLower(string(cmdLine[0]))
+			if queuedName == "publish" || isWriteCommand(queuedName, cmdLine[1:]) {
+				isWrite = true
+				break
+			}
+		}
+	}
+	s.pause.wait(isWrite)
+}
+
+// SetClients 设置当前所有的客户端连接，创建处理器时调用
+func (s *StandaloneDatabase) SetClients(clients databaseface.Clients) {
+	s.clients = clients
+}
+
+// forEachClient 遍历所有的客户端连接，没有处理器时只有当前连接
+func (s *StandaloneDatabase) forEachClient(current resp.Connection, consumer func(client resp.Connection) bool) {
+	if s.clients == nil {
+		consumer(current)
+		return
+	}
+	s.clients.ForEachClient(consumer)
+}
+
+// isReplicaClient 判断连接是否为从节点的连接
+func (s *StandaloneDatabase) isReplicaClient(client resp.Connection) bool {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	_, ok := s.repl.replicas[client]
+	return ok
+}
+
+// clientType 连接的类型，client list 和 client kill 按类型过滤时使用
+func (s *StandaloneDatabase) clientType(client resp.Connection) string {
+	if s.isReplicaClient(client) {
+		return "replica"
+	}
+	if client.SubsCount() > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// clientInfo 连接的信息，格式和redis的 client list 相同
+func (s *StandaloneDatabase) clientInfo(client resp.Connection) string {
+	stats := client.GetStats()
+	flags := ""
+	if s.isReplicaClient(client) {
+		flags += "S"
+	}
+	if client.SubsCount() > 0 {
+		flags += "P"
+	}
+	if stats.MultiCmds >= 0 {
+		flags += "x"
+	}
+	if client.IsNoEvict() {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	user := client.GetUser()
+	if user == "" {
+		user = defaultUser
+	}
+	now := time.Now()
+	totMem := stats.QueryBuf + stats.ArgvMem + stats.MultiMem + stats.OutputBuf
+	return "id=" + strconv.FormatInt(client.GetID(), 10) +
+		" addr=" + client.RemoteAddr() +
+		" laddr=" + client.LocalAddr() +
+		" name=" + client.GetName() +
+		" age=" + strconv.FormatInt(int64(now.Sub(stats.CreateTime).Seconds()), 10) +
+		" idle=" + strconv.FormatInt(int64(now.Sub(stats.LastInteraction).Seconds()), 10) +
+		" flags=" + flags +
+		" db=" + strconv.Itoa(client.GetDBIndex()) +
+		" sub=" + strconv.Itoa(len(client.GetChannels())) +
+		" psub=" + strconv.Itoa(len(client.GetPatterns())) +
+		" multi=" + strconv.Itoa(stats.MultiCmds) +
+		" qbuf=" + strconv.Itoa(stats.QueryBuf) +
+		" argv-mem=" + strconv.Itoa(stats.ArgvMem) +
+		" multi-mem=" + strconv.Itoa(stats.MultiMem) +
+		" obl=" + strconv.Itoa(stats.OutputBuf) +
+		" oll=0 omem=0" +
+		" tot-mem=" + strconv.Itoa(totMem) +
+		" cmd=" + stats.LastCmd +
+		" user=" + user +
+		" resp=2"
+}
+
+// execClient client subcommand [arg ...]
+func (s *StandaloneDatabase) execClient(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "id":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|id")
+		}
+		return reply.MakeIntReply(client.GetID())
+	case "getname":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|getname")
+		}
+		if client.GetName() == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(client.GetName()))
+	case "setname":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|setname")
+		}
+		if !validClientName(string(args[0])) {
+			return reply.MakeStandardErrorReply(invalidClientNameErr)
+		}
+		client.SetName(string(args[0]))
+		return reply.MakeOKReply()
+	case "info":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|info")
+		}
+		return reply.MakeBulkReply([]byte(s.clientInfo(client) + "\n"))
+	case "list":
+		return s.execClientList(client, args)
+	case "kill":
+		return s.execClientKill(client, args)
+	case "pause":
+		return s.execClientPause(args)
+	case "unpause":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|unpause")
+		}
+		s.pause.unpause()
+		return reply.MakeOKReply()
+	case "no-evict":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|no-evict")
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			client.SetNoEvict(true)
+		case "off":
+			client.SetNoEvict(false)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOKReply()
+	case "reply":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|reply")
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			client.SetReplyMode(resp.ReplyOn)
+		case "off":
+			client.SetReplyMode(resp.ReplyOff)
+		case "skip":
+			client.SetReplyMode(resp.ReplySkip)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOKReply()
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// validClientName 连接的名称中不能包含空格、换行等特殊字符，空字符串表示清除名称
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// execClientList client list [TYPE normal|master|replica|pubsub] [ID client-id [client-id ...]]
+func (s *StandaloneDatabase) execClientList(client resp.Connection, args [][]byte) resp.Reply {
+	clientType := ""
+	var ids map[int64]struct{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "type":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			clientType = strings.ToLower(string(args[i]))
+			switch clientType {
+			case "normal", "master", "replica", "pubsub":
+			case "slave":
+				clientType = "replica"
+			default:
+				return reply.MakeStandardErrorReply("ERR Unknown client type '" + string(args[i]) + "'")
+			}
+		case "id":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			ids = make(map[int64]struct{})
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return reply.MakeStandardErrorReply("ERR Invalid client ID")
+				}
+				ids[id] = struct{}{}
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	var clients []resp.Connection
+	s.forEachClient(client, func(c resp.Connection) bool {
+		if clientType != "" && s.clientType(c) != clientType {
+			return true
+		}
+		if _, ok := ids[c.GetID()]; ids != nil && !ok {
+			return true
+		}
+		clients = append(clients, c)
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetID() < clients[j].GetID()
+	})
+	var builder strings.Builder
+	for _, c := range clients {
+		builder.WriteString(s.clientInfo(c))
+		builder.WriteByte('\n')
+	}
+	return reply.MakeBulkReply([]byte(builder.String()))
+}
+
+// clientKillFilter client kill 的过滤条件，为空的条件不进行过滤
+type clientKillFilter struct {
+	id         int64
+	addr       string
+	laddr      string
+	user       string
+	clientType string
+	skipMe     bool
+}
+
+func (f *clientKillFilter) match(s *StandaloneDatabase, current, client resp.Connection) bool {
+	if f.skipMe && client == current {
+		return false
+	}
+	return (f.id == 0 || client.GetID() == f.id) &&
+		(f.addr == "" || client.RemoteAddr() == f.addr) &&
+		(f.laddr == "" || client.LocalAddr() == f.laddr) &&
+		(f.user == "" || client.GetUser() == f.user || client.GetUser() == "" && f.user == defaultUser) &&
+		(f.clientType == "" || s.clientType(client) == f.clientType)
+}
+
+// execClientKill client kill ip:port
+// client kill [ID client-id] [ADDR ip:port] [LADDR ip:port] [USER username] [TYPE type] [SKIPME yes|no]
+func (s *StandaloneDatabase) execClientKill(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client|kill")
+	}
+	// 旧的格式只按地址关闭一个连接，返回OK
+	if len(args) == 1 {
+		filter := &clientKillFilter{addr: string(args[0])}
+		if s.killClients(client, filter) == 0 {
+			return reply.MakeStandardErrorReply("ERR No such client")
+		}
+		return reply.MakeOKReply()
+	}
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	filter := &clientKillFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return reply.MakeStandardErrorReply("ERR client-id should be greater than 0")
+			}
+			filter.id = id
+		case "addr":
+			filter.addr = value
+		case "laddr":
+			filter.laddr = value
+		case "user":
+			if s.acl.getUser(value) == nil {
+				return reply.MakeStandardErrorReply("ERR No such user '" + value + "'")
+			}
+			filter.user = value
+		case "type":
+			filter.clientType = strings.ToLower(value)
+			switch filter.clientType {
+			case "normal", "master", "replica", "pubsub":
+			case "slave":
+				filter.clientType = "replica"
+			default:
+				return reply.MakeStandardErrorReply("ERR Unknown client type '" + value + "'")
+			}
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.skipMe = true
+			case "no":
+				filter.skipMe = false
+			default:
+				return reply.MakeSyntaxErrReply()
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	return reply.MakeIntReply(int64(s.killClients(client, filter)))
+}
+
+// killClients 关闭所有满足条件的连接，返回关闭的连接数
+func (s *StandaloneDatabase) killClients(current resp.Connection, filter *clientKillFilter) int {
+	killed := 0
+	s.forEachClient(current, func(c resp.Connection) bool {
+		if filter.match(s, current, c) {
+			c.Kill()
+			killed++
+		}
+		return true
+	})
+	return killed
+}
+
+// execClientPause client pause timeout [WRITE|ALL]
+func (s *StandaloneDatabase) execClientPause(args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("client|pause")
+	}
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return reply.MakeStandardErrorReply("ERR timeout is not an integer or out of range")
+	}
+	mode := pauseAll
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			mode = pauseWrite
+		case "all":
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	until, ok := relativeExpireTime(timeout)
+	if !ok {
+		return reply.MakeStandardErrorReply("ERR timeout is not an integer or out of range")
+	}
+	s.pause.pause(mode, until)
+	return reply.MakeOKReply()
+}
@@ -7,17 +7,129 @@ var cmdTable = make(map[string]*command)
 
 // command 命令元信息，包含命令的名称，命令需要的参数个数，命令执行函数
 type command struct {
-	name  string
-	exec  ExecFunc
-	arity int
+	name    string
+	exec    ExecFunc
+	arity   int
+	prepare PreFunc // 获取命令涉及的key，用于执行前加锁，为nil时不加锁
+	// acl中的命令分类，读写分类根据prepare分析出的key自动添加，数据类型等分类在注册时指定
+	categories []string
+}
+
+// PreFunc 分析命令参数，返回需要加写锁和读锁的key
+type PreFunc func(args [][]byte) (writeKeys []string, readKeys []string)
+
+// CommandOption 命令注册时的可选项
+type CommandOption func(cmd *command)
+
+// WithPrepare 设置命令的加锁分析方法，读写多个key的命令需要设置，保证命令执行的原子性
+func WithPrepare(prepare PreFunc) CommandOption {
+	return func(cmd *command) {
+		cmd.prepare = prepare
+	}
+}
+
+// WithCategories 设置命令所属的acl分类
+func WithCategories(categories ...string) CommandOption {
+	return func(cmd *command) {
+		cmd.categories = append(cmd.categories, categories...)
+	}
 }
 
 // RegisterCommand 命令注册方法
-func RegisterCommand(name string, exec ExecFunc, arity int) {
+func RegisterCommand(name string, exec ExecFunc, arity int, opts ...CommandOption) {
 	name = strings.TrimSpace(strings.ToLower(name)) // 做一下兼容性处理
-	cmdTable[name] = &command{
+	cmd := &command{
+		name:  name,
 		exec:  exec,
 		arity: arity,
 	}
+	for _, opt := range opts {
+		opt(cmd)
+	}
+	if category := rwCategory(cmd); category != "" {
+		cmd.categories = append(cmd.categories, category)
+	}
+	cmdTable[name] = cmd
+}
+
+// rwCategory 使用满足参数个数要求的参数调用prepare，写入key的命令属于write分类，只读取key的命令属于read分类
+func rwCategory(cmd *command) string {
+	if cmd.prepare == nil {
+		return ""
+	}
+	argc := cmd.arity
+	if argc < 0 {
+		argc = -argc
+	}
+	args := make([][]byte, max(argc, 1))
+	for i := range args {
+		args[i] = []byte("key")
+	}
+	writeKeys, readKeys := cmd.prepare(args)
+	if len(writeKeys) > 0 {
+		return catWrite
+	}
+	if len(readKeys) > 0 {
+		return catRead
+	}
+	return ""
+}
 
+// writeFirstKey 第一个参数为写入的key
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+// readFirstKey 第一个参数为读取的key
+func readFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+// writeAllKeys 所有参数都是写入的key
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys, nil
+}
+
+// readAllKeys 所有参数都是读取的key
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return nil, keys
+}
+
+// writeFirstReadOthers 第一个参数为写入的key，其余参数为读取的key，如 sinterstore dest key [key ...]
+func writeFirstReadOthers(args [][]byte) ([]string, []string) {
+	_, readKeys := readAllKeys(args[1:])
+	return []string{string(args[0])}, readKeys
+}
+
+// isWriteCommand 判断命令是否会写入数据，从节点只读时用于拒绝写入命令
+// 根据prepare分析出的写入key进行判断，不涉及key的写入命令需要单独列出
+func isWriteCommand(cmdName string, args [][]byte) bool {
+	if cmdName == "flush" {
+		return true
+	}
+	cmd, ok := cmdTable[cmdName]
+	if !ok || cmd.prepare == nil || !ValidateArity(cmd.arity, args) {
+		return false
+	}
+	writeKeys, _ := cmd.prepare(args)
+	return len(writeKeys) > 0
+}
+
+// GetRelatedKeys 获取命令涉及的key，集群模式下用于确定命令由哪个节点执行
+// 命令不存在、参数个数错误或者命令不涉及key时 ok 为false
+func GetRelatedKeys(cmdLine [][]byte) (writeKeys []string, readKeys []string, ok bool) {
+	cmd, exists := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !exists || cmd.prepare == nil || !ValidateArity(cmd.arity, cmdLine[1:]) {
+		return nil, nil, false
+	}
+	writeKeys, readKeys = cmd.prepare(cmdLine[1:])
+	return writeKeys, readKeys, len(writeKeys)+len(readKeys) > 0
 }
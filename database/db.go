@@ -6,8 +6,11 @@ import (
 	"redis-go/interface/database"
 	"redis-go/interface/resp"
 	"redis-go/lib/logger"
+	"redis-go/lib/sync/lock"
+	"redis-go/lib/utils"
 	"redis-go/resp/reply"
 	"strings"
+	"time"
 )
 
 // DB 是最基础数据执行单元，对应redis中的16个数据库。
@@ -20,15 +23,27 @@ import (
 type DB struct {
 	index  int
 	data   dict.Dict
-	addAof func(line constant.CommandLine)
+	ttlMap dict.Dict   // key -> 过期时间(time.Time)，只记录设置了过期时间的key
+	locker *lock.Locks // key级别的读写锁，保证读取-修改-写入类命令的原子性
+	// key -> 版本号(uint32)，key每次被写入时版本号递增，用于watch实现乐观锁
+	versionMap dict.Dict
+	addAof     func(lines ...constant.CommandLine)
+	// 正在进行的快照，key被写入之前需要先将旧值写入快照，事务中复制的DB共享同一份
+	snapshots *snapshotSet
 }
 
+const lockerSize = 1024
+
 func MakeDB() *DB {
 	return &DB{
-		index: 0,
-		data:  dict.MakeSyncDict(),
+		index:      0,
+		data:       dict.MakeSyncDict(),
+		ttlMap:     dict.MakeSyncDict(),
+		locker:     lock.Make(lockerSize),
+		versionMap: dict.MakeSyncDict(),
+		snapshots:  &snapshotSet{},
 		// 这里要给addAof设置一个初始化的空方法，保证在LoadAof文件的时候不会重复写入命令
-		addAof: func(line constant.CommandLine) {
+		addAof: func(lines ...constant.CommandLine) {
 			logger.Info("[New DB] init db add aof function")
 		},
 	}
@@ -43,16 +58,62 @@ type ExecFunc func(db *DB, args [][]byte) resp.Reply
 func (db *DB) Exec(client resp.Connection, cmdLine constant.CommandLine) resp.Reply {
 	// 1. 获取命令
 	cmdName := strings.ToLower(string(cmdLine[0]))
-	// 2. 获取命令元信息
+	// 2. 事务相关的命令需要操作连接上的状态，单独进行处理
+	if client != nil {
+		switch cmdName {
+		case "multi":
+			return startMulti(client, cmdLine[1:])
+		case "exec":
+			// 单独使用db时事务中的命令都在当前db执行
+			return execMulti(func(int) *DB { return db }, nil, client, cmdLine[1:])
+		case "discard":
+			return discardMulti(client, cmdLine[1:])
+		case "watch":
+			return execWatch(db, client, cmdLine[1:])
+		case "unwatch":
+			return execUnwatch(client, cmdLine[1:])
+		}
+		// 处于事务中的命令只入队不执行
+		if client.InMultiState() {
+			return enqueueCmd(client, cmdLine)
+		}
+	}
+	return db.execNormalCommand(cmdLine)
+}
+
+// execNormalCommand 执行普通命令
+func (db *DB) execNormalCommand(cmdLine constant.CommandLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	// 1. 获取命令元信息
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeStandardErrorReply("[Command Error] Unknow command: " + cmdName)
+	}
+	// 2. 进行参数检查，因为存在可变参数的情况，这里抽象一下
+	if !ValidateArity(cmd.arity, cmdLine[1:]) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	// 3. 对命令涉及的key加锁后执行，写入的key需要更新版本号
+	args := cmdLine[1:]
+	if cmd.prepare != nil {
+		writeKeys, readKeys := cmd.prepare(args)
+		db.locker.RWLocks(writeKeys, readKeys)
+		defer db.locker.RWUnLocks(writeKeys, readKeys)
+		db.addVersion(writeKeys...)
+	}
+	return cmd.exec(db, args)
+}
+
+// execWithoutLock 执行命令但不加锁，调用方需要保证已经持有了对应key的锁
+func (db *DB) execWithoutLock(cmdLine constant.CommandLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
 	if !ok {
 		return reply.MakeStandardErrorReply("[Command Error] Unknow command: " + cmdName)
 	}
-	// 3. 进行参数检查，因为存在可变参数的情况，这里抽象一下
 	if !ValidateArity(cmd.arity, cmdLine[1:]) {
 		return reply.MakeArgNumErrReply(cmdName)
 	}
-	// 4. 命令执行
 	return cmd.exec(db, cmdLine[1:])
 }
 
@@ -66,6 +127,10 @@ func ValidateArity(arity int, args [][]byte) bool {
 
 // GetEntity 获取指定key的数据实体
 func (db *DB) GetEntity(key string) (database.DataEntity, bool) {
+	// 惰性删除，访问时发现key已过期则直接删除
+	if db.expireIfNeeded(key) {
+		return database.DataEntity{}, false
+	}
 	// 从底层数据
 	val, exist := db.data.Get(key)
 	if !exist {
@@ -82,16 +147,20 @@ func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
 
 // PutIfExists 存在则更新
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
+	// 已过期但尚未清理的key视为不存在
+	db.expireIfNeeded(key)
 	return db.data.PutIfExists(key, entity.Data)
 }
 
 // PutIfAbsent 存在则放弃写入
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
+	db.expireIfNeeded(key)
 	return db.data.PutIfAbsent(key, entity.Data)
 }
 
-// Remove 删除数据
+// Remove 删除数据，同时清理过期时间
 func (db *DB) Remove(key string) int {
+	db.ttlMap.Remove(key)
 	return db.data.Remove(key)
 }
 
@@ -99,7 +168,7 @@ func (db *DB) Remove(key string) int {
 func (db *DB) Removes(keys ...string) int {
 	deleted := 0 //
 	for _, key := range keys {
-		result := db.data.Remove(key)
+		result := db.Remove(key)
 		if result > 0 {
 			deleted++
 		}
@@ -107,9 +176,116 @@ func (db *DB) Removes(keys ...string) int {
 	return deleted
 }
 
+// ForEach 遍历db中所有未过期的key，expiration 为nil表示没有设置过期时间
+func (db *DB) ForEach(consumer func(key string, entity *database.DataEntity, expiration *time.Time) bool) {
+	db.data.ForEach(func(key string, val interface{}) bool {
+		var expiration *time.Time
+		if expireTime, ok := db.TTL(key); ok {
+			if time.Now().After(expireTime) {
+				return true
+			}
+			expiration = &expireTime
+		}
+		return consumer(key, &database.DataEntity{Data: val}, expiration)
+	})
+}
+
 // Flush 清空数据库
 func (db *DB) Flush() {
+	// 清空数据库会影响所有的key，这里需要通知到watch了这些key的客户端
+	db.data.ForEach(func(key string, val interface{}) bool {
+		db.addVersion(key)
+		return true
+	})
 	db.data.Clear()
+	db.ttlMap.Clear()
+}
+
+// Expire 设置key的过期时间，时间为绝对时间
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
+
+// Persist 移除key的过期时间，返回是否存在过期时间
+func (db *DB) Persist(key string) int {
+	return db.ttlMap.Remove(key)
+}
+
+// TTL 获取key的过期时间，第二个返回值表示是否设置了过期时间
+func (db *DB) TTL(key string) (time.Time, bool) {
+	raw, ok := db.ttlMap.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// IsExpired 判断key是否已经过期，未设置过期时间的key永不过期
+func (db *DB) IsExpired(key string) bool {
+	expireTime, ok := db.TTL(key)
+	if !ok {
+		return false
+	}
+	return time.Now().After(expireTime)
+}
+
+// expireIfNeeded key过期则删除，并将删除操作写入aof，返回是否发生了删除
+func (db *DB) expireIfNeeded(key string) bool {
+	if !db.IsExpired(key) {
+		return false
+	}
+	db.Remove(key)
+	db.addVersion(key)
+	db.addAof(utils.ToCmdLine("DEL", key))
+	return true
+}
+
+// GetVersion 获取key的版本号，从未写入过的key版本号为0
+func (db *DB) GetVersion(key string) uint32 {
+	raw, ok := db.versionMap.Get(key)
+	if !ok {
+		return 0
+	}
+	return raw.(uint32)
+}
+
+// addVersion 递增key的版本号，key被写入之前调用
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		db.versionMap.Put(key, db.GetVersion(key)+1)
+	}
+	db.beforeWrite(keys...)
+}
+
+const (
+	activeExpireSampleSize  = 20                    // 每轮抽样的key数量
+	activeExpireRepeatRatio = 4                     // 过期比例超过 1/4 时继续下一轮抽样
+	activeExpireTimeLimit   = 25 * time.Millisecond // 单次主动过期的最长耗时，避免长时间占用
+)
+
+// activeExpireCycle 主动过期，随机抽样设置了过期时间的key并删除其中已过期的部分
+// 惰性删除只能处理被访问到的key，长期不访问的过期key需要依靠这里进行回收
+func (db *DB) activeExpireCycle() {
+	start := time.Now()
+	for {
+		keys := db.ttlMap.RandomDistinctKeys(activeExpireSampleSize)
+		if len(keys) == 0 {
+			return
+		}
+		expired := 0
+		for _, key := range keys {
+			// 和命令执行并发，删除前需要对key加锁
+			db.locker.Lock(key)
+			if db.expireIfNeeded(key) {
+				expired++
+			}
+			db.locker.UnLock(key)
+		}
+		// 过期比例较低或者耗时过长时结束本轮
+		if expired*activeExpireRepeatRatio < len(keys) || time.Since(start) > activeExpireTimeLimit {
+			return
+		}
+	}
 }
 
 //下面简单写一个选项模式的内容，主要是联系使用，对于本文的借口没有实际意义
@@ -160,9 +336,13 @@ func NewDB(opts ...Option) *DB {
 		opt.apply(option)
 	}
 	return &DB{
-		index: option.index,
-		data:  option.data,
-		addAof: func(line constant.CommandLine) {
+		index:      option.index,
+		data:       option.data,
+		ttlMap:     dict.MakeSyncDict(),
+		locker:     lock.Make(lockerSize),
+		versionMap: dict.MakeSyncDict(),
+		snapshots:  &snapshotSet{},
+		addAof: func(lines ...constant.CommandLine) {
 			logger.Info("[New DB] init db add aof function")
 		},
 	}
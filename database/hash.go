@@ -0,0 +1,431 @@
+package database
+
+import (
+	"math"
+	"redis-go/datastruct/dict"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/utils"
+	"redis-go/lib/wildcard"
+	"redis-go/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hash 命令实现，包含hset，hget，hdel，hgetall，hincrby等命令
+// hash 的底层存储直接复用 dict.Dict 接口，字段值统一为 []byte
+
+// getAsHash 获取hash类型的值，key不存在返回nil，类型不匹配返回类型错误
+func (db *DB) getAsHash(key string) (dict.Dict, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	hash, ok := entity.Data.(dict.Dict)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return hash, nil
+}
+
+// getOrInitHash 获取hash，key不存在时创建一个新的hash
+func (db *DB) getOrInitHash(key string) (hash dict.Dict, isNew bool, errReply reply.ErrorReply) {
+	hash, errReply = db.getAsHash(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if hash == nil {
+		hash = dict.MakeSimpleDict()
+		db.PutEntity(key, &database.DataEntity{Data: hash})
+		isNew = true
+	}
+	return hash, isNew, nil
+}
+
+// formatFloat 浮点数格式化，使用最短的表示方式，和redis的输出保持一致
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// hset key field value [field value ...]，返回新增的字段个数
+func execHSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	hash, _, errReply := db.getOrInitHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		added += hash.Put(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLineWithName("HSET", args...))
+	return reply.MakeIntReply(int64(added))
+}
+
+// hmset key field value [field value ...]，已废弃的写法，返回OK
+func execHMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hmset")
+	}
+	res := execHSet(db, args)
+	if reply.IsErrReply(res) {
+		return res
+	}
+	return reply.MakeOKReply()
+}
+
+// hsetnx key field value，字段不存在时写入
+func execHSetNX(db *DB, args [][]byte) resp.Reply {
+	hash, _, errReply := db.getOrInitHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := hash.PutIfAbsent(string(args[1]), args[2])
+	if result > 0 {
+		db.addAof(utils.ToCmdLineWithName("HSETNX", args...))
+	}
+	return reply.MakeIntReply(int64(result))
+}
+
+// hget key field
+func execHGet(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeNullBulkReply()
+	}
+	val, exists := hash.Get(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(val.([]byte))
+}
+
+// hmget key field [field ...]，不存在的字段返回nil
+func execHMGet(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if hash == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		val, exists := hash.Get(string(field))
+		if exists {
+			result[i] = val.([]byte)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// hdel key field [field ...]，返回删除的字段个数
+func execHDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	deleted := 0
+	for _, field := range args[1:] {
+		deleted += hash.Remove(string(field))
+	}
+	// hash为空时删除key
+	if hash.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLineWithName("HDEL", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// hexists key field
+func execHExists(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	if _, exists := hash.Get(string(args[1])); exists {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// hlen key
+func execHLen(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(hash.Len()))
+}
+
+// hstrlen key field
+func execHStrLen(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	val, exists := hash.Get(string(args[1]))
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(len(val.([]byte))))
+}
+
+// hgetall key，返回 field1 value1 field2 value2 ...
+func execHGetAll(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, hash.Len()*2)
+	hash.ForEach(func(field string, val interface{}) bool {
+		result = append(result, []byte(field), val.([]byte))
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// hkeys key
+func execHKeys(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, val interface{}) bool {
+		result = append(result, []byte(field))
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// hvals key
+func execHVals(db *DB, args [][]byte) resp.Reply {
+	hash, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, val interface{}) bool {
+		result = append(result, val.([]byte))
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// hincrby key field increment
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	hash, _, errReply := db.getOrInitHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if val, exists := hash.Get(field); exists {
+		current, err = strconv.ParseInt(string(val.([]byte)), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR hash value is not an integer")
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return reply.MakeStandardErrorReply("ERR increment or decrement would overflow")
+	}
+	current += delta
+	hash.Put(field, []byte(strconv.FormatInt(current, 10)))
+	db.addAof(utils.ToCmdLineWithName("HINCRBY", args...))
+	return reply.MakeIntReply(current)
+}
+
+// hincrbyfloat key field increment
+// 浮点运算在不同平台上可能存在精度差异，aof中记录计算结果而不是增量
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeStandardErrorReply("ERR value is not a valid float")
+	}
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if val, exists := hash.Get(field); exists {
+		current, err = strconv.ParseFloat(string(val.([]byte)), 64)
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR hash value is not a float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return reply.MakeStandardErrorReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(formatFloat(current))
+	hash.Put(field, result)
+	db.addAof(utils.ToCmdLine("HSET", key, field, string(result)))
+	return reply.MakeBulkReply(result)
+}
+
+// scanOptions scan系列命令的公共选项
+type scanOptions struct {
+	pattern  *wildcard.Pattern
+	count    int
+	noValues bool
+}
+
+// parseScanOptions 解析 [MATCH pattern] [COUNT count] [NOVALUES] 选项
+func parseScanOptions(args [][]byte, allowNoValues bool) (*scanOptions, resp.Reply) {
+	opts := &scanOptions{count: 10}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.pattern = wildcard.CompilePattern(string(args[i+1]))
+			i++
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeIntErrReply()
+			}
+			if count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.count = min(count, maxScanCount)
+			i++
+		case "NOVALUES":
+			if !allowNoValues {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.noValues = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// maxScanCount scan系列命令单次遍历的最大数量
+const maxScanCount = 1 << 20
+
+// scanKeys 对有序的key列表进行游标遍历，游标即下一次遍历的起始下标，返回0表示遍历结束
+func scanKeys(keys []string, cursor int, opts *scanOptions) ([]string, int) {
+	sort.Strings(keys)
+	// 按照剩余的key数量确定本次遍历的结束位置，cursor 由客户端指定，相加时可能溢出
+	end := len(keys)
+	if cursor < len(keys) && opts.count < len(keys)-cursor {
+		end = cursor + opts.count
+	}
+	result := make([]string, 0, max(end-cursor, 0))
+	i := cursor
+	for ; i < end; i++ {
+		if opts.pattern == nil || opts.pattern.IsMatch(keys[i]) {
+			result = append(result, keys[i])
+		}
+	}
+	if i >= len(keys) {
+		i = 0
+	}
+	return result, i
+}
+
+// parseCursor 解析游标
+func parseCursor(arg []byte) (int, resp.Reply) {
+	cursor, err := strconv.Atoi(string(arg))
+	if err != nil || cursor < 0 {
+		return 0, reply.MakeStandardErrorReply("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// hscan key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	cursor, errReply := parseCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	hash, wrongType := db.getAsHash(string(args[0]))
+	if wrongType != nil {
+		return wrongType
+	}
+	if hash == nil {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("0")),
+			reply.MakeEmptyMultiBulkReply(),
+		})
+	}
+	fields, next := scanKeys(hash.Keys(), cursor, opts)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if !opts.noValues {
+			val, _ := hash.Get(field)
+			result = append(result, val.([]byte))
+		}
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.Itoa(next))),
+		reply.MakeMultiBulkReply(result),
+	})
+}
+
+func init() {
+	RegisterCommand("hset", execHSet, -3, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hmset", execHMSet, -3, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hsetnx", execHSetNX, 3, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hget", execHGet, 2, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hmget", execHMGet, -2, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hdel", execHDel, -2, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hexists", execHExists, 2, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hlen", execHLen, 1, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hstrlen", execHStrLen, 2, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hgetall", execHGetAll, 1, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hkeys", execHKeys, 1, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hvals", execHVals, 1, WithPrepare(readFirstKey), WithCategories(catHash))
+	RegisterCommand("hincrby", execHIncrBy, 3, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hincrbyfloat", execHIncrByFloat, 3, WithPrepare(writeFirstKey), WithCategories(catHash))
+	RegisterCommand("hscan", execHScan, -2, WithPrepare(readFirstKey), WithCategories(catHash))
+}
@@ -0,0 +1,388 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"redis-go/config"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// info和role命令，输出服务器的运行状态
+
+// serverVersion 兼容的redis版本，客户端会根据版本判断支持的命令
+const serverVersion = "7.0.0"
+
+// infoSection info命令的一个分组，default 表示不指定分组时是否输出
+type infoSection struct {
+	name     string
+	dflt     bool
+	generate func(s *StandaloneDatabase, builder *strings.Builder)
+}
+
+var infoSections = []infoSection{
+	{name: "server", dflt: true, generate: (*StandaloneDatabase).infoServer},
+	{name: "clients", dflt: true, generate: (*StandaloneDatabase).infoClients},
+	{name: "memory", dflt: true, generate: (*StandaloneDatabase).infoMemory},
+	{name: "persistence", dflt: true, generate: (*StandaloneDatabase).infoPersistence},
+	{name: "stats", dflt: true, generate: (*StandaloneDatabase).infoStats},
+	{name: "replication", dflt: true, generate: (*StandaloneDatabase).infoReplication},
+	{name: "cluster", dflt: true, generate: (*StandaloneDatabase).infoCluster},
+	{name: "keyspace", dflt: true, generate: (*StandaloneDatabase).infoKeyspace},
+}
+
+// opsSampleCount 计算每秒执行命令数时使用的采样数，和redis一样取最近16次采样的平均值
+const opsSampleCount = 16
+
+// opsSampler 在后台定时任务中对执行过的命令总数采样，计算每秒执行命令数
+type opsSampler struct {
+	mu        sync.Mutex
+	samples   [opsSampleCount]int64
+	idx       int
+	lastTime  time.Time
+	lastCount int64
+}
+
+// sample 记录一次采样，count 为当前执行过的命令总数
+func (o *opsSampler) sample(count int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	if !o.lastTime.IsZero() {
+		if elapsed := now.Sub(o.lastTime).Milliseconds(); elapsed > 0 {
+			o.samples[o.idx] = (count - o.lastCount) * 1000 / elapsed
+			o.idx = (o.idx + 1) % opsSampleCount
+		}
+	}
+	o.lastTime, o.lastCount = now, count
+}
+
+// opsPerSec 最近的每秒执行命令数
+func (o *opsSampler) opsPerSec() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var sum int64
+	for _, sample := range o.samples {
+		sum += sample
+	}
+	return sum / opsSampleCount
+}
+
+// execInfo info [section ...]
+func (s *StandaloneDatabase) execInfo(args [][]byte) resp.Reply {
+	selected := make(map[string]bool)
+	for _, arg := range args {
+		selected[strings.ToLower(string(arg))] = true
+	}
+	all := selected["all"] || selected["everything"]
+	dflt := len(args) == 0 || selected["default"]
+	builder := &strings.Builder{}
+	for _, section := range infoSections {
+		if !all && !selected[section.name] && !(dflt && section.dflt) {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString(reply.CRLF)
+		}
+		builder.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + reply.CRLF)
+		section.generate(s, builder)
+	}
+	return reply.MakeBulkReply([]byte(builder.String()))
+}
+
+// writeInfoField 写入一行 key:value
+func writeInfoField(builder *strings.Builder, key string, value any) {
+	builder.WriteString(key + ":" + fmt.Sprint(value) + reply.CRLF)
+}
+
+// bytesToHuman 把字节数转换为便于阅读的格式，和redis的格式相同，如 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"K", "M", "G", "T", "P"}
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	value := float64(n) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.2f%s", value, units[unit])
+}
+
+// boolToInt info中的开关状态输出为0和1
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// infoServer 服务器的基本信息
+func (s *StandaloneDatabase) infoServer(builder *strings.Builder) {
+	mode := "standalone"
+	if config.Properties.ClusterEnabled {
+		mode = "cluster"
+	}
+	now := time.Now()
+	uptime := int64(now.Sub(s.startTime).Seconds())
+	writeInfoField(builder, "redis_version", serverVersion)
+	writeInfoField(builder, "redis_mode", mode)
+	writeInfoField(builder, "os", runtime.GOOS+" "+runtime.GOARCH)
+	writeInfoField(builder, "arch_bits", strconv.IntSize)
+	writeInfoField(builder, "go_version", runtime.Version())
+	writeInfoField(builder, "process_id", os.Getpid())
+	writeInfoField(builder, "run_id", s.runID)
+	writeInfoField(builder, "tcp_port", config.Properties.Port)
+	writeInfoField(builder, "server_time_usec", now.UnixMicro())
+	writeInfoField(builder, "uptime_in_seconds", uptime)
+	writeInfoField(builder, "uptime_in_days", uptime/(24*3600))
+	writeInfoField(builder, "hz", int(time.Second/serverCronInterval))
+}
+
+// infoClients 客户端连接的信息
+func (s *StandaloneDatabase) infoClients(builder *strings.Builder) {
+	connected, maxInput, maxOutput := 0, 0, 0
+	if s.clients != nil {
+		connected = s.clients.ClientCount()
+		s.clients.ForEachClient(func(client resp.Connection) bool {
+			stats := client.GetStats()
+			maxInput = max(maxInput, stats.QueryBuf)
+			maxOutput = max(maxOutput, stats.OutputBuf)
+			return true
+		})
+	}
+	writeInfoField(builder, "connected_clients", connected)
+	writeInfoField(builder, "maxclients", config.Properties.MaxClients)
+	writeInfoField(builder, "client_recent_max_input_buffer", maxInput)
+	writeInfoField(builder, "client_recent_max_output_buffer", maxOutput)
+}
+
+// processRSS 进程的常驻内存，从 /proc/self/statm 读取，不支持的系统返回false
+func processRSS() (uint64, bool) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * uint64(os.Getpagesize()), true
+}
+
+// infoMemory 内存使用情况，使用go运行时的统计
+func (s *StandaloneDatabase) infoMemory(builder *strings.Builder) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	writeInfoField(builder, "used_memory", memStats.HeapAlloc)
+	writeInfoField(builder, "used_memory_human", bytesToHuman(memStats.HeapAlloc))
+	// 常驻内存只能从操作系统获取，go运行时向操作系统申请的内存不等于常驻内存，单独输出
+	if rss, ok := processRSS(); ok {
+		writeInfoField(builder, "used_memory_rss", rss)
+		writeInfoField(builder, "used_memory_rss_human", bytesToHuman(rss))
+	}
+	writeInfoField(builder, "used_memory_sys", memStats.Sys)
+	writeInfoField(builder, "used_memory_sys_human", bytesToHuman(memStats.Sys))
+	writeInfoField(builder, "total_allocated_bytes", memStats.TotalAlloc)
+	writeInfoField(builder, "gc_count", memStats.NumGC)
+	writeInfoField(builder, "maxmemory", 0)
+	writeInfoField(builder, "maxmemory_human", "0B")
+	writeInfoField(builder, "maxmemory_policy", "noeviction")
+	writeInfoField(builder, "mem_allocator", "go")
+}
+
+// infoPersistence rdb和aof持久化的状态
+func (s *StandaloneDatabase) infoPersistence(builder *strings.Builder) {
+	writeInfoField(builder, "loading", 0)
+	writeInfoField(builder, "rdb_changes_since_last_save", s.dirty.Load())
+	writeInfoField(builder, "rdb_bgsave_in_progress", boolToInt(s.saving.Load()))
+	writeInfoField(builder, "rdb_last_save_time", s.lastSave.Load())
+	saveStatus := "ok"
+	if !s.lastSaveOK.Load() {
+		saveStatus = "err"
+	}
+	writeInfoField(builder, "rdb_last_bgsave_status", saveStatus)
+	writeInfoField(builder, "aof_enabled", boolToInt(s.aofHandler != nil))
+	if s.aofHandler == nil {
+		writeInfoField(builder, "aof_rewrite_in_progress", 0)
+		return
+	}
+	writeInfoField(builder, "aof_rewrite_in_progress", boolToInt(s.aofHandler.IsRewriting()))
+	writeStatus := "ok"
+	writeErr := s.aofHandler.LastWriteError()
+	if writeErr != nil {
+		writeStatus = "err"
+	}
+	writeInfoField(builder, "aof_last_write_status", writeStatus)
+	if writeErr != nil {
+		writeInfoField(builder, "aof_last_write_error", strings.ReplaceAll(writeErr.Error(), "\n", " "))
+	}
+	writeInfoField(builder, "aof_current_size", s.aofHandler.FileSize())
+	writeInfoField(builder, "aof_base_size", s.aofHandler.BaseSize())
+	// 管道中等待写入文件的命令数
+	writeInfoField(builder, "aof_buffer_length", s.aofHandler.PendingCommands())
+	writeInfoField(builder, "aof_fsync_policy", s.aofHandler.FsyncPolicy())
+	writeInfoField(builder, "aof_pending_fsync_bytes", s.aofHandler.PendingBytes())
+	writeInfoField(builder, "aof_last_fsync_time", s.aofHandler.LastFsyncTime().Unix())
+}
+
+// infoStats 统计信息
+func (s *StandaloneDatabase) infoStats(builder *strings.Builder) {
+	accepted, rejected := int64(0), int64(0)
+	if s.clients != nil {
+		if stats := s.clients.ConnStats(); stats != nil {
+			accepted, rejected = stats.Accepted.Load(), stats.Rejected.Load()
+		}
+	}
+	writeInfoField(builder, "total_connections_received", accepted)
+	writeInfoField(builder, "total_commands_processed", s.totalCommands.Load())
+	writeInfoField(builder, "instantaneous_ops_per_sec", s.ops.opsPerSec())
+	writeInfoField(builder, "rejected_connections", rejected)
+	repl := s.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	writeInfoField(builder, "sync_full", repl.syncFull)
+	writeInfoField(builder, "sync_partial_ok", repl.syncPartialOK)
+	writeInfoField(builder, "sync_partial_err", repl.syncPartialErr)
+}
+
+// infoReplication 主从复制相关的信息
+func (s *StandaloneDatabase) infoReplication(builder *strings.Builder) {
+	repl := s.repl
+	if link := repl.master.Load(); link != nil {
+		writeInfoField(builder, "role", "slave")
+		writeInfoField(builder, "master_host", link.host)
+		writeInfoField(builder, "master_port", link.port)
+		state := link.getState()
+		linkStatus := "down"
+		if state == replStateConnected {
+			linkStatus = "up"
+		}
+		writeInfoField(builder, "master_link_status", linkStatus)
+		lastIO := int64(-1)
+		if state == replStateConnected {
+			lastIO = time.Now().Unix() - link.lastIO.Load()
+		}
+		writeInfoField(builder, "master_last_io_seconds_ago", lastIO)
+		syncing := 0
+		if state == replStateSync {
+			syncing = 1
+		}
+		writeInfoField(builder, "master_sync_in_progress", syncing)
+		repl.mu.Lock()
+		writeInfoField(builder, "slave_repl_offset", repl.offset)
+		repl.mu.Unlock()
+		writeInfoField(builder, "slave_read_only", 1)
+	} else {
+		writeInfoField(builder, "role", "master")
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	writeInfoField(builder, "connected_slaves", len(repl.replicas))
+	i := 0
+	for _, replica := range repl.replicas {
+		state := "wait_bgsave"
+		if replica.online.Load() {
+			state = "online"
+		}
+		lag := time.Now().Unix() - replica.lastAck.Load()
+		builder.WriteString(fmt.Sprintf("slave%d:ip=%s,port=%d,state=%s,offset=%d,lag=%d"+reply.CRLF,
+			i, replica.ip(), replica.listeningPort, state, replica.ackOffset.Load(), lag))
+		i++
+	}
+	writeInfoField(builder, "master_replid", repl.replID)
+	replID2 := repl.replID2
+	if replID2 == "" {
+		replID2 = strings.Repeat("0", replIDLength)
+	}
+	writeInfoField(builder, "master_replid2", replID2)
+	writeInfoField(builder, "master_repl_offset", repl.offset)
+	writeInfoField(builder, "second_repl_offset", repl.secondReplOffset)
+	if repl.backlog != nil {
+		writeInfoField(builder, "repl_backlog_active", 1)
+		writeInfoField(builder, "repl_backlog_size", len(repl.backlog.buf))
+		writeInfoField(builder, "repl_backlog_first_byte_offset", repl.backlog.offset)
+		writeInfoField(builder, "repl_backlog_histlen", repl.backlog.histLen)
+	} else {
+		writeInfoField(builder, "repl_backlog_active", 0)
+		writeInfoField(builder, "repl_backlog_size", repl.backlogSize)
+		writeInfoField(builder, "repl_backlog_first_byte_offset", 0)
+		writeInfoField(builder, "repl_backlog_histlen", 0)
+	}
+}
+
+// infoCluster 是否开启了哈希槽的集群模式
+func (s *StandaloneDatabase) infoCluster(builder *strings.Builder) {
+	writeInfoField(builder, "cluster_enabled", boolToInt(config.Properties.ClusterEnabled))
+}
+
+// infoKeyspace 每个db的key数量，只输出不为空的db
+func (s *StandaloneDatabase) infoKeyspace(builder *strings.Builder) {
+	for _, db := range s.dbSet {
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		expires, avgTTL := db.expiresStats()
+		builder.WriteString(fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=%d"+reply.CRLF, db.index, keys, expires, avgTTL))
+	}
+}
+
+// expiresStats 设置了过期时间的key的数量和平均剩余的过期时间，单位毫秒，已经过期但还没有删除的key不统计
+func (db *DB) expiresStats() (int, int64) {
+	now := time.Now()
+	count, total := 0, int64(0)
+	db.ttlMap.ForEach(func(key string, value interface{}) bool {
+		if ttl := value.(time.Time).Sub(now).Milliseconds(); ttl > 0 {
+			total += ttl
+			count++
+		}
+		return true
+	})
+	if count == 0 {
+		return 0, 0
+	}
+	return count, total / int64(count)
+}
+
+// execRole role，返回当前节点在主从复制中的角色
+func (s *StandaloneDatabase) execRole(args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("role")
+	}
+	repl := s.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if link := repl.master.Load(); link != nil {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("slave")),
+			reply.MakeBulkReply([]byte(link.host)),
+			reply.MakeIntReply(int64(link.port)),
+			reply.MakeBulkReply([]byte(link.getState())),
+			reply.MakeIntReply(repl.offset),
+		})
+	}
+	replicas := make([]resp.Reply, 0, len(repl.replicas))
+	for _, replica := range repl.replicas {
+		replicas = append(replicas, reply.MakeMultiBulkReply([][]byte{
+			[]byte(replica.ip()),
+			[]byte(strconv.Itoa(replica.listeningPort)),
+			[]byte(strconv.FormatInt(replica.ackOffset.Load(), 10)),
+		}))
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("master")),
+		reply.MakeIntReply(repl.offset),
+		reply.MakeMultiRawReply(replicas),
+	})
+}
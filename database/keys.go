@@ -1,10 +1,19 @@
 package database
 
 import (
+	"math"
+	"redis-go/constant"
+	"redis-go/datastruct/dict"
+	"redis-go/datastruct/list"
+	"redis-go/datastruct/set"
+	"redis-go/datastruct/sortedset"
 	"redis-go/interface/resp"
 	"redis-go/lib/utils"
 	"redis-go/lib/wildcard"
 	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // 实现redis的常见命令
@@ -44,14 +53,23 @@ func execFlushDB(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeOKReply()
 }
 
-// type 返回键对应的数据类型，这里暂时只返回string todo：完善这个
+// type 返回键对应的数据类型
 func execType(db *DB, args [][]byte) resp.Reply {
 	entity, b := db.GetEntity(string(args[0]))
 	if !b {
 		return reply.MakeStatusReply("none")
 	}
-	if _, ok := entity.Data.(string); ok {
+	switch entity.Data.(type) {
+	case []byte:
 		return reply.MakeStatusReply("string")
+	case list.List:
+		return reply.MakeStatusReply("list")
+	case dict.Dict:
+		return reply.MakeStatusReply("hash")
+	case *set.Set:
+		return reply.MakeStatusReply("set")
+	case *sortedset.SortedSet:
+		return reply.MakeStatusReply("zset")
 	}
 	return reply.MakeUnknownReply()
 }
@@ -66,8 +84,17 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !srcExist {
 		return reply.MakeStandardErrorReply("no such key")
 	}
+	if src == dst {
+		return reply.MakeOKReply()
+	}
+	// 过期时间跟随key一起转移，目标键原有的过期时间作废
+	expireTime, hasTTL := db.TTL(src)
+	db.Remove(dst)
 	db.PutEntity(dst, &srcEntity)
 	db.Remove(src)
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	}
 	db.addAof(utils.ToCmdLineWithName("RENAME", args...))
 	return reply.MakeOKReply()
 }
@@ -77,10 +104,10 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	dst := string(args[1])
 	//  检查目标键是否存在
 	_, dstExist := db.GetEntity(dst)
-	db.addAof(utils.ToCmdLineWithName("RENAMENX", args...))
 	if dstExist {
-		return reply.MakeStandardErrorReply("key already exists")
+		return reply.MakeStandardErrorReply(ErrKeyExists)
 	}
+	// 实际的改名操作由rename完成，aof中记录为rename命令即可
 	return execRename(db, args)
 }
 
@@ -89,7 +116,7 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0) // Store all matching keys
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		if pattern.IsMatch(key) && !db.IsExpired(key) {
 			result = append(result, []byte(key))
 		}
 		return true
@@ -97,12 +124,176 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(result)
 }
 
+// 过期相关命令选项
+const (
+	expireNX = 1 << iota // 仅当key没有过期时间时设置
+	expireXX             // 仅当key已有过期时间时设置
+	expireGT             // 仅当新的过期时间大于当前过期时间时设置
+	expireLT             // 仅当新的过期时间小于当前过期时间时设置
+)
+
+// makeExpireCmd 生成过期命令，aof中统一记录为绝对时间的pexpireat，保证回放时不会延长key的生命周期
+func makeExpireCmd(key string, expireTime time.Time) constant.CommandLine {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(expireTime.UnixMilli(), 10))
+}
+
+// parseExpireFlags 解析 NX|XX|GT|LT 选项
+func parseExpireFlags(args [][]byte) (int, resp.Reply) {
+	flags := 0
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			flags |= expireNX
+		case "XX":
+			flags |= expireXX
+		case "GT":
+			flags |= expireGT
+		case "LT":
+			flags |= expireLT
+		default:
+			return 0, reply.MakeStandardErrorReply("ERR Unsupported option " + string(arg))
+		}
+	}
+	if flags&expireNX > 0 && flags&(expireXX|expireGT|expireLT) > 0 {
+		return 0, reply.MakeStandardErrorReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT > 0 && flags&expireLT > 0 {
+		return 0, reply.MakeStandardErrorReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// expireGeneric expire系列命令的通用实现
+// unit 为参数的时间单位，absolute 表示参数是否为unix时间戳
+func expireGeneric(db *DB, cmdName string, args [][]byte, unit time.Duration, absolute bool) resp.Reply {
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	// 统一换算成毫秒，防止溢出
+	factor := int64(unit / time.Millisecond)
+	if raw > math.MaxInt64/factor || raw < math.MinInt64/factor {
+		return reply.MakeStandardErrorReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	ms := raw * factor
+	expireTime := time.UnixMilli(ms)
+	if !absolute {
+		var ok bool
+		if expireTime, ok = relativeExpireTime(ms); !ok {
+			return reply.MakeStandardErrorReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+	}
+	flags, errReply := parseExpireFlags(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	// 选项校验，没有过期时间的key视为永不过期
+	currTime, hasTTL := db.TTL(key)
+	switch {
+	case flags&expireNX > 0 && hasTTL,
+		flags&expireXX > 0 && !hasTTL,
+		flags&expireGT > 0 && (!hasTTL || !expireTime.After(currTime)),
+		flags&expireLT > 0 && hasTTL && !expireTime.Before(currTime):
+		return reply.MakeIntReply(0)
+	}
+	// 过期时间已经过去，直接删除key
+	if !expireTime.After(time.Now()) {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("DEL", key))
+		return reply.MakeIntReply(1)
+	}
+	db.Expire(key, expireTime)
+	db.addAof(makeExpireCmd(key, expireTime))
+	return reply.MakeIntReply(1)
+}
+
+// relativeExpireTime 当前时间之后 ms 毫秒的过期时间，换算成unix毫秒时间戳溢出时返回false
+func relativeExpireTime(ms int64) (time.Time, bool) {
+	now := time.Now().UnixMilli()
+	if ms > math.MaxInt64-now {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(now + ms), true
+}
+
+// expire key seconds [NX|XX|GT|LT]
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	return expireGeneric(db, "expire", args, time.Second, false)
+}
+
+// pexpire key milliseconds [NX|XX|GT|LT]
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	return expireGeneric(db, "pexpire", args, time.Millisecond, false)
+}
+
+// expireat key unix-time-seconds [NX|XX|GT|LT]
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	return expireGeneric(db, "expireat", args, time.Second, true)
+}
+
+// pexpireat key unix-time-milliseconds [NX|XX|GT|LT]
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	return expireGeneric(db, "pexpireat", args, time.Millisecond, true)
+}
+
+// ttlGeneric ttl系列命令的通用实现，key不存在返回-2，没有过期时间返回-1
+func ttlGeneric(db *DB, args [][]byte, unit time.Duration) resp.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.TTL(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	remain := time.Until(expireTime)
+	if remain < 0 {
+		remain = 0
+	}
+	// 四舍五入，和redis的返回保持一致
+	return reply.MakeIntReply(int64((remain + unit/2) / unit))
+}
+
+// ttl key 返回剩余秒数
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	return ttlGeneric(db, args, time.Second)
+}
+
+// pttl key 返回剩余毫秒数
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	return ttlGeneric(db, args, time.Millisecond)
+}
+
+// persist key 移除过期时间
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	if db.Persist(key) == 0 {
+		return reply.MakeIntReply(0)
+	}
+	db.addAof(utils.ToCmdLineWithName("PERSIST", args...))
+	return reply.MakeIntReply(1)
+}
+
 func init() {
-	RegisterCommand("del", execDel, -1)
-	RegisterCommand("exists", execExists, -1)
-	RegisterCommand("flush", execFlushDB, 0)
-	RegisterCommand("type", execType, 1)
-	RegisterCommand("rename", execRename, 2)
-	RegisterCommand("renamenx", execRenameNx, 2)
-	RegisterCommand("keys", execKeys, 1)
+	RegisterCommand("del", execDel, -1, WithPrepare(writeAllKeys), WithCategories(catKeyspace))
+	RegisterCommand("exists", execExists, -1, WithPrepare(readAllKeys), WithCategories(catKeyspace))
+	RegisterCommand("flush", execFlushDB, 0, WithCategories(catKeyspace, catWrite, catDangerous))
+	RegisterCommand("type", execType, 1, WithPrepare(readFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("rename", execRename, 2, WithPrepare(writeAllKeys), WithCategories(catKeyspace))
+	RegisterCommand("renamenx", execRenameNx, 2, WithPrepare(writeAllKeys), WithCategories(catKeyspace))
+	RegisterCommand("keys", execKeys, 1, WithCategories(catKeyspace, catRead, catDangerous))
+	RegisterCommand("expire", execExpire, -2, WithPrepare(writeFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("pexpire", execPExpire, -2, WithPrepare(writeFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("expireat", execExpireAt, -2, WithPrepare(writeFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("pexpireat", execPExpireAt, -2, WithPrepare(writeFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("ttl", execTTL, 1, WithPrepare(readFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("pttl", execPTTL, 1, WithPrepare(readFirstKey), WithCategories(catKeyspace))
+	RegisterCommand("persist", execPersist, 1, WithPrepare(writeFirstKey), WithCategories(catKeyspace))
 }
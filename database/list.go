@@ -0,0 +1,388 @@
+package database
+
+import (
+	"bytes"
+	"redis-go/datastruct/list"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// list 命令实现，包含lpush，rpush，lpop，rpop，lrange等命令
+
+// getAsList 获取列表类型的值，key不存在返回nil，类型不匹配返回类型错误
+func (db *DB) getAsList(key string) (list.List, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	l, ok := entity.Data.(list.List)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return l, nil
+}
+
+// getOrInitList 获取列表，key不存在时创建一个新的列表
+func (db *DB) getOrInitList(key string) (l list.List, isNew bool, errReply reply.ErrorReply) {
+	l, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if l == nil {
+		l = list.MakeQuickList()
+		db.PutEntity(key, &database.DataEntity{Data: l})
+		isNew = true
+	}
+	return l, isNew, nil
+}
+
+// expectedValue 生成按值比较的匹配方法
+func expectedValue(val []byte) list.Expected {
+	return func(a interface{}) bool {
+		return bytes.Equal(a.([]byte), val)
+	}
+}
+
+// normalizeRange 将redis风格的闭区间 [start, stop]（支持负数下标）转换为 [start, stop) 的合法区间
+// 返回的区间为空时 start == stop
+func normalizeRange(start, stop int64, size int) (int, int) {
+	length := int64(size)
+	if start < 0 {
+		start = length + start
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	// 先限制在 [0, length-1] 内再转换为开区间，防止 stop 为最大值时加一溢出
+	if stop >= length {
+		stop = length - 1
+	}
+	if start >= length || stop < start {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+// pushGeneric lpush/rpush 的通用实现，onlyExists 表示仅当列表存在时写入(lpushx/rpushx)
+func pushGeneric(db *DB, cmdName string, args [][]byte, left bool, onlyExists bool) resp.Reply {
+	key := string(args[0])
+	var l list.List
+	if onlyExists {
+		var errReply reply.ErrorReply
+		l, errReply = db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if l == nil {
+			return reply.MakeIntReply(0)
+		}
+	} else {
+		var errReply reply.ErrorReply
+		l, _, errReply = db.getOrInitList(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	for _, value := range args[1:] {
+		if left {
+			l.AddFirst(value)
+		} else {
+			l.Add(value)
+		}
+	}
+	db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// lpush key element [element ...]
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	return pushGeneric(db, "LPUSH", args, true, false)
+}
+
+// rpush key element [element ...]
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	return pushGeneric(db, "RPUSH", args, false, false)
+}
+
+// lpushx key element [element ...]，仅当列表存在时插入
+func execLPushX(db *DB, args [][]byte) resp.Reply {
+	return pushGeneric(db, "LPUSHX", args, true, true)
+}
+
+// rpushx key element [element ...]，仅当列表存在时插入
+func execRPushX(db *DB, args [][]byte) resp.Reply {
+	return pushGeneric(db, "RPUSHX", args, false, true)
+}
+
+// popGeneric lpop/rpop 的通用实现
+func popGeneric(db *DB, cmdName string, args [][]byte, left bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeArgNumErrReply(strings.ToLower(cmdName))
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := 1
+	if withCount {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+		count = int(n)
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		if withCount {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	// count 由客户端指定，按照列表的实际长度分配空间
+	values := make([][]byte, 0, min(count, l.Len()))
+	for i := 0; i < count && l.Len() > 0; i++ {
+		var val interface{}
+		if left {
+			val = l.RemoveFirst()
+		} else {
+			val = l.RemoveLast()
+		}
+		values = append(values, val.([]byte))
+	}
+	// 列表为空时删除key
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(values) > 0 {
+		db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	}
+	if withCount {
+		return reply.MakeMultiBulkReply(values)
+	}
+	return reply.MakeBulkReply(values[0])
+}
+
+// lpop key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return popGeneric(db, "LPOP", args, true)
+}
+
+// rpop key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return popGeneric(db, "RPOP", args, false)
+}
+
+// llen key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// lrange key start stop
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	begin, end := normalizeRange(start, stop, l.Len())
+	if begin == end {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	slice := l.Range(begin, end)
+	result := make([][]byte, len(slice))
+	for i, val := range slice {
+		result[i] = val.([]byte)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// lindex key index
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeNullBulkReply()
+	}
+	size := int64(l.Len())
+	if index < 0 {
+		index = size + index
+	}
+	if index < 0 || index >= size {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(l.Get(int(index)).([]byte))
+}
+
+// lset key index element
+func execLSet(db *DB, args [][]byte) resp.Reply {
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeStandardErrorReply("ERR no such key")
+	}
+	size := int64(l.Len())
+	if index < 0 {
+		index = size + index
+	}
+	if index < 0 || index >= size {
+		return reply.MakeStandardErrorReply("ERR index out of range")
+	}
+	l.Set(int(index), args[2])
+	db.addAof(utils.ToCmdLineWithName("LSET", args...))
+	return reply.MakeOKReply()
+}
+
+// lrem key count element
+// count > 0 从头部开始删除count个，count < 0 从尾部开始删除|count|个，count = 0 删除全部
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	var removed int
+	expected := expectedValue(args[2])
+	switch {
+	case count == 0:
+		removed = l.RemoveAllByVal(expected)
+	case count > 0:
+		removed = l.RemoveByVal(expected, int(count))
+	default:
+		removed = l.ReverseRemoveByVal(expected, int(-count))
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLineWithName("LREM", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// ltrim key start stop，只保留区间内的元素
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeOKReply()
+	}
+	begin, end := normalizeRange(start, stop, l.Len())
+	if begin == end {
+		// 区间为空，整个列表都会被删除
+		db.Remove(key)
+	} else {
+		tail := l.Len() - end
+		for i := 0; i < begin; i++ {
+			l.RemoveFirst()
+		}
+		for i := 0; i < tail; i++ {
+			l.RemoveLast()
+		}
+	}
+	db.addAof(utils.ToCmdLineWithName("LTRIM", args...))
+	return reply.MakeOKReply()
+}
+
+// linsert key BEFORE|AFTER pivot element
+// 返回插入后列表的长度，pivot不存在返回-1，key不存在返回0
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var before bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	index := l.IndexOf(expectedValue(args[2]))
+	if index < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if !before {
+		index++
+	}
+	l.Insert(index, args[3])
+	db.addAof(utils.ToCmdLineWithName("LINSERT", args...))
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+func init() {
+	RegisterCommand("lpush", execLPush, -2, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("rpush", execRPush, -2, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("lpushx", execLPushX, -2, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("rpushx", execRPushX, -2, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("lpop", execLPop, -1, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("rpop", execRPop, -1, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("llen", execLLen, 1, WithPrepare(readFirstKey), WithCategories(catList))
+	RegisterCommand("lrange", execLRange, 3, WithPrepare(readFirstKey), WithCategories(catList))
+	RegisterCommand("lindex", execLIndex, 2, WithPrepare(readFirstKey), WithCategories(catList))
+	RegisterCommand("lset", execLSet, 3, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("lrem", execLRem, 3, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("ltrim", execLTrim, 3, WithPrepare(writeFirstKey), WithCategories(catList))
+	RegisterCommand("linsert", execLInsert, 4, WithPrepare(writeFirstKey), WithCategories(catList))
+}
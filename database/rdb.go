@@ -0,0 +1,262 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/rdb"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rdb快照的保存和加载，包含save，bgsave，lastsave命令
+
+const defaultDbFilename = "dump.rdb"
+
+var errSaveInProgress = errors.New("ERR Background save already in progress")
+
+// saveParam 自动保存规则，seconds 秒内至少发生 changes 次写入时触发保存
+type saveParam struct {
+	seconds int64
+	changes int64
+}
+
+// parseSaveParams 解析 "<seconds> <changes> [<seconds> <changes> ...]" 格式的自动保存规则
+func parseSaveParams(raw string) []saveParam {
+	fields := strings.Fields(raw)
+	if len(fields)%2 != 0 {
+		logger.Error("[rdb] invalid save config: " + raw)
+		return nil
+	}
+	params := make([]saveParam, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes <= 0 {
+			logger.Error("[rdb] invalid save config: " + raw)
+			return nil
+		}
+		params = append(params, saveParam{seconds: seconds, changes: changes})
+	}
+	return params
+}
+
+// rdbFilename rdb文件名，未配置时使用 dump.rdb
+func rdbFilename() string {
+	if config.Properties.DbFilename == "" {
+		return defaultDbFilename
+	}
+	return config.Properties.DbFilename
+}
+
+// loadRDB 启动时加载rdb文件，文件不存在时跳过
+func (s *StandaloneDatabase) loadRDB() {
+	data, err := os.ReadFile(rdbFilename())
+	if err != nil {
+		logger.Info("[load rdb file] the rdb file is not exist or open error", err)
+		return
+	}
+	if _, err := s.LoadSnapshot(data); err != nil {
+		logger.Error("[load rdb file] load rdb file failed", err)
+		panic("fatal error")
+	}
+	logger.Info("[load rdb file] load rdb file success")
+}
+
+// LoadSnapshot 将rdb数据加载到内存中，已经过期的key会被跳过，返回rdb数据的长度
+func (s *StandaloneDatabase) LoadSnapshot(data []byte) (int, error) {
+	return rdb.Parse(data, s.loadEntry)
+}
+
+// LoadSnapshotFrom 从reader中流式加载rdb数据，返回rdb数据的长度
+// 混合格式的aof文件中rdb数据后面还跟着resp格式的命令，可以继续从reader中读取
+func (s *StandaloneDatabase) LoadSnapshotFrom(reader *bufio.Reader) (int64, error) {
+	return rdb.ParseReader(reader, s.loadEntry)
+}
+
+// loadEntry 加载rdb中的一个键值对，已经过期的key会被跳过
+func (s *StandaloneDatabase) loadEntry(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) bool {
+	if dbIndex < 0 || dbIndex >= len(s.dbSet) {
+		logger.Error("[load rdb file] db index out of range: " + strconv.Itoa(dbIndex))
+		return true
+	}
+	if expiration != nil && time.Now().After(*expiration) {
+		return true
+	}
+	db := s.dbSet[dbIndex]
+	db.addVersion(key)
+	db.PutEntity(key, entity)
+	if expiration != nil {
+		db.Expire(key, *expiration)
+	}
+	return true
+}
+
+// dumpSnapshot 将分界点时所有db中的数据编码为rdb格式，mark 在分界点执行
+func (s *StandaloneDatabase) dumpSnapshot(mark func() error) ([]byte, error) {
+	// 不同db中的key可能被并发写入快照，每个db使用单独的编码器，最后再合并
+	dbBufs := make([]*bytes.Buffer, len(s.dbSet))
+	dbEncs := make([]*rdb.Encoder, len(s.dbSet))
+	for i := range s.dbSet {
+		dbBufs[i] = &bytes.Buffer{}
+		dbEncs[i] = rdb.NewEncoder(dbBufs[i])
+	}
+	err := s.takeSnapshot(mark, func(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) error {
+		return dbEncs[dbIndex].WriteEntry(key, entity, expiration)
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	enc := rdb.NewEncoder(buf)
+	if err := enc.WriteHeader(); err != nil {
+		return nil, err
+	}
+	for i, db := range s.dbSet {
+		if err := dbEncs[i].Flush(); err != nil {
+			return nil, err
+		}
+		if dbBufs[i].Len() == 0 {
+			continue
+		}
+		if err := enc.WriteDBHeader(db.index); err != nil {
+			return nil, err
+		}
+		if err := enc.WriteRaw(dbBufs[i].Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic 先写入临时文件再重命名，保证任何时候文件都是完整的
+func writeFileAtomic(filename string, data []byte) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmpFile, err := os.CreateTemp(dir, base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// save 保存快照，只在标记分界点时暂停命令的执行，background 为true时在后台生成快照并写入文件
+func (s *StandaloneDatabase) save(background bool) error {
+	if !s.saveMu.TryLock() {
+		return errSaveInProgress
+	}
+	s.saving.Store(true)
+	finish := func() error {
+		defer func() {
+			s.saving.Store(false)
+			s.saveMu.Unlock()
+		}()
+		// 分界点之后的写入不包含在快照中，保存成功后只扣除分界点之前的写入次数
+		var dirty int64
+		data, err := s.dumpSnapshot(func() error {
+			dirty = s.dirty.Load()
+			return nil
+		})
+		if err == nil {
+			err = writeFileAtomic(rdbFilename(), data)
+		}
+		s.lastSaveOK.Store(err == nil)
+		if err != nil {
+			logger.Error("[rdb] save rdb file failed", err)
+			return err
+		}
+		s.dirty.Add(-dirty)
+		s.lastSave.Store(time.Now().Unix())
+		logger.Info("[rdb] save rdb file success")
+		return nil
+	}
+	if background {
+		go finish()
+		return nil
+	}
+	return finish()
+}
+
+// bgSave 在后台保存快照，只记录错误日志
+func (s *StandaloneDatabase) bgSave() {
+	if err := s.save(true); err != nil && err != errSaveInProgress {
+		logger.Error("[rdb] bgsave failed", err)
+	}
+}
+
+// needSave 判断是否满足自动保存规则
+func (s *StandaloneDatabase) needSave() bool {
+	if s.saving.Load() {
+		return false
+	}
+	dirty := s.dirty.Load()
+	elapsed := time.Now().Unix() - s.lastSave.Load()
+	for _, param := range s.saveParams {
+		if dirty >= param.changes && elapsed >= param.seconds {
+			return true
+		}
+	}
+	return false
+}
+
+// execSave save，阻塞保存快照
+func (s *StandaloneDatabase) execSave(args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("save")
+	}
+	if err := s.save(false); err != nil {
+		return makeSaveErrReply(err)
+	}
+	return reply.MakeOKReply()
+}
+
+// execBGSave bgsave，在后台保存快照
+func (s *StandaloneDatabase) execBGSave(args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("bgsave")
+	}
+	if err := s.save(true); err != nil {
+		return makeSaveErrReply(err)
+	}
+	return reply.MakeStatusReply("Background saving started")
+}
+
+func makeSaveErrReply(err error) resp.Reply {
+	if err == errSaveInProgress {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	return reply.MakeStandardErrorReply("ERR " + err.Error())
+}
+
+// execLastSave lastsave，返回上一次成功保存快照的时间
+func (s *StandaloneDatabase) execLastSave(args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("lastsave")
+	}
+	return reply.MakeIntReply(s.lastSave.Load())
+}
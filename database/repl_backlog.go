@@ -0,0 +1,63 @@
+package database
+
+// replBacklog 复制积压缓冲区，环形保存最近转发给从节点的命令流
+// 从节点断线重连后，如果请求的偏移量仍然在缓冲区中，只需要补发缺失的部分，不需要重新全量同步
+// 偏移量和redis保持一致，第一个字节的偏移量为1
+type replBacklog struct {
+	buf     []byte
+	idx     int   // 下一次写入的位置
+	histLen int64 // 缓冲区中有效数据的长度
+	offset  int64 // 缓冲区中第一个字节的复制偏移量
+}
+
+// makeReplBacklog 创建积压缓冲区，masterOffset 为当前的复制偏移量，之后写入的第一个字节的偏移量为 masterOffset+1
+func makeReplBacklog(size int, masterOffset int64) *replBacklog {
+	return &replBacklog{
+		buf:    make([]byte, size),
+		offset: masterOffset + 1,
+	}
+}
+
+// write 写入命令流，超出容量时覆盖最早的数据
+func (b *replBacklog) write(data []byte) {
+	size := len(b.buf)
+	// 只保留最后 size 个字节
+	if len(data) > size {
+		b.offset += b.histLen + int64(len(data)-size)
+		b.histLen = 0
+		data = data[len(data)-size:]
+	}
+	for len(data) > 0 {
+		n := copy(b.buf[b.idx:], data)
+		b.idx = (b.idx + n) % size
+		data = data[n:]
+		b.histLen += int64(n)
+	}
+	if b.histLen > int64(size) {
+		b.offset += b.histLen - int64(size)
+		b.histLen = int64(size)
+	}
+}
+
+// contains 判断从 offset 开始的命令流是否都在缓冲区中，offset 为当前偏移量+1时表示没有缺失的数据
+func (b *replBacklog) contains(offset int64) bool {
+	return offset >= b.offset && offset <= b.offset+b.histLen
+}
+
+// readFrom 读取从 offset 开始到最新的命令流，调用方需要先通过 contains 检查
+func (b *replBacklog) readFrom(offset int64) []byte {
+	skip := offset - b.offset
+	length := int(b.histLen - skip)
+	result := make([]byte, 0, length)
+	size := len(b.buf)
+	// 缓冲区中最早的数据所在的位置
+	start := (b.idx - int(b.histLen) + size) % size
+	pos := (start + int(skip)) % size
+	for length > 0 {
+		n := min(length, size-pos)
+		result = append(result, b.buf[pos:pos+n]...)
+		pos = (pos + n) % size
+		length -= n
+	}
+	return result
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"redis-go/aof"
+	"redis-go/config"
+	"redis-go/constant"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 主从复制的从节点部分
+// 执行 replicaof 后在后台连接主节点，握手之后使用当前的复制id和偏移量发送 psync 请求，
+// 主节点回复 +CONTINUE 时直接接收缺失的命令流，回复 +FULLRESYNC 时先加载主节点发送的rdb快照，
+// 之后持续接收并执行主节点转发的写入命令，连接断开后会自动重连并尝试部分同步
+
+const (
+	replConnectTimeout = 5 * time.Second
+	replTimeout        = 60 * time.Second // 超过这个时间没有收到主节点的数据时认为连接已经断开
+	replRetryInterval  = time.Second      // 连接断开后重连的间隔
+	replAckPeriod      = time.Second      // 向主节点确认复制偏移量的间隔
+)
+
+// 从节点和主节点之间连接的状态，和redis的 ROLE 命令保持一致
+const (
+	replStateConnect    = "connect"    // 等待连接
+	replStateConnecting = "connecting" // 正在连接和握手
+	replStateSync       = "sync"       // 正在接收快照
+	replStateConnected  = "connected"  // 正在接收命令流
+)
+
+var errLinkStopped = errors.New("replication link stopped")
+
+// masterLink 从节点到主节点的连接
+type masterLink struct {
+	host string
+	port int
+
+	state  atomic.Value // 连接状态
+	lastIO atomic.Int64 // 上一次收到主节点数据的时间，unix秒
+
+	mu       sync.Mutex
+	conn     net.Conn
+	ctx      context.Context // 停止复制时取消
+	cancel   context.CancelFunc
+	finished chan struct{} // 处理连接的协程退出的通知
+}
+
+func makeMasterLink(host string, port int) *masterLink {
+	link := &masterLink{
+		host:     host,
+		port:     port,
+		finished: make(chan struct{}),
+	}
+	link.ctx, link.cancel = context.WithCancel(context.Background())
+	link.state.Store(replStateConnect)
+	return link
+}
+
+func (link *masterLink) getState() string {
+	return link.state.Load().(string)
+}
+
+func (link *masterLink) addr() string {
+	return net.JoinHostPort(link.host, strconv.Itoa(link.port))
+}
+
+// setConn 记录当前的网络连接，连接已经被停止时返回false
+func (link *masterLink) setConn(conn net.Conn) bool {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.stopped() {
+		return false
+	}
+	link.conn = conn
+	return true
+}
+
+// stop 停止复制，断开和主节点的连接
+func (link *masterLink) stop() {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	link.cancel()
+	if link.conn != nil {
+		_ = link.conn.Close()
+	}
+}
+
+func (link *masterLink) stopped() bool {
+	return link.ctx.Err() != nil
+}
+
+// timeoutReader 每次读取前设置超时时间，长时间收不到主节点的数据时读取失败
+type timeoutReader struct {
+	conn net.Conn
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	_ = r.conn.SetReadDeadline(time.Now().Add(replTimeout))
+	return r.conn.Read(p)
+}
+
+// runMasterLink 和主节点保持同步，连接断开后自动重连
+func (s *StandaloneDatabase) runMasterLink(link *masterLink) {
+	defer close(link.finished)
+	for {
+		err := s.syncWithMaster(link)
+		if link.stopped() {
+			return
+		}
+		logger.Error("[replication] connection with master "+link.addr()+" lost", err)
+		link.state.Store(replStateConnect)
+		select {
+		case <-link.ctx.Done():
+			return
+		case <-time.After(replRetryInterval):
+		}
+	}
+}
+
+// syncWithMaster 连接主节点，完成握手和全量同步后持续执行主节点转发的命令，直到连接断开
+func (s *StandaloneDatabase) syncWithMaster(link *masterLink) error {
+	link.state.Store(replStateConnecting)
+	dialer := &net.Dialer{Timeout: replConnectTimeout}
+	conn, err := dialer.DialContext(link.ctx, "tcp", link.addr())
+	if err != nil {
+		return err
+	}
+	if !link.setConn(conn) {
+		_ = conn.Close()
+		return errLinkStopped
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(&timeoutReader{conn: conn})
+
+	// 1. 握手，主节点需要密码时先认证，确认主节点可用并上报自己的端口
+	if config.Properties.MasterAuth != "" {
+		authArgs := []string{"AUTH", config.Properties.MasterAuth}
+		if config.Properties.MasterUser != "" {
+			authArgs = []string{"AUTH", config.Properties.MasterUser, config.Properties.MasterAuth}
+		}
+		if _, err := sendReplCommand(conn, reader, authArgs...); err != nil {
+			return err
+		}
+	}
+	if _, err := sendReplCommand(conn, reader, "PING"); err != nil {
+		return err
+	}
+	if _, err := sendReplCommand(conn, reader, "REPLCONF", "listening-port", strconv.Itoa(config.Properties.Port)); err != nil {
+		return err
+	}
+	// 2. 使用当前的复制id和偏移量请求部分同步，主节点无法部分同步时回复 +FULLRESYNC <replid> <offset>
+	repl := s.repl
+	repl.mu.Lock()
+	psyncID, psyncOffset := repl.replID, repl.offset+1
+	repl.mu.Unlock()
+	line, err := sendReplCommand(conn, reader, "PSYNC", psyncID, strconv.FormatInt(psyncOffset, 10))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return errors.New("unexpected reply to PSYNC: " + line)
+		}
+		// 3. 接收并加载快照
+		link.state.Store(replStateSync)
+		snapshot, err := readSnapshot(reader)
+		if err != nil {
+			return err
+		}
+		if err := s.loadFromMaster(snapshot, fields[1], offset); err != nil {
+			return err
+		}
+		logger.Info("[replication] full resync with master " + link.addr() + " finished")
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		// 主节点已经切换了复制id(如发生了故障转移)，之后使用新的复制id
+		repl.mu.Lock()
+		if len(fields) == 2 && fields[1] != repl.replID {
+			repl.shiftReplIDLocked(fields[1])
+		}
+		repl.mu.Unlock()
+		logger.Info("[replication] partial resync with master " + link.addr() + " from offset " + strconv.FormatInt(psyncOffset, 10))
+	default:
+		return errors.New("unexpected reply to PSYNC: " + line)
+	}
+	link.state.Store(replStateConnected)
+	link.lastIO.Store(time.Now().Unix())
+
+	// 4. 定期确认复制偏移量，同时执行主节点转发的命令
+	done := make(chan struct{})
+	defer close(done)
+	go s.sendAcks(conn, done)
+	repl.mu.Lock()
+	offset := repl.offset
+	repl.mu.Unlock()
+	_, err = aof.ReadCommands(reader, offset, func(cmd constant.CommandLine, end int64) bool {
+		link.lastIO.Store(time.Now().Unix())
+		s.Exec(repl.masterClient, cmd)
+		repl.appendFromMaster(reply.MakeMultiBulkReply(cmd).ToBytes(), end)
+		return !link.stopped()
+	})
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+// sendReplCommand 发送握手命令并读取单行回复
+func sendReplCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	if _, err := conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes()); err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, reply.CRLF)
+	if strings.HasPrefix(line, "-") {
+		return "", errors.New("master replied to " + args[0] + ": " + line[1:])
+	}
+	return strings.TrimPrefix(line, "+"), nil
+}
+
+// readSnapshot 读取主节点发送的快照，格式为 $<len>\r\n<rdb数据>，数据后面没有\r\n
+func readSnapshot(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, reply.CRLF)
+	if !strings.HasPrefix(line, "$") {
+		return nil, errors.New("unexpected snapshot header: " + line)
+	}
+	size, err := strconv.Atoi(line[1:])
+	if err != nil || size < 0 {
+		return nil, errors.New("unexpected snapshot header: " + line)
+	}
+	snapshot := make([]byte, size)
+	if _, err := io.ReadFull(reader, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// loadFromMaster 清空当前的数据并加载主节点的快照，复制id和偏移量和主节点保持一致
+func (s *StandaloneDatabase) loadFromMaster(snapshot []byte, replID string, offset int64) error {
+	s.pauseMu.Lock()
+	for _, db := range s.dbSet {
+		db.Flush()
+	}
+	_, err := s.LoadSnapshot(snapshot)
+	if err == nil {
+		repl := s.repl
+		repl.mu.Lock()
+		repl.replID = replID
+		repl.replID2 = ""
+		repl.secondReplOffset = -1
+		repl.offset = offset
+		repl.backlog = makeReplBacklog(repl.backlogSize, offset)
+		repl.mu.Unlock()
+		// 命令流从快照之后开始，事务和选择的db都需要重置
+		repl.masterClient.SelectDB(0)
+		repl.masterClient.SetMultiState(false)
+	}
+	s.pauseMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// 数据被整体替换，aof文件需要重写才能和内存中的数据一致
+	if s.aofHandler != nil {
+		go s.bgRewriteAof()
+	}
+	return nil
+}
+
+// sendAcks 定期向主节点确认复制偏移量
+func (s *StandaloneDatabase) sendAcks(conn net.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(replAckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.repl.mu.Lock()
+			offset := s.repl.offset
+			s.repl.mu.Unlock()
+			ack := utils.ToCmdLine("REPLCONF", "ACK", strconv.FormatInt(offset, 10))
+			if _, err := conn.Write(reply.MakeMultiBulkReply(ack).ToBytes()); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// execReplicaOf replicaof host port / replicaof no one
+func (s *StandaloneDatabase) execReplicaOf(cmdName string, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	repl := s.repl
+	if strings.EqualFold(string(args[0]), "no") && strings.EqualFold(string(args[1]), "one") {
+		link := repl.master.Swap(nil)
+		if link != nil {
+			link.stop()
+			<-link.finished
+			// 成为主节点，使用新的复制id，原来的从节点仍然可以使用旧的复制id进行部分同步
+			repl.mu.Lock()
+			repl.shiftReplIDLocked(newReplID())
+			repl.replDB = -1
+			repl.mu.Unlock()
+			logger.Info("[replication] promoted to master")
+		}
+		return reply.MakeOKReply()
+	}
+	host := string(args[0])
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return reply.MakeStandardErrorReply("ERR Invalid master port")
+	}
+	if link := repl.master.Load(); link != nil && link.host == host && link.port == port {
+		return reply.MakeStatusReply("OK Already connected to specified master")
+	}
+	link := makeMasterLink(host, port)
+	if old := repl.master.Swap(link); old != nil {
+		old.stop()
+		<-old.finished
+	}
+	// 当前节点的数据将被替换，原有的从节点需要重新同步
+	s.disconnectReplicas()
+	logger.Info("[replication] start replicating from master " + link.addr())
+	go s.runMasterLink(link)
+	return reply.MakeOKReply()
+}
+
+// isReadOnly 从节点只接受主节点转发的写入命令
+func (s *StandaloneDatabase) isReadOnly(client resp.Connection) bool {
+	return s.repl.master.Load() != nil && client != resp.Connection(s.repl.masterClient)
+}
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"redis-go/constant"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"redis-go/resp/reply"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 主从复制的主节点部分
+// 从节点发送 sync/psync 后，主节点在暂停命令执行的情况下生成rdb快照，并从这一刻开始把写入命令转发给从节点
+// 写入命令和aof共用 afterWrite 入口，按照和aof相同的格式编码成命令流，命令流的总字节数即为复制偏移量
+// 命令流同时写入积压缓冲区，从节点断线重连时如果请求的偏移量仍然在缓冲区中，只补发缺失的部分
+
+const (
+	replPingPeriod         = 10 * time.Second // 主节点向从节点发送ping的间隔，从节点依靠它判断连接是否存活
+	replIDLength           = 40
+	defaultReplBacklogSize = 1 << 20
+	// 从节点输出缓冲区的默认上限，和redis的 client-output-buffer-limit replica 的硬限制一致
+	defaultReplicaOutputBufferLimit = 256 << 20
+)
+
+// replicaClient 连接到当前节点的从节点
+type replicaClient struct {
+	conn          resp.Connection
+	listeningPort int          // 从节点通过 replconf listening-port 上报的端口
+	online        atomic.Bool  // 快照是否已经发送完成
+	ackOffset     atomic.Int64 // 从节点确认的复制偏移量
+	lastAck       atomic.Int64 // 上一次收到确认的时间，unix秒
+
+	mu          sync.Mutex
+	pending     []byte        // 等待发送的命令流
+	bufferLimit int           // pending 的最大字节数，超过时断开从节点
+	notify      chan struct{} // 有新的命令流需要发送
+	closed      chan struct{}
+	once        sync.Once
+}
+
+// replicationState 主从复制的状态
+type replicationState struct {
+	mu     sync.Mutex
+	replID string // 复制id，从节点会继承主节点的复制id
+	// 上一个主节点的复制id，从节点提升为主节点后，原来的其他从节点仍然可以使用它进行部分同步
+	replID2          string
+	secondReplOffset int64 // replID2 可以接受的最大偏移量，为-1时 replID2 无效
+	offset           int64 // 复制偏移量，从节点为已经处理的主节点命令流的偏移量
+	backlog          *replBacklog
+	backlogSize      int
+	bufferLimit      int                                // 从节点输出缓冲区的上限
+	replDB           int                                // 命令流当前所在的db
+	replicas         map[resp.Connection]*replicaClient // 连接到当前节点的从节点
+	ports            map[resp.Connection]int            // 从节点在同步之前上报的端口
+	lastPing         time.Time
+
+	// 同步次数的统计
+	syncFull       int64 // 全量同步的次数
+	syncPartialOK  int64 // 部分同步成功的次数
+	syncPartialErr int64 // 请求部分同步但只能全量同步的次数
+
+	master atomic.Pointer[masterLink] // 不为nil时当前节点为从节点
+	// 执行主节点转发的命令时使用的连接，不受只读限制，切换主节点后部分同步时需要保留选择的db
+	masterClient *connection.Connection
+}
+
+func makeReplicationState(backlogSize, bufferLimit int) *replicationState {
+	if backlogSize <= 0 {
+		backlogSize = defaultReplBacklogSize
+	}
+	if bufferLimit <= 0 {
+		bufferLimit = defaultReplicaOutputBufferLimit
+	}
+	return &replicationState{
+		replID:           newReplID(),
+		secondReplOffset: -1,
+		backlogSize:      backlogSize,
+		bufferLimit:      bufferLimit,
+		replDB:           -1,
+		replicas:         make(map[resp.Connection]*replicaClient),
+		ports:            make(map[resp.Connection]int),
+		masterClient:     connection.NewFakeConnection(),
+	}
+}
+
+// newReplID 生成随机的复制id
+func newReplID() string {
+	buf := make([]byte, replIDLength/2)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// feedReplicas 将写入命令转发给所有从节点，和aof一样需要在db切换时补充select命令
+func (s *StandaloneDatabase) feedReplicas(dbIndex int, lines []constant.CommandLine) {
+	repl := s.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	// 没有从节点连接过时不需要记录命令流
+	if repl.master.Load() != nil || len(repl.replicas) == 0 && repl.backlog == nil {
+		return
+	}
+	var buf []byte
+	if dbIndex != repl.replDB {
+		buf = reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(dbIndex))).ToBytes()
+		repl.replDB = dbIndex
+	}
+	for _, line := range lines {
+		buf = slices.Concat(buf, reply.MakeMultiBulkReply(line).ToBytes())
+	}
+	repl.feedLocked(buf)
+}
+
+// feedLocked 将命令流发送给所有从节点并写入积压缓冲区，调用方需要持有 repl.mu
+func (repl *replicationState) feedLocked(buf []byte) {
+	repl.offset += int64(len(buf))
+	if repl.backlog != nil {
+		repl.backlog.write(buf)
+	}
+	for _, replica := range repl.replicas {
+		replica.send(buf)
+	}
+}
+
+// pingReplicas 定期向从节点发送ping
+func (s *StandaloneDatabase) pingReplicas() {
+	repl := s.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if len(repl.replicas) == 0 || time.Since(repl.lastPing) < replPingPeriod {
+		return
+	}
+	repl.lastPing = time.Now()
+	repl.feedLocked(reply.MakeMultiBulkReply(utils.ToCmdLine("PING")).ToBytes())
+}
+
+// send 将命令流加入发送队列，发送在单独的协程中进行，慢速的从节点不会阻塞命令的执行
+func (r *replicaClient) send(buf []byte) {
+	r.mu.Lock()
+	// 从节点消费过慢时断开连接，避免命令流无限堆积，从节点重连后重新同步
+	if len(r.pending)+len(buf) > r.bufferLimit {
+		r.pending = nil
+		r.mu.Unlock()
+		logger.Warn("[replication] replica " + r.conn.RemoteAddr() + " output buffer limit reached, disconnect")
+		r.close()
+		return
+	}
+	r.pending = append(r.pending, buf...)
+	r.mu.Unlock()
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// serve 先发送快照或者积压缓冲区中缺失的命令流，然后持续发送新的命令流，直到连接关闭
+func (r *replicaClient) serve(payload []byte) {
+	defer r.close()
+	if err := r.conn.Write(payload); err != nil {
+		logger.Error("[replication] send snapshot to replica failed", err)
+		return
+	}
+	r.online.Store(true)
+	r.lastAck.Store(time.Now().Unix())
+	for {
+		select {
+		case <-r.notify:
+		case <-r.closed:
+			return
+		}
+		r.mu.Lock()
+		buf := r.pending
+		r.pending = nil
+		r.mu.Unlock()
+		if len(buf) == 0 {
+			continue
+		}
+		if err := r.conn.Write(buf); err != nil {
+			logger.Error("[replication] send command stream to replica failed", err)
+			return
+		}
+	}
+}
+
+func (r *replicaClient) close() {
+	r.once.Do(func() {
+		close(r.closed)
+		// 发送失败时断开连接，从节点会重新连接并同步
+		if closer, ok := r.conn.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	})
+}
+
+// ip 从节点的ip
+func (r *replicaClient) ip() string {
+	host, _, err := net.SplitHostPort(r.conn.RemoteAddr())
+	if err != nil {
+		return r.conn.RemoteAddr()
+	}
+	return host
+}
+
+// execSync sync/psync，能够部分同步时补发缺失的命令流，否则生成快照发送给从节点，之后转发写入命令
+func (s *StandaloneDatabase) execSync(client resp.Connection, cmdName string, args [][]byte) resp.Reply {
+	if cmdName == "psync" && len(args) != 2 || cmdName == "sync" && len(args) != 0 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	if client.InMultiState() {
+		return reply.MakeStandardErrorReply("ERR Replica can't interact with the keyspace")
+	}
+	repl := s.repl
+	// 从节点转发的命令流和主节点的偏移量无法对应，只支持直接从主节点同步
+	if repl.master.Load() != nil {
+		return reply.MakeStandardErrorReply("ERR Chained replication is not supported, replicate from the master directly")
+	}
+	if cmdName == "psync" && s.tryPartialResync(client, string(args[0]), string(args[1])) {
+		return reply.MakeNoReply()
+	}
+	// 快照的分界点和开始转发命令流的位置一致，分界点之后的写入命令都会转发给从节点
+	var replica *replicaClient
+	var replID string
+	var offset int64
+	snapshot, err := s.dumpSnapshot(func() error {
+		repl.mu.Lock()
+		defer repl.mu.Unlock()
+		replica = repl.addReplicaLocked(client)
+		repl.syncFull++
+		if cmdName == "psync" && string(args[0]) != "?" {
+			repl.syncPartialErr++
+		}
+		// 第一个从节点连接时开始记录命令流
+		if repl.backlog == nil {
+			repl.backlog = makeReplBacklog(repl.backlogSize, repl.offset)
+		}
+		// 新的从节点从快照开始接收命令流，命令流中的第一条命令需要补充select
+		repl.replDB = -1
+		replID, offset = repl.replID, repl.offset
+		return nil
+	})
+	if err != nil {
+		s.removeReplica(client)
+		return reply.MakeStandardErrorReply("ERR " + err.Error())
+	}
+
+	// 旧版本的sync命令不需要回复复制id和偏移量
+	var payload []byte
+	if cmdName == "psync" {
+		payload = reply.MakeStatusReply("FULLRESYNC " + replID + " " + strconv.FormatInt(offset, 10)).ToBytes()
+	}
+	payload = slices.Concat(payload, []byte("$"+strconv.Itoa(len(snapshot))+reply.CRLF), snapshot)
+	logger.Info("[replication] start full resync with replica " + client.RemoteAddr())
+	go s.serveReplica(client, replica, payload)
+	return reply.MakeNoReply()
+}
+
+// tryPartialResync 复制id匹配并且请求的偏移量仍然在积压缓冲区中时进行部分同步
+// psync 的偏移量为从节点已经处理的偏移量+1
+func (s *StandaloneDatabase) tryPartialResync(client resp.Connection, replID string, offsetArg string) bool {
+	psyncOffset, err := strconv.ParseInt(offsetArg, 10, 64)
+	if err != nil {
+		return false
+	}
+	repl := s.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if replID != repl.replID && (replID != repl.replID2 || psyncOffset > repl.secondReplOffset) {
+		return false
+	}
+	if repl.backlog == nil || !repl.backlog.contains(psyncOffset) {
+		return false
+	}
+	replica := repl.addReplicaLocked(client)
+	repl.syncPartialOK++
+	payload := slices.Concat(reply.MakeStatusReply("CONTINUE "+repl.replID).ToBytes(), repl.backlog.readFrom(psyncOffset))
+	logger.Info("[replication] partial resync with replica " + client.RemoteAddr() + " from offset " + offsetArg)
+	go s.serveReplica(client, replica, payload)
+	return true
+}
+
+// addReplicaLocked 记录新的从节点，之后转发的命令流都会发送给它，调用方需要持有 repl.mu
+func (repl *replicationState) addReplicaLocked(client resp.Connection) *replicaClient {
+	replica := &replicaClient{
+		conn:          client,
+		listeningPort: repl.ports[client],
+		bufferLimit:   repl.bufferLimit,
+		notify:        make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+	}
+	if old, ok := repl.replicas[client]; ok {
+		old.close()
+	}
+	repl.replicas[client] = replica
+	return replica
+}
+
+// serveReplica 向从节点发送数据，发送失败时移除从节点
+func (s *StandaloneDatabase) serveReplica(client resp.Connection, replica *replicaClient, payload []byte) {
+	replica.serve(payload)
+	// 发送失败时连接可能还没有被关闭，这里主动移除，避免继续缓存命令流
+	s.repl.mu.Lock()
+	if s.repl.replicas[client] == replica {
+		delete(s.repl.replicas, client)
+	}
+	s.repl.mu.Unlock()
+}
+
+// shiftReplIDLocked 使用新的复制id，原来的复制id在当前偏移量之前仍然可以用于部分同步，调用方需要持有 repl.mu
+func (repl *replicationState) shiftReplIDLocked(replID string) {
+	repl.replID2 = repl.replID
+	repl.secondReplOffset = repl.offset + 1
+	repl.replID = replID
+}
+
+// appendFromMaster 从节点处理完主节点转发的命令后，记录偏移量并写入积压缓冲区，提升为主节点后可以继续为其他从节点提供部分同步
+func (repl *replicationState) appendFromMaster(buf []byte, offset int64) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	repl.offset = offset
+	if repl.backlog != nil {
+		repl.backlog.write(buf)
+	}
+}
+
+// execReplConf replconf，从节点上报自己的信息和已经确认的复制偏移量
+func (s *StandaloneDatabase) execReplConf(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	for i := 0; i < len(args); i += 2 {
+		option, value := strings.ToLower(string(args[i])), string(args[i+1])
+		switch option {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			s.repl.mu.Lock()
+			s.repl.ports[client] = port
+			s.repl.mu.Unlock()
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return reply.MakeNoReply()
+			}
+			s.repl.mu.Lock()
+			replica := s.repl.replicas[client]
+			s.repl.mu.Unlock()
+			if replica != nil {
+				replica.ackOffset.Store(offset)
+				replica.lastAck.Store(time.Now().Unix())
+			}
+			// ack 不需要回复
+			return reply.MakeNoReply()
+		case "capa":
+		default:
+			return reply.MakeStandardErrorReply("ERR Unrecognized REPLCONF option: " + option)
+		}
+	}
+	return reply.MakeOKReply()
+}
+
+// removeReplica 从节点断开连接
+func (s *StandaloneDatabase) removeReplica(client resp.Connection) {
+	s.repl.mu.Lock()
+	replica, ok := s.repl.replicas[client]
+	delete(s.repl.replicas, client)
+	delete(s.repl.ports, client)
+	s.repl.mu.Unlock()
+	if ok {
+		replica.close()
+		logger.Info("[replication] replica " + client.RemoteAddr() + " disconnected")
+	}
+}
+
+// disconnectReplicas 断开所有从节点，当前节点成为其他节点的从节点时，数据会被替换，从节点需要重新同步
+func (s *StandaloneDatabase) disconnectReplicas() {
+	s.repl.mu.Lock()
+	replicas := s.repl.replicas
+	s.repl.replicas = make(map[resp.Connection]*replicaClient)
+	s.repl.mu.Unlock()
+	for _, replica := range replicas {
+		replica.close()
+	}
+}
@@ -0,0 +1,346 @@
+package database
+
+import (
+	"math"
+	"redis-go/datastruct/set"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strconv"
+)
+
+// set 命令实现，包含sadd，srem，smembers，spop，sinter等命令
+
+// getAsSet 获取集合类型的值，key不存在返回nil，类型不匹配返回类型错误
+func (db *DB) getAsSet(key string) (*set.Set, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+// getOrInitSet 获取集合，key不存在时创建一个新的集合
+func (db *DB) getOrInitSet(key string) (s *set.Set, isNew bool, errReply reply.ErrorReply) {
+	s, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if s == nil {
+		s = set.Make()
+		db.PutEntity(key, &database.DataEntity{Data: s})
+		isNew = true
+	}
+	return s, isNew, nil
+}
+
+// membersToReply 将成员列表转换为多行回复
+func membersToReply(members []string) resp.Reply {
+	if len(members) == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// sadd key member [member ...]，返回新增的成员个数
+func execSAdd(db *DB, args [][]byte) resp.Reply {
+	s, _, errReply := db.getOrInitSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	added := 0
+	for _, member := range args[1:] {
+		added += s.Add(string(member))
+	}
+	db.addAof(utils.ToCmdLineWithName("SADD", args...))
+	return reply.MakeIntReply(int64(added))
+}
+
+// srem key member [member ...]，返回删除的成员个数
+func execSRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		removed += s.Remove(string(member))
+	}
+	// 集合为空时删除key
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLineWithName("SREM", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// smembers key
+func execSMembers(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return membersToReply(s.ToSlice())
+}
+
+// sismember key member
+func execSIsMember(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s.Has(string(args[1])) {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// smismember key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]resp.Reply, 0, len(args)-1)
+	for _, member := range args[1:] {
+		if s.Has(string(member)) {
+			replies = append(replies, reply.MakeIntReply(1))
+		} else {
+			replies = append(replies, reply.MakeIntReply(0))
+		}
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// scard key
+func execSCard(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// spop key [count]
+// 随机弹出的结果不确定，aof中记录为srem实际删除的成员，保证回放结果一致
+func execSPop(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := 1
+	if withCount {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+		count = int(n)
+	}
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if withCount {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	members := s.RandomDistinctMembers(min(count, s.Len()))
+	for _, member := range members {
+		s.Remove(member)
+	}
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		db.addAof(utils.ToCmdLineWithName("SREM", append([][]byte{args[0]}, membersToArgs(members)...)...))
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+	return membersToReply(members)
+}
+
+// membersToArgs 将成员列表转换为命令参数
+func membersToArgs(members []string) [][]byte {
+	args := make([][]byte, len(members))
+	for i, member := range members {
+		args[i] = []byte(member)
+	}
+	return args
+}
+
+// srandmember key [count]
+// count为正数时返回不重复的成员，为负数时返回|count|个可能重复的成员
+func execSRandMember(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 1 {
+		if s == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(s.RandomMembers(1)[0]))
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	if s == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		return membersToReply(s.RandomDistinctMembers(int(min(count, int64(s.Len())))))
+	}
+	// 和redis一致限制负数的范围，取反时不会溢出
+	if count < -math.MaxInt64/2 {
+		return reply.MakeStandardErrorReply("ERR value is out of range")
+	}
+	return membersToReply(s.RandomMembers(int(-count)))
+}
+
+// getSets 批量获取集合，不存在的key视为空集合
+func (db *DB) getSets(keys [][]byte) ([]*set.Set, reply.ErrorReply) {
+	sets := make([]*set.Set, 0, len(keys))
+	for _, key := range keys {
+		s, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if s == nil {
+			s = set.Make()
+		}
+		sets = append(sets, s)
+	}
+	return sets, nil
+}
+
+// setOperation 集合运算方法
+type setOperation func(sets ...*set.Set) *set.Set
+
+// setOpGeneric sinter/sunion/sdiff 的通用实现
+func setOpGeneric(db *DB, args [][]byte, op setOperation) resp.Reply {
+	sets, errReply := db.getSets(args)
+	if errReply != nil {
+		return errReply
+	}
+	return membersToReply(op(sets...).ToSlice())
+}
+
+// setOpStoreGeneric sinterstore/sunionstore/sdiffstore 的通用实现，返回结果集合的成员个数
+// 源集合在回放时可能已经过期，aof中直接记录结果集合而不是原始命令
+func setOpStoreGeneric(db *DB, args [][]byte, op setOperation) resp.Reply {
+	dest := string(args[0])
+	sets, errReply := db.getSets(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := op(sets...)
+	db.Remove(dest)
+	db.addAof(utils.ToCmdLine("DEL", dest))
+	if result.Len() > 0 {
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.addAof(utils.ToCmdLineWithName("SADD", append([][]byte{args[0]}, membersToArgs(result.ToSlice())...)...))
+	}
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// sinter key [key ...]
+func execSInter(db *DB, args [][]byte) resp.Reply {
+	return setOpGeneric(db, args, set.Intersect)
+}
+
+// sunion key [key ...]
+func execSUnion(db *DB, args [][]byte) resp.Reply {
+	return setOpGeneric(db, args, set.Union)
+}
+
+// sdiff key [key ...]
+func execSDiff(db *DB, args [][]byte) resp.Reply {
+	return setOpGeneric(db, args, set.Diff)
+}
+
+// sinterstore destination key [key ...]
+func execSInterStore(db *DB, args [][]byte) resp.Reply {
+	return setOpStoreGeneric(db, args, set.Intersect)
+}
+
+// sunionstore destination key [key ...]
+func execSUnionStore(db *DB, args [][]byte) resp.Reply {
+	return setOpStoreGeneric(db, args, set.Union)
+}
+
+// sdiffstore destination key [key ...]
+func execSDiffStore(db *DB, args [][]byte) resp.Reply {
+	return setOpStoreGeneric(db, args, set.Diff)
+}
+
+// sscan key cursor [MATCH pattern] [COUNT count]
+func execSScan(db *DB, args [][]byte) resp.Reply {
+	cursor, errReply := parseCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	s, typeErr := db.getAsSet(string(args[0]))
+	if typeErr != nil {
+		return typeErr
+	}
+	if s == nil {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("0")),
+			reply.MakeEmptyMultiBulkReply(),
+		})
+	}
+	members, next := scanKeys(s.ToSlice(), cursor, opts)
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.Itoa(next))),
+		membersToReply(members),
+	})
+}
+
+func init() {
+	RegisterCommand("sadd", execSAdd, -2, WithPrepare(writeFirstKey), WithCategories(catSet))
+	RegisterCommand("srem", execSRem, -2, WithPrepare(writeFirstKey), WithCategories(catSet))
+	RegisterCommand("smembers", execSMembers, 1, WithPrepare(readFirstKey), WithCategories(catSet))
+	RegisterCommand("sismember", execSIsMember, 2, WithPrepare(readFirstKey), WithCategories(catSet))
+	RegisterCommand("smismember", execSMIsMember, -2, WithPrepare(readFirstKey), WithCategories(catSet))
+	RegisterCommand("scard", execSCard, 1, WithPrepare(readFirstKey), WithCategories(catSet))
+	RegisterCommand("spop", execSPop, -1, WithPrepare(writeFirstKey), WithCategories(catSet))
+	RegisterCommand("srandmember", execSRandMember, -1, WithPrepare(readFirstKey), WithCategories(catSet))
+	RegisterCommand("sinter", execSInter, -1, WithPrepare(readAllKeys), WithCategories(catSet))
+	RegisterCommand("sunion", execSUnion, -1, WithPrepare(readAllKeys), WithCategories(catSet))
+	RegisterCommand("sdiff", execSDiff, -1, WithPrepare(readAllKeys), WithCategories(catSet))
+	RegisterCommand("sinterstore", execSInterStore, -2, WithPrepare(writeFirstReadOthers), WithCategories(catSet))
+	RegisterCommand("sunionstore", execSUnionStore, -2, WithPrepare(writeFirstReadOthers), WithCategories(catSet))
+	RegisterCommand("sdiffstore", execSDiffStore, -2, WithPrepare(writeFirstReadOthers), WithCategories(catSet))
+	RegisterCommand("sscan", execSScan, -2, WithPrepare(readFirstKey), WithCategories(catSet))
+}
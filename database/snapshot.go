@@ -0,0 +1,116 @@
+package database
+
+import (
+	"redis-go/datastruct/dict"
+	"redis-go/interface/database"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 数据快照，aof重写、保存rdb和全量同步共用
+// 只在标记分界点时暂停命令的执行，之后和命令并发地逐个key进行序列化
+// 命令写入还没有被序列化的key之前，先将key写入前的值写入快照，保证快照中的数据和分界点一致
+
+// snapshotConsumer 处理快照中的一个key，同一个db中的key串行调用
+type snapshotConsumer func(dbIndex int, key string, entity *database.DataEntity, expiration *time.Time) error
+
+// keySnapshot 一个db上正在进行的快照
+type keySnapshot struct {
+	mu       sync.Mutex // 保证consumer串行执行
+	visited  dict.Dict  // 已经处理过的key，分界点之后被写入过的key也会被记录
+	consumer func(key string, entity *database.DataEntity, expiration *time.Time) error
+	err      error // 第一次处理失败的错误，之后的key都会被忽略
+}
+
+// snapshotSet db上正在进行的所有快照
+type snapshotSet struct {
+	mu    sync.RWMutex
+	snaps []*keySnapshot
+}
+
+// dump 将key写入快照，每个key只会被处理一次，调用方需要持有key的锁
+func (snap *keySnapshot) dump(db *DB, key string) {
+	if snap.visited.PutIfAbsent(key, struct{}{}) == 0 {
+		return
+	}
+	val, ok := db.data.Get(key)
+	if !ok {
+		return
+	}
+	var expiration *time.Time
+	if expireTime, ok := db.TTL(key); ok {
+		if time.Now().After(expireTime) {
+			return
+		}
+		expiration = &expireTime
+	}
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.err == nil {
+		snap.err = snap.consumer(key, &database.DataEntity{Data: val}, expiration)
+	}
+}
+
+// startSnapshot 在db上开始快照，调用方需要保证期间没有写入
+func (db *DB) startSnapshot(consumer func(key string, entity *database.DataEntity, expiration *time.Time) error) *keySnapshot {
+	snap := &keySnapshot{
+		visited:  dict.MakeSyncDict(),
+		consumer: consumer,
+	}
+	db.snapshots.mu.Lock()
+	db.snapshots.snaps = append(db.snapshots.snaps, snap)
+	db.snapshots.mu.Unlock()
+	return snap
+}
+
+// finishSnapshot 依次对剩余的key加锁并写入快照，完成后停止记录写入
+func (db *DB) finishSnapshot(snap *keySnapshot) error {
+	db.data.ForEach(func(key string, val interface{}) bool {
+		db.locker.RLock(key)
+		snap.dump(db, key)
+		db.locker.RUnLock(key)
+		return true
+	})
+	db.snapshots.mu.Lock()
+	db.snapshots.snaps = slices.DeleteFunc(db.snapshots.snaps, func(s *keySnapshot) bool {
+		return s == snap
+	})
+	db.snapshots.mu.Unlock()
+	return snap.err
+}
+
+// beforeWrite key被写入之前，将还没有被序列化的key写入正在进行的快照，调用方需要持有key的写锁
+func (db *DB) beforeWrite(keys ...string) {
+	db.snapshots.mu.RLock()
+	defer db.snapshots.mu.RUnlock()
+	for _, snap := range db.snapshots.snaps {
+		for _, key := range keys {
+			snap.dump(db, key)
+		}
+	}
+}
+
+// takeSnapshot 暂停命令的执行，执行 mark 标记分界点，之后和命令并发地将分界点时的数据交给 consumer 处理
+// mark 返回错误时不会生成快照
+func (s *StandaloneDatabase) takeSnapshot(mark func() error, consumer snapshotConsumer) error {
+	s.pauseMu.Lock()
+	if err := mark(); err != nil {
+		s.pauseMu.Unlock()
+		return err
+	}
+	snaps := make([]*keySnapshot, len(s.dbSet))
+	for i, db := range s.dbSet {
+		snaps[i] = db.startSnapshot(func(key string, entity *database.DataEntity, expiration *time.Time) error {
+			return consumer(db.index, key, entity, expiration)
+		})
+	}
+	s.pauseMu.Unlock()
+	var err error
+	for i, db := range s.dbSet {
+		if finishErr := db.finishSnapshot(snaps[i]); err == nil {
+			err = finishErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,704 @@
+package database
+
+import (
+	"math"
+	"redis-go/datastruct/sortedset"
+	"redis-go/interface/database"
+	"redis-go/interface/resp"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// sorted set 命令实现，包含zadd，zrange，zrangebyscore，zrank，zincrby，zrem，zcount，zpopmin等命令
+
+// getAsSortedSet 获取有序集合类型的值，key不存在返回nil，类型不匹配返回类型错误
+func (db *DB) getAsSortedSet(key string) (*sortedset.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	zset, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return zset, nil
+}
+
+// getOrInitSortedSet 获取有序集合，key不存在时创建一个新的有序集合
+func (db *DB) getOrInitSortedSet(key string) (zset *sortedset.SortedSet, isNew bool, errReply reply.ErrorReply) {
+	zset, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if zset == nil {
+		zset = sortedset.Make()
+		db.PutEntity(key, &database.DataEntity{Data: zset})
+		isNew = true
+	}
+	return zset, isNew, nil
+}
+
+// formatScore 格式化分数，无穷大和redis保持一致输出为 inf/-inf
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return formatFloat(score)
+}
+
+// parseScore 解析分数，支持 inf/+inf/-inf
+func parseScore(arg []byte) (float64, bool) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// elementsToReply 将元素列表转换为多行回复
+func elementsToReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(formatScore(element.Score)))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// zadd 的选项
+const (
+	zaddNX   = 1 << iota // 只新增，不更新已有成员
+	zaddXX               // 只更新，不新增成员
+	zaddGT               // 新分数大于当前分数时才更新
+	zaddLT               // 新分数小于当前分数时才更新
+	zaddCH               // 返回值包含分数发生变化的成员个数
+	zaddINCR             // 分数作为增量，行为类似zincrby
+)
+
+// zadd key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	// 1. 解析选项
+	flags := 0
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NX" {
+			flags |= zaddNX
+		} else if option == "XX" {
+			flags |= zaddXX
+		} else if option == "GT" {
+			flags |= zaddGT
+		} else if option == "LT" {
+			flags |= zaddLT
+		} else if option == "CH" {
+			flags |= zaddCH
+		} else if option == "INCR" {
+			flags |= zaddINCR
+		} else {
+			break
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	if flags&zaddNX > 0 && flags&zaddXX > 0 {
+		return reply.MakeStandardErrorReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&zaddGT > 0 && flags&zaddLT > 0) || (flags&zaddNX > 0 && flags&(zaddGT|zaddLT) > 0) {
+		return reply.MakeStandardErrorReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags&zaddINCR > 0 && len(pairs) > 2 {
+		return reply.MakeStandardErrorReply("ERR INCR option supports a single increment-element pair")
+	}
+	elements := make([]*sortedset.Element, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := parseScore(pairs[j])
+		if !ok {
+			return reply.MakeStandardErrorReply("ERR value is not a valid float")
+		}
+		elements = append(elements, &sortedset.Element{Member: string(pairs[j+1]), Score: score})
+	}
+
+	// 2. 写入
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		// XX 模式下不会新增成员，不需要创建key
+		if flags&zaddXX > 0 {
+			if flags&zaddINCR > 0 {
+				return reply.MakeNullBulkReply()
+			}
+			return reply.MakeIntReply(0)
+		}
+		zset, _, _ = db.getOrInitSortedSet(key)
+	}
+	added, changed := 0, 0
+	var incrResult *float64
+	for _, element := range elements {
+		current, exists := zset.Get(element.Member)
+		if (exists && flags&zaddNX > 0) || (!exists && flags&zaddXX > 0) {
+			continue
+		}
+		score := element.Score
+		if flags&zaddINCR > 0 && exists {
+			score += current.Score
+			if math.IsNaN(score) {
+				return reply.MakeStandardErrorReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if exists {
+			if (flags&zaddGT > 0 && score <= current.Score) || (flags&zaddLT > 0 && score >= current.Score) {
+				continue
+			}
+			if score != current.Score {
+				changed++
+			}
+		} else {
+			added++
+		}
+		zset.Add(element.Member, score)
+		result := score
+		incrResult = &result
+	}
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if added > 0 || changed > 0 {
+		db.addAof(utils.ToCmdLineWithName("ZADD", args...))
+	}
+
+	// 3. 返回结果
+	if flags&zaddINCR > 0 {
+		if incrResult == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(formatScore(*incrResult)))
+	}
+	if flags&zaddCH > 0 {
+		return reply.MakeIntReply(int64(added + changed))
+	}
+	return reply.MakeIntReply(int64(added))
+}
+
+// zincrby key increment member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	return execZAdd(db, [][]byte{args[0], []byte("INCR"), args[1], args[2]})
+}
+
+// zscore key member
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeNullBulkReply()
+	}
+	element, exists := zset.Get(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply([]byte(formatScore(element.Score)))
+}
+
+// zmscore key member [member ...]
+func execZMScore(db *DB, args [][]byte) resp.Reply {
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if zset == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i, member := range args[1:] {
+		if element, exists := zset.Get(string(member)); exists {
+			result[i] = []byte(formatScore(element.Score))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// zcard key
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(zset.Len())
+}
+
+// rankGeneric zrank/zrevrank 的通用实现
+func rankGeneric(db *DB, args [][]byte, desc bool) resp.Reply {
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return reply.MakeSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if withScore {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	member := string(args[1])
+	rank := zset.GetRank(member, desc)
+	if rank < 0 {
+		if withScore {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	if withScore {
+		element, _ := zset.Get(member)
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(rank),
+			reply.MakeBulkReply([]byte(formatScore(element.Score))),
+		})
+	}
+	return reply.MakeIntReply(rank)
+}
+
+// zrank key member [WITHSCORE]
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return rankGeneric(db, args, false)
+}
+
+// zrevrank key member [WITHSCORE]
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return rankGeneric(db, args, true)
+}
+
+// zrem key member [member ...]
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(string(member)) {
+			removed++
+		}
+	}
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLineWithName("ZREM", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// zcount key min max
+func execZCount(db *DB, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(zset.RangeCount(min, max))
+}
+
+// zlexcount key min max
+func execZLexCount(db *DB, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	zset, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(zset.RangeCount(min, max))
+}
+
+// zpopGeneric zpopmin/zpopmax 的通用实现
+func zpopGeneric(db *DB, cmdName string, args [][]byte, max bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+		count = int(n)
+	}
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	var removed []*sortedset.Element
+	if max {
+		removed = zset.PopMax(count)
+	} else {
+		removed = zset.PopMin(count)
+	}
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(removed) > 0 {
+		db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	}
+	return elementsToReply(removed, true)
+}
+
+// zpopmin key [count]
+func execZPopMin(db *DB, args [][]byte) resp.Reply {
+	return zpopGeneric(db, "ZPOPMIN", args, false)
+}
+
+// zpopmax key [count]
+func execZPopMax(db *DB, args [][]byte) resp.Reply {
+	return zpopGeneric(db, "ZPOPMAX", args, true)
+}
+
+// zrange 的查询方式
+const (
+	rangeByRank = iota
+	rangeByScore
+	rangeByLex
+)
+
+// zrangeOptions zrange系列命令的参数
+type zrangeOptions struct {
+	by         int
+	rev        bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+}
+
+// parseLimit 解析 LIMIT offset count
+func parseLimit(args [][]byte, opts *zrangeOptions) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	offset, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	opts.hasLimit = true
+	opts.offset = offset
+	opts.count = count
+	return nil
+}
+
+// rangeGeneric zrange系列命令的通用实现，start/stop 的含义由查询方式决定
+// 按排名查询时为下标，按分数或字典序查询时为区间边界，rev 为true时 start 为区间的上界
+func rangeGeneric(db *DB, key string, start []byte, stop []byte, opts *zrangeOptions) resp.Reply {
+	if opts.hasLimit && opts.by == rangeByRank {
+		return reply.MakeStandardErrorReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if opts.withScores && opts.by == rangeByLex {
+		return reply.MakeStandardErrorReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	if opts.by == rangeByRank {
+		startIndex, err := strconv.ParseInt(string(start), 10, 64)
+		if err != nil {
+			return reply.MakeIntErrReply()
+		}
+		stopIndex, err := strconv.ParseInt(string(stop), 10, 64)
+		if err != nil {
+			return reply.MakeIntErrReply()
+		}
+		zset, errReply := db.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if zset == nil {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		begin, end := normalizeRange(startIndex, stopIndex, int(zset.Len()))
+		if begin == end {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return elementsToReply(zset.RangeByRank(int64(begin), int64(end), opts.rev), opts.withScores)
+	}
+
+	// 按区间查询，逆序时参数顺序为 max min
+	minArg, maxArg := start, stop
+	if opts.rev {
+		minArg, maxArg = stop, start
+	}
+	var min, max sortedset.Border
+	var err error
+	if opts.by == rangeByScore {
+		min, err = sortedset.ParseScoreBorder(string(minArg))
+		if err == nil {
+			max, err = sortedset.ParseScoreBorder(string(maxArg))
+		}
+	} else {
+		min, err = sortedset.ParseLexBorder(string(minArg))
+		if err == nil {
+			max, err = sortedset.ParseLexBorder(string(maxArg))
+		}
+	}
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	offset, count := int64(0), int64(-1)
+	if opts.hasLimit {
+		offset, count = opts.offset, opts.count
+	}
+	return elementsToReply(zset.Range(min, max, offset, count, opts.rev), opts.withScores)
+}
+
+// zrange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByRank}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "BYSCORE":
+			opts.by = rangeByScore
+		case "BYLEX":
+			opts.by = rangeByLex
+		case "REV":
+			opts.rev = true
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if errReply := parseLimit(args[i+1:], opts); errReply != nil {
+				return errReply
+			}
+			i += 2
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// zrevrange key start stop [WITHSCORES]
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByRank, rev: true}
+	if len(args) == 4 {
+		if strings.ToUpper(string(args[3])) != "WITHSCORES" {
+			return reply.MakeSyntaxErrReply()
+		}
+		opts.withScores = true
+	} else if len(args) > 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// parseRangeByOptions 解析 zrangebyscore/zrangebylex 系列命令的 [WITHSCORES] [LIMIT offset count] 选项
+func parseRangeByOptions(args [][]byte, opts *zrangeOptions) resp.Reply {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if errReply := parseLimit(args[i+1:], opts); errReply != nil {
+				return errReply
+			}
+			i += 2
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	return nil
+}
+
+// zrangebyscore key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByScore}
+	if errReply := parseRangeByOptions(args[3:], opts); errReply != nil {
+		return errReply
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByScore, rev: true}
+	if errReply := parseRangeByOptions(args[3:], opts); errReply != nil {
+		return errReply
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// zrangebylex key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByLex}
+	if errReply := parseRangeByOptions(args[3:], opts); errReply != nil {
+		return errReply
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// zrevrangebylex key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeOptions{by: rangeByLex, rev: true}
+	if errReply := parseRangeByOptions(args[3:], opts); errReply != nil {
+		return errReply
+	}
+	return rangeGeneric(db, string(args[0]), args[1], args[2], opts)
+}
+
+// removeRangeGeneric zremrangebyscore/zremrangebylex 的通用实现
+func removeRangeGeneric(db *DB, cmdName string, args [][]byte, min, max sortedset.Border) resp.Reply {
+	key := string(args[0])
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := zset.RemoveRange(min, max)
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(removed) > 0 {
+		db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	}
+	return reply.MakeIntReply(int64(len(removed)))
+}
+
+// zremrangebyscore key min max
+func execZRemRangeByScore(db *DB, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	return removeRangeGeneric(db, "ZREMRANGEBYSCORE", args, min, max)
+}
+
+// zremrangebylex key min max
+func execZRemRangeByLex(db *DB, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	max, err := sortedset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	return removeRangeGeneric(db, "ZREMRANGEBYLEX", args, min, max)
+}
+
+// zremrangebyrank key start stop
+func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return reply.MakeIntReply(0)
+	}
+	begin, end := normalizeRange(start, stop, int(zset.Len()))
+	if begin == end {
+		return reply.MakeIntReply(0)
+	}
+	removed := zset.RemoveByRank(int64(begin), int64(end))
+	if zset.Len() == 0 {
+		db.Remove(key)
+	}
+	db.addAof(utils.ToCmdLineWithName("ZREMRANGEBYRANK", args...))
+	return reply.MakeIntReply(int64(len(removed)))
+}
+
+func init() {
+	RegisterCommand("zadd", execZAdd, -3, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zincrby", execZIncrBy, 3, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zscore", execZScore, 2, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zmscore", execZMScore, -2, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zcard", execZCard, 1, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrank", execZRank, -2, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrevrank", execZRevRank, -2, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrem", execZRem, -2, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zcount", execZCount, 3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zlexcount", execZLexCount, 3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zpopmin", execZPopMin, -1, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zpopmax", execZPopMax, -1, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrange", execZRange, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrevrange", execZRevRange, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrangebyscore", execZRangeByScore, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrevrangebyscore", execZRevRangeByScore, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrangebylex", execZRangeByLex, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zrevrangebylex", execZRevRangeByLex, -3, WithPrepare(readFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zremrangebyscore", execZRemRangeByScore, 3, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zremrangebylex", execZRemRangeByLex, 3, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+	RegisterCommand("zremrangebyrank", execZRemRangeByRank, 3, WithPrepare(writeFirstKey), WithCategories(catSortedSet))
+}
@@ -1,25 +1,70 @@
 package database
 
 import (
+	"errors"
 	"redis-go/aof"
 	"redis-go/config"
 	"redis-go/constant"
+	databaseface "redis-go/interface/database"
 	"redis-go/interface/resp"
 	"redis-go/lib/logger"
+	"redis-go/pubsub"
 	"redis-go/resp/reply"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// serverCronInterval 后台定时任务的执行间隔，主动过期等周期性任务在这里触发
+const serverCronInterval = 100 * time.Millisecond
+
 // 单体模式数据库
 type StandaloneDatabase struct {
 	dbSet      []*DB
 	aofHandler *aof.AofHandler
+	hub        *pubsub.Hub // 发布订阅中心
+	// 命令执行时持有读锁，标记数据快照的分界点时持有写锁，保证快照和重写缓存、命令流的分界点一致
+	pauseMu   sync.RWMutex
+	closeChan chan struct{} // 关闭信号，用于停止后台任务
+	closeOnce sync.Once
+
+	// rdb快照相关
+	dirty      atomic.Int64 // 上一次保存快照之后的写入次数
+	lastSave   atomic.Int64 // 上一次成功保存快照的时间，unix秒
+	saveMu     sync.Mutex   // 保证同一时间只有一个保存任务
+	saving     atomic.Bool  // 是否正在保存快照
+	lastSaveOK atomic.Bool  // 上一次保存是否成功
+	saveParams []saveParam  // 自动保存规则
+
+	repl *replicationState // 主从复制的状态
+
+	transactions sync.Map // 集群模式下的分布式事务，事务id -> *Transaction
+
+	aofUseRdbPreamble bool // aof重写时是否使用rdb格式的文件头
+
+	acl *aclState // acl用户，控制连接可以执行的命令和访问的key
+
+	clients databaseface.Clients // 当前所有的客户端连接，由处理器设置
+	pause   clientPause          // client pause 暂停客户端的状态
+
+	// info命令使用的运行状态
+	startTime     time.Time    // 启动时间
+	runID         string       // 每次启动随机生成的id
+	totalCommands atomic.Int64 // 执行过的命令总数
+	ops           opsSampler   // 每秒执行命令数的采样
 }
 
 func NewStandaloneDatabase() *StandaloneDatabase {
 	// 创建一个数据库实例
-	database := &StandaloneDatabase{}
+	database := &StandaloneDatabase{
+		hub:       pubsub.MakeHub(),
+		closeChan: make(chan struct{}),
+		repl:      makeReplicationState(config.Properties.ReplBacklogSize, config.Properties.ReplicaOutputBufferLimit),
+		startTime: time.Now(),
+		runID:     newReplID(),
+	}
 	if config.Properties.Databases <= 0 {
 		config.Properties.Databases = 16
 	}
@@ -28,26 +73,70 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 		db := NewDB(WithIndex(i)) // 设置带编号的数据库
 		database.dbSet[i] = db
 	}
-	// 数据库创建完成，进行初始化操作，加载持久化文件
+	database.lastSave.Store(time.Now().Unix())
+	database.lastSaveOK.Store(true)
+	database.saveParams = parseSaveParams(config.Properties.Save)
+	database.aofUseRdbPreamble = config.Properties.AofUseRdbPreamble
+	acl, err := makeACL(config.Properties.RequirePass, config.Properties.AclFile)
+	if err != nil {
+		logger.Error("failed to load acl file", err)
+		panic("fatal error")
+	}
+	database.acl = acl
+	// 数据库创建完成，进行初始化操作，加载持久化文件，开启aof时优先使用aof文件
 	if config.Properties.AppendOnly {
 		handler, err := aof.NewAofHandler(database)
 		database.aofHandler = handler
 		if err != nil {
-			logger.Error("failed to open aof file, %v", err)
+			logger.Error("failed to open aof file", err)
 			panic("fatal error")
 		}
-		// 由于匿名函数使用了外部变量，这里参数指向了外部变量的地址，所有的匿名方法都指向了同一个值
-		for _, db := range database.dbSet {
-			sdb := db
-			db.addAof = func(line constant.CommandLine) {
-				logger.Info("[database exec] add aof, current command: ", line)
-				database.aofHandler.AddHandler(sdb.index, line)
-			}
+	} else {
+		database.loadRDB()
+	}
+	// 由于匿名函数使用了外部变量，这里参数指向了外部变量的地址，所有的匿名方法都指向了同一个值
+	// 加载持久化文件时写入的数据不需要再次记录，所以在加载完成之后再设置
+	for _, db := range database.dbSet {
+		sdb := db
+		db.addAof = func(lines ...constant.CommandLine) {
+			database.afterWrite(sdb.index, lines)
 		}
 	}
+	go database.serverCron()
 	return database
 }
 
+// serverCron 后台定时任务，周期性地对各个db进行主动过期
+func (s *StandaloneDatabase) serverCron() {
+	ticker := time.NewTicker(serverCronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 从节点的过期key由主节点转发的del命令删除，不主动过期，暂停客户端期间也不主动过期
+			if s.repl.master.Load() == nil && !s.pause.isPaused() {
+				s.pauseMu.RLock()
+				for _, db := range s.dbSet {
+					db.activeExpireCycle()
+				}
+				s.pauseMu.RUnlock()
+			}
+			s.ops.sample(s.totalCommands.Load())
+			s.pingReplicas()
+			// aof文件增长过快时自动重写
+			if s.aofHandler != nil && s.aofHandler.NeedRewrite() {
+				go s.bgRewriteAof()
+			}
+			// 满足自动保存规则时在后台保存快照
+			if s.needSave() {
+				go s.bgSave()
+			}
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
 func (s *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply {
 	defer func() {
 		if err := recover(); err != nil {
@@ -55,36 +144,224 @@ func (s *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.Re
 			logger.Error("error occurs when processing command", err)
 		}
 	}()
-	commandName := string(args[0])
+	commandName := strings.ToLower(string(args[0]))
 	logger.Info("[database exec] current command: ", args)
+	// 未认证的连接只能执行认证相关的命令，已认证的连接需要检查acl权限
+	if errReply := s.CheckAccess(client, args); errReply != nil {
+		return errReply
+	}
+	s.totalCommands.Add(1)
+	if client.InMultiState() && noMultiCmds[commandName] {
+		return notAllowedInMulti(client)
+	}
+	switch commandName {
+	case "auth":
+		return s.execAuth(client, args[1:])
+	case "hello":
+		return s.execHello(client, args[1:])
+	case "acl":
+		return s.execACL(client, args[1:])
+	case "client":
+		return s.execClient(client, args[1:])
+	}
+	// client pause 暂停期间阻塞到暂停结束
+	s.waitUnpause(client, commandName, args)
+	// 订阅模式下只允许执行订阅相关的命令
+	if client.SubsCount() > 0 && !pubsub.IsSubscribeModeCmd(commandName) {
+		return pubsub.MakeSubscribeModeErrReply(commandName)
+	}
+	// 发布订阅命令和db无关，在这里统一处理
+	if isPubSubCmd(commandName) {
+		// 发布消息不改变连接的状态，可以在事务中入队，exec时执行
+		if client.InMultiState() && (commandName == "publish" || commandName == "pubsub") {
+			if commandName == "publish" && len(args) != 3 || commandName == "pubsub" && len(args) < 2 {
+				errReply := reply.MakeArgNumErrReply(commandName)
+				client.AddTxError(errReply)
+				return errReply
+			}
+			client.EnqueueCmd(args)
+			return reply.MakeStatusReply("QUEUED")
+		}
+		if client.InMultiState() {
+			return notAllowedInMulti(client)
+		}
+		return s.execPubSub(client, commandName, args[1:])
+	}
+	if commandName == "ping" && client.SubsCount() > 0 {
+		return pubsub.MakeSubscribeModePongReply()
+	}
+	// 持久化相关的命令需要暂停其他命令的执行，不能在持有读锁的情况下执行
+	switch commandName {
+	case "bgrewriteaof":
+		return s.execBGRewriteAof(args[1:])
+	case "save":
+		return s.execSave(args[1:])
+	case "bgsave":
+		return s.execBGSave(args[1:])
+	case "lastsave":
+		return s.execLastSave(args[1:])
+	case "replicaof", "slaveof":
+		return s.execReplicaOf(commandName, args[1:])
+	case "sync", "psync":
+		return s.execSync(client, commandName, args[1:])
+	case "replconf":
+		return s.execReplConf(client, args[1:])
+	case "role":
+		return s.execRole(args[1:])
+	case "info":
+		return s.execInfo(args[1:])
+	}
+	s.pauseMu.RLock()
+	defer s.pauseMu.RUnlock()
+	// 从节点只读，写入命令只能来自主节点
+	if s.isReadOnly(client) && isWriteCommand(commandName, args[1:]) {
+		errReply := reply.MakeStandardErrorReply("READONLY You can't write against a read only replica.")
+		if client.InMultiState() {
+			client.AddTxError(errors.New(errReply.Status))
+		}
+		return errReply
+	}
 	// 拦截检验当前是否选择db命令
-	if len(args) > 0 && strings.ToLower(commandName) == "select" {
+	if commandName == "select" {
 		if len(args) != 2 {
-			return reply.MakeArgNumErrReply("[Database exec error] select database args error")
+			errReply := reply.MakeArgNumErrReply("select")
+			if client.InMultiState() {
+				client.AddTxError(errReply)
+			}
+			return errReply
 		}
-		return execSelect(client, s, args[1:])
+		// 事务中的select和其他命令一样入队，exec时切换db
+		if client.InMultiState() {
+			client.EnqueueCmd(args)
+			return reply.MakeStatusReply("QUEUED")
+		}
+		return selectDB(client, s.getDB, args[1:])
+	}
+	// 事务中可能切换db，exec需要访问所有的db
+	if commandName == "exec" {
+		return execMulti(s.getDB, s.execQueuedCmd, client, args[1:])
 	}
 	return s.dbSet[client.GetDBIndex()].Exec(client, args)
 }
 
-// execSelect sets the current database for the client connection.
+// execQueuedCmd 执行事务中排队的不在cmdTable中的命令
+func (s *StandaloneDatabase) execQueuedCmd(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	return s.execPubSub(client, strings.ToLower(string(cmdLine[0])), cmdLine[1:])
+}
+
+// getDB 获取编号对应的db，编号不存在时返回nil
+func (s *StandaloneDatabase) getDB(index int) *DB {
+	if index < 0 || index >= len(s.dbSet) {
+		return nil
+	}
+	return s.dbSet[index]
+}
+
+// selectDB sets the current database for the client connection.
 // select x
-func execSelect(c resp.Connection, database *StandaloneDatabase, args [][]byte) resp.Reply {
+func selectDB(c resp.Connection, getDB func(index int) *DB, args [][]byte) resp.Reply {
 	dbIndex, err := strconv.Atoi(string(args[0]))
 	if err != nil {
 		return reply.MakeStandardErrorReply("ERR invalid DB index")
 	}
-	if dbIndex < 0 || dbIndex >= len(database.dbSet) {
+	if getDB(dbIndex) == nil {
 		return reply.MakeStandardErrorReply("ERR DB index out of range")
 	}
 	c.SelectDB(dbIndex)
 	return reply.MakeIntReply(int64(dbIndex))
 }
 
+// afterWrite 所有写入命令执行后的统一入口，记录写入次数，写入aof并转发给从节点
+func (s *StandaloneDatabase) afterWrite(dbIndex int, lines []constant.CommandLine) {
+	s.dirty.Add(int64(len(lines)))
+	if s.aofHandler != nil {
+		logger.Info("[database exec] add aof, current command: ", lines)
+		s.aofHandler.AddHandler(dbIndex, lines...)
+	}
+	s.feedReplicas(dbIndex, lines)
+}
+
+// noMultiCmds 不能在事务中入队的命令，这些命令不在cmdTable中，入队之后exec时无法执行
+var noMultiCmds = map[string]bool{
+	"bgrewriteaof": true,
+	"save":         true,
+	"bgsave":       true,
+	"lastsave":     true,
+	"replicaof":    true,
+	"slaveof":      true,
+	"sync":         true,
+	"psync":        true,
+	"replconf":     true,
+	"role":         true,
+	"info":         true,
+	"auth":         true,
+	"hello":        true,
+	"acl":          true,
+	"client":       true,
+}
+
+// notAllowedInMulti 事务中不允许执行的命令，记录错误之后exec时放弃整个事务
+func notAllowedInMulti(client resp.Connection) resp.Reply {
+	errReply := reply.MakeStandardErrorReply("ERR Command not allowed inside a transaction")
+	client.AddTxError(errors.New(errReply.Status))
+	return errReply
+}
+
+// isPubSubCmd 判断是否为发布订阅命令
+func isPubSubCmd(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish", "pubsub":
+		return true
+	}
+	return false
+}
+
+// execPubSub 执行发布订阅命令
+func (s *StandaloneDatabase) execPubSub(client resp.Connection, cmdName string, args [][]byte) resp.Reply {
+	switch cmdName {
+	case "subscribe":
+		return pubsub.Subscribe(s.hub, client, args)
+	case "unsubscribe":
+		return pubsub.UnSubscribe(s.hub, client, args)
+	case "psubscribe":
+		return pubsub.PSubscribe(s.hub, client, args)
+	case "punsubscribe":
+		return pubsub.PUnSubscribe(s.hub, client, args)
+	case "publish":
+		return pubsub.Publish(s.hub, args)
+	default:
+		return pubsub.PubSub(s.hub, args)
+	}
+}
+
 func (s *StandaloneDatabase) AfterClientClose(c resp.Connection) {
+	// 连接关闭后不会再收到消息，需要从发布订阅中心移除
+	pubsub.UnsubscribeAll(s.hub, c)
+	s.removeReplica(c)
 	logger.Info("client closed ... ")
 }
 
 func (s *StandaloneDatabase) Close() {
+	// 关闭可能被多次调用，保证后台任务只停止一次
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+		if link := s.repl.master.Load(); link != nil {
+			link.stop()
+		}
+		s.disconnectReplicas()
+		s.stopTransactions()
+		// 关闭前等待管道中剩余的aof命令写入文件
+		if s.aofHandler != nil {
+			if err := s.aofHandler.Close(); err != nil {
+				logger.Error("failed to close aof file", err)
+			}
+		}
+	})
 	logger.Info("database closed ... ")
 }
+
+// KeyExists 判断指定db中的key是否存在，集群模式下迁移哈希槽时使用
+func (s *StandaloneDatabase) KeyExists(dbIndex int, key string) bool {
+	_, exists := s.dbSet[dbIndex].GetEntity(key)
+	return exists
+}
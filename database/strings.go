@@ -1,66 +1,526 @@
 package database
 
 import (
+	"math"
 	"redis-go/interface/database"
 	"redis-go/interface/resp"
 	"redis-go/lib/utils"
 	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// strings 命令实现，包含get，set，setnx，setex，strlen等命令
+// strings 命令实现，包含get，set，setnx，setex，strlen，incr，mget，mset等命令
+
+// getAsString 获取字符串类型的值，key不存在返回nil，类型不匹配返回类型错误
+func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	val, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return val, nil
+}
 
 func execGet(db *DB, args [][]byte) resp.Reply {
-	val, exist := db.GetEntity(string(args[0]))
-	if !exist {
+	val, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
 		return reply.MakeNullBulkReply()
 	}
-	return reply.MakeBulkReply(val.Data.([]byte))
+	return reply.MakeBulkReply(val)
+
+}
 
+// parseExpireOption 解析 EX|PX|EXAT|PXAT 选项的参数，返回绝对过期时间
+func parseExpireOption(cmdName string, option string, arg []byte) (time.Time, resp.Reply) {
+	raw, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.MakeIntErrReply()
+	}
+	// 秒级参数换算成毫秒时需要防止溢出
+	factor := int64(1)
+	if option == "EX" || option == "EXAT" {
+		factor = 1000
+	}
+	if raw <= 0 || raw > math.MaxInt64/factor {
+		return time.Time{}, reply.MakeStandardErrorReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	if option == "EX" || option == "PX" {
+		expireTime, ok := relativeExpireTime(raw * factor)
+		if !ok {
+			return time.Time{}, reply.MakeStandardErrorReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+		return expireTime, nil
+	}
+	return time.UnixMilli(raw * factor), nil
 }
 
-// set
+// set 的写入策略
+const (
+	upsertPolicy = iota // 默认策略，存在则覆盖，不存在则新增
+	insertPolicy        // NX，仅当key不存在时写入
+	updatePolicy        // XX，仅当key存在时写入
+)
+
+// set key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
 func execSet(db *DB, args [][]byte) resp.Reply {
-	db.PutEntity(string(args[0]), &database.DataEntity{Data: args[1]})
-	db.addAof(utils.ToCmdLineWithName("SET", args...)) // 写命令应当发送, ...代表拆包操作
+	key := string(args[0])
+	value := args[1]
+	policy := upsertPolicy
+	var expireTime time.Time
+	hasExpire, keepTTL, withGet := false, false, false
+	// 1. 解析选项，互斥的选项同时出现时返回语法错误
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "NX":
+			if policy == updatePolicy {
+				return reply.MakeSyntaxErrReply()
+			}
+			policy = insertPolicy
+		case "XX":
+			if policy == insertPolicy {
+				return reply.MakeSyntaxErrReply()
+			}
+			policy = updatePolicy
+		case "GET":
+			withGet = true
+		case "KEEPTTL":
+			if hasExpire {
+				return reply.MakeSyntaxErrReply()
+			}
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || keepTTL || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			var errReply resp.Reply
+			expireTime, errReply = parseExpireOption("set", option, args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			hasExpire = true
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	// 2. GET选项需要先读取旧值，旧值不是字符串时整个命令失败
+	var oldValue []byte
+	if withGet {
+		old, errReply := db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+		oldValue = old
+	}
+	// 3. 按照策略写入
+	entity := &database.DataEntity{Data: value}
+	result := 0
+	switch policy {
+	case upsertPolicy:
+		db.PutEntity(key, entity)
+		result = 1
+	case insertPolicy:
+		result = db.PutIfAbsent(key, entity)
+	case updatePolicy:
+		result = db.PutIfExists(key, entity)
+	}
+	if result > 0 {
+		// 4. 处理过期时间，set默认会覆盖原有的过期时间
+		if hasExpire {
+			db.Expire(key, expireTime)
+		} else if !keepTTL {
+			db.Persist(key)
+		}
+		// aof中过期时间统一记录为绝对时间，NX/XX/GET只影响是否写入，写入成功后无需记录
+		line := utils.ToCmdLine("SET", key, string(value))
+		if hasExpire {
+			line = append(line, []byte("PXAT"), []byte(strconv.FormatInt(expireTime.UnixMilli(), 10)))
+		} else if keepTTL {
+			line = append(line, []byte("KEEPTTL"))
+		}
+		db.addAof(line)
+	}
+	if withGet {
+		if oldValue == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply(oldValue)
+	}
+	if result == 0 {
+		return reply.MakeNullBulkReply()
+	}
 	return reply.MakeOKReply()
 }
 
 // setnx
 func execSetNX(db *DB, args [][]byte) resp.Reply {
-	exists := db.PutIfAbsent(string(args[0]), &database.DataEntity{Data: args[1]})
-	return reply.MakeIntReply(int64(exists))
+	result := db.PutIfAbsent(string(args[0]), &database.DataEntity{Data: args[1]})
+	if result > 0 {
+		db.addAof(utils.ToCmdLineWithName("SET", args...))
+	}
+	return reply.MakeIntReply(int64(result))
 }
 
-// setex
+// setex key seconds value，等价于 set key value ex seconds
 func execSetEX(db *DB, args [][]byte) resp.Reply {
-	exists := db.PutIfExists(string(args[0]), &database.DataEntity{Data: args[1]})
-	return reply.MakeIntReply(int64(exists))
+	return setWithExpire(db, "setex", "EX", args)
+}
+
+// psetex key milliseconds value，等价于 set key value px milliseconds
+func execPSetEX(db *DB, args [][]byte) resp.Reply {
+	return setWithExpire(db, "psetex", "PX", args)
+}
+
+func setWithExpire(db *DB, cmdName string, unit string, args [][]byte) resp.Reply {
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	if ttl <= 0 {
+		return reply.MakeStandardErrorReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	return execSet(db, [][]byte{args[0], args[2], []byte(unit), args[1]})
 }
 
 // getset,设置键值对并且返回旧值
 func execGetSet(db *DB, args [][]byte) resp.Reply {
-	entity, ok := db.GetEntity(string(args[0]))
+	old, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
 	db.PutEntity(string(args[0]), &database.DataEntity{Data: args[1]})
-	if ok {
-		return reply.MakeBulkReply(entity.Data.([]byte))
+	db.Persist(string(args[0]))
+	db.addAof(utils.ToCmdLineWithName("SET", args...))
+	if old != nil {
+		return reply.MakeBulkReply(old)
 	}
 	return reply.MakeNullBulkReply()
 }
 
 // strlen
 func execStrLen(db *DB, args [][]byte) resp.Reply {
-	entity, ok := db.GetEntity(string(args[0]))
-	if !ok {
-		return reply.MakeIntReply(0)
+	val, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntReply(int64(len(val)))
+}
+
+// incrGeneric incr/decr/incrby/decrby 的通用实现，key不存在时视为0，保留原有的过期时间
+func incrGeneric(db *DB, cmdLine [][]byte, key string, delta int64) resp.Reply {
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if val != nil {
+		var err error
+		current, err = strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return reply.MakeIntErrReply()
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return reply.MakeStandardErrorReply("ERR increment or decrement would overflow")
+	}
+	current += delta
+	db.PutEntity(key, &database.DataEntity{Data: []byte(strconv.FormatInt(current, 10))})
+	db.addAof(cmdLine)
+	return reply.MakeIntReply(current)
+}
+
+// incr key
+func execIncr(db *DB, args [][]byte) resp.Reply {
+	return incrGeneric(db, utils.ToCmdLineWithName("INCR", args...), string(args[0]), 1)
+}
+
+// decr key
+func execDecr(db *DB, args [][]byte) resp.Reply {
+	return incrGeneric(db, utils.ToCmdLineWithName("DECR", args...), string(args[0]), -1)
+}
+
+// incrby key increment
+func execIncrBy(db *DB, args [][]byte) resp.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	return incrGeneric(db, utils.ToCmdLineWithName("INCRBY", args...), string(args[0]), delta)
+}
+
+// decrby key decrement
+func execDecrBy(db *DB, args [][]byte) resp.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	// math.MinInt64 取反会溢出
+	if delta == math.MinInt64 {
+		return reply.MakeStandardErrorReply("ERR decrement would overflow")
+	}
+	return incrGeneric(db, utils.ToCmdLineWithName("DECRBY", args...), string(args[0]), -delta)
+}
+
+// incrbyfloat key increment
+// 浮点运算在不同平台上可能存在精度差异，aof中记录计算结果而不是增量
+func execIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeStandardErrorReply("ERR value is not a valid float")
+	}
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if val != nil {
+		current, err = strconv.ParseFloat(string(val), 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return reply.MakeStandardErrorReply("ERR value is not a valid float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return reply.MakeStandardErrorReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(formatFloat(current))
+	db.PutEntity(key, &database.DataEntity{Data: result})
+	db.addAof(utils.ToCmdLine("SET", key, string(result), "KEEPTTL"))
+	return reply.MakeBulkReply(result)
+}
+
+// append key value，key不存在时等价于set，返回追加后的长度
+func execAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	// 参数切片可能被其他地方引用，这里总是拷贝一份新的值
+	result := make([]byte, 0, len(val)+len(args[1]))
+	result = append(append(result, val...), args[1]...)
+	db.PutEntity(key, &database.DataEntity{Data: result})
+	db.addAof(utils.ToCmdLineWithName("APPEND", args...))
+	return reply.MakeIntReply(int64(len(result)))
+}
+
+// getrange key start end，下标规则和redis保持一致
+func execGetRange(db *DB, args [][]byte) resp.Reply {
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	val, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(len(val))
+	if start < 0 && end < 0 && start > end {
+		return reply.MakeEmptyBulkReply()
+	}
+	if start < 0 {
+		start = size + start
+	}
+	if end < 0 {
+		end = size + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || size == 0 {
+		return reply.MakeEmptyBulkReply()
+	}
+	return reply.MakeBulkReply(val[start : end+1])
+}
+
+// 字符串允许的最大长度，和redis的 proto-max-bulk-len 默认值保持一致
+const maxStringLength = 512 * 1024 * 1024
+
+// setrange key offset value，从offset开始覆盖写入，长度不足时用0填充，返回写入后的长度
+func execSetRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeIntErrReply()
+	}
+	if offset < 0 {
+		return reply.MakeStandardErrorReply("ERR offset is out of range")
+	}
+	value := args[2]
+	// 先减去写入的长度再比较，防止 offset 很大时相加溢出
+	if offset > maxStringLength-int64(len(value)) {
+		return reply.MakeStandardErrorReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	// 写入空值不会修改原有的值，也不会创建key
+	if len(value) == 0 {
+		return reply.MakeIntReply(int64(len(val)))
+	}
+	size := len(val)
+	if end := int(offset) + len(value); end > size {
+		size = end
+	}
+	result := make([]byte, size)
+	copy(result, val)
+	copy(result[offset:], value)
+	db.PutEntity(key, &database.DataEntity{Data: result})
+	db.addAof(utils.ToCmdLineWithName("SETRANGE", args...))
+	return reply.MakeIntReply(int64(len(result)))
+}
+
+// mget key [key ...]，不存在或者类型不是字符串的key返回nil
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	result := make([][]byte, len(args))
+	for i, key := range args {
+		val, errReply := db.getAsString(string(key))
+		if errReply == nil {
+			result[i] = val
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// mset key value [key value ...]
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		db.PutEntity(key, &database.DataEntity{Data: args[i+1]})
+		db.Persist(key)
+	}
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.MakeOKReply()
+}
+
+// msetnx key value [key value ...]，只要有一个key存在就不进行任何写入
+func execMSetNX(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("msetnx")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if _, exists := db.GetEntity(string(args[i])); exists {
+			return reply.MakeIntReply(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		db.PutEntity(string(args[i]), &database.DataEntity{Data: args[i+1]})
+	}
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.MakeIntReply(1)
+}
+
+// writeEvenKeys mset/msetnx 的加锁分析，偶数位置的参数为key
+func writeEvenKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// getdel key，获取值后删除key
+func execGetDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return reply.MakeNullBulkReply()
+	}
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("DEL", key))
+	return reply.MakeBulkReply(val)
+}
+
+// getex key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+func execGetEX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var expireTime time.Time
+	hasExpire, persist := false, false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "PERSIST":
+			if hasExpire {
+				return reply.MakeSyntaxErrReply()
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || persist || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			var errReply resp.Reply
+			expireTime, errReply = parseExpireOption("getex", option, args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			hasExpire = true
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	val, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return reply.MakeNullBulkReply()
+	}
+	if hasExpire {
+		db.Expire(key, expireTime)
+		db.addAof(makeExpireCmd(key, expireTime))
+	} else if persist && db.Persist(key) > 0 {
+		db.addAof(utils.ToCmdLine("PERSIST", key))
 	}
-	return reply.MakeIntReply(int64(len(entity.Data.([]byte))))
+	return reply.MakeBulkReply(val)
 }
 
 func init() {
-	RegisterCommand("get", execGet, 1)
-	RegisterCommand("set", execSet, 2)
-	RegisterCommand("setnx", execSetNX, 2)
-	RegisterCommand("setex", execSetEX, 2)
-	RegisterCommand("getset", execGetSet, 2)
-	RegisterCommand("strlen", execStrLen, 1)
+	RegisterCommand("get", execGet, 1, WithPrepare(readFirstKey), WithCategories(catString))
+	RegisterCommand("set", execSet, -2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("setnx", execSetNX, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("setex", execSetEX, 3, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("psetex", execPSetEX, 3, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("getset", execGetSet, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("strlen", execStrLen, 1, WithPrepare(readFirstKey), WithCategories(catString))
+	RegisterCommand("incr", execIncr, 1, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("decr", execDecr, 1, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("incrby", execIncrBy, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("decrby", execDecrBy, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("incrbyfloat", execIncrByFloat, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("append", execAppend, 2, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("getrange", execGetRange, 3, WithPrepare(readFirstKey), WithCategories(catString))
+	RegisterCommand("setrange", execSetRange, 3, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("mget", execMGet, -1, WithPrepare(readAllKeys), WithCategories(catString))
+	RegisterCommand("mset", execMSet, -2, WithPrepare(writeEvenKeys), WithCategories(catString))
+	RegisterCommand("msetnx", execMSetNX, -2, WithPrepare(writeEvenKeys), WithCategories(catString))
+	RegisterCommand("getdel", execGetDel, 1, WithPrepare(writeFirstKey), WithCategories(catString))
+	RegisterCommand("getex", execGetEX, -1, WithPrepare(writeFirstKey), WithCategories(catString))
 }
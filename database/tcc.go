@@ -0,0 +1,291 @@
+package database
+
+import (
+	"bytes"
+	"redis-go/aof"
+	"redis-go/constant"
+	"redis-go/interface/resp"
+	"redis-go/lib/logger"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 集群模式下的分布式事务(try-commit-rollback)，参与事务的节点部分
+// 准备阶段锁定命令涉及的key并检查命令能否执行，同时记录key当前的数据作为undo日志，
+// 提交阶段执行命令并释放锁，协调者发现某个节点失败时通知所有节点回滚，已经提交的节点通过undo日志恢复数据
+// 事务的key锁跨越多次请求，pauseMu 只在提交和回滚修改数据时持有，保证aof重写、保存快照等操作的数据分界点一致
+
+// ErrKeyExists 目标key已经存在，renamenx 和 msetnx 无法执行
+const ErrKeyExists = "key already exists"
+
+// txTimeout 事务准备之后超过这个时间没有提交或回滚时自动回滚，防止协调者异常时key一直被锁定
+// 已经提交的事务在超时之后删除undo日志，之后无法再回滚
+const txTimeout = 10 * time.Second
+
+// 事务的状态
+const (
+	txPrepared   = "prepared"
+	txCommitted  = "committed"
+	txRolledBack = "rolledback"
+)
+
+// txCommand 可以在分布式事务中执行的命令
+type txCommand struct {
+	prepare PreFunc
+	// check 准备阶段检查命令能否执行，返回错误时放弃事务，返回nil或者需要交给协调者的数据时继续
+	check func(db *DB, args [][]byte) resp.Reply
+	exec  ExecFunc
+}
+
+// txCmdTable 分布式事务中每个节点执行的命令，rename 拆分为源节点的 renamefrom 和目标节点的 renameto
+var txCmdTable = map[string]*txCommand{
+	"del":        {prepare: writeAllKeys, exec: execDel},
+	"msetnx":     {prepare: writeEvenKeys, check: checkKeysAbsent(writeEvenKeys), exec: execMSetNX},
+	"renamefrom": {prepare: writeFirstKey, check: checkRenameFrom, exec: execRenameFrom},
+	"renameto":   {prepare: writeFirstKey, exec: execRenameTo},
+	"renamenxto": {prepare: writeFirstKey, check: checkKeysAbsent(writeFirstKey), exec: execRenameTo},
+}
+
+// Transaction 某个节点上的分布式事务
+type Transaction struct {
+	id        string
+	db        *DB
+	cmdLine   constant.CommandLine
+	cmd       *txCommand
+	writeKeys []string
+	undoLog   []constant.CommandLine // 按顺序执行后可以恢复key在事务之前的数据
+	status    string
+	mu        sync.Mutex
+	timer     *time.Timer
+}
+
+// PrepareTx 准备事务，锁定key并记录undo日志，事务在客户端当前选择的db上执行
+// _prepare txID cmd [arg ...]
+func (s *StandaloneDatabase) PrepareTx(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("_prepare")
+	}
+	txID := string(args[0])
+	cmdLine := args[1:]
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := txCmdTable[cmdName]
+	if !ok {
+		return reply.MakeStandardErrorReply("ERR command '" + cmdName + "' cannot be used in a transaction")
+	}
+	if len(cmdLine) < 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	if raw, exists := s.transactions.Load(txID); exists {
+		return reply.MakeStandardErrorReply("ERR transaction " + txID + " is " + raw.(*Transaction).status)
+	}
+	tx := &Transaction{
+		id:      txID,
+		db:      s.dbSet[client.GetDBIndex()],
+		cmdLine: cmdLine,
+		cmd:     cmd,
+		status:  txPrepared,
+	}
+	tx.writeKeys, _ = cmd.prepare(cmdLine[1:])
+	tx.db.locker.RWLocks(tx.writeKeys, nil)
+	result := resp.Reply(reply.MakeOKReply())
+	if cmd.check != nil {
+		if res := cmd.check(tx.db, cmdLine[1:]); res != nil {
+			if reply.IsErrReply(res) {
+				tx.db.locker.RWUnLocks(tx.writeKeys, nil)
+				return res
+			}
+			result = res
+		}
+	}
+	tx.undoLog = tx.db.makeUndoLog(tx.writeKeys)
+	tx.timer = time.AfterFunc(txTimeout, func() {
+		s.expireTx(tx)
+	})
+	// 准备期间协调者可能已经超时并发送了回滚，此时已经存在回滚的记录，放弃准备
+	if raw, loaded := s.transactions.LoadOrStore(txID, tx); loaded {
+		tx.timer.Stop()
+		tx.db.locker.RWUnLocks(tx.writeKeys, nil)
+		return reply.MakeStandardErrorReply("ERR transaction " + txID + " is " + raw.(*Transaction).status)
+	}
+	return result
+}
+
+// CommitTx 提交事务，执行命令并释放锁
+// _commit txID
+func (s *StandaloneDatabase) CommitTx(args [][]byte) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("_commit")
+	}
+	tx, errReply := s.loadTx(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != txPrepared {
+		return reply.MakeStandardErrorReply("ERR transaction " + tx.id + " is " + tx.status)
+	}
+	s.pauseMu.RLock()
+	tx.db.addVersion(tx.writeKeys...)
+	result := tx.cmd.exec(tx.db, tx.cmdLine[1:])
+	s.pauseMu.RUnlock()
+	tx.db.locker.RWUnLocks(tx.writeKeys, nil)
+	tx.status = txCommitted
+	return result
+}
+
+// RollbackTx 回滚事务，已经提交的事务通过undo日志恢复数据
+// _rollback txID
+func (s *StandaloneDatabase) RollbackTx(args [][]byte) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("_rollback")
+	}
+	// 回滚先于准备到达时记录已经回滚，超时之前到达的准备会被拒绝，避免key一直被锁定到超时
+	txID := string(args[0])
+	tombstone := &Transaction{id: txID, status: txRolledBack}
+	tombstone.timer = time.AfterFunc(txTimeout, func() {
+		s.expireTx(tombstone)
+	})
+	raw, loaded := s.transactions.LoadOrStore(txID, tombstone)
+	if !loaded {
+		return reply.MakeOKReply()
+	}
+	tombstone.timer.Stop()
+	s.rollbackTx(raw.(*Transaction), false)
+	return reply.MakeOKReply()
+}
+
+func (s *StandaloneDatabase) loadTx(txID string) (*Transaction, resp.Reply) {
+	raw, ok := s.transactions.Load(txID)
+	if !ok {
+		return nil, reply.MakeStandardErrorReply("ERR transaction " + txID + " not found")
+	}
+	return raw.(*Transaction), nil
+}
+
+// rollbackTx 回滚事务，onlyPrepared 为true时不回滚已经提交的事务
+func (s *StandaloneDatabase) rollbackTx(tx *Transaction, onlyPrepared bool) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if onlyPrepared && tx.status != txPrepared {
+		return
+	}
+	switch tx.status {
+	case txPrepared:
+		tx.db.locker.RWUnLocks(tx.writeKeys, nil)
+	case txCommitted:
+		// 和普通命令一样先持有 pauseMu 再锁定key
+		s.pauseMu.RLock()
+		tx.db.locker.RWLocks(tx.writeKeys, nil)
+		tx.db.addVersion(tx.writeKeys...)
+		for _, cmdLine := range tx.undoLog {
+			tx.db.execWithoutLock(cmdLine)
+		}
+		tx.db.locker.RWUnLocks(tx.writeKeys, nil)
+		s.pauseMu.RUnlock()
+	default:
+		return
+	}
+	tx.status = txRolledBack
+}
+
+// expireTx 事务超时，未提交的事务自动回滚，之后删除事务
+func (s *StandaloneDatabase) expireTx(tx *Transaction) {
+	tx.mu.Lock()
+	if tx.status == txPrepared {
+		logger.Info("[transaction] " + tx.id + " timeout, rollback")
+	}
+	tx.mu.Unlock()
+	s.rollbackTx(tx, true)
+	s.transactions.Delete(tx.id)
+}
+
+// stopTransactions 关闭时回滚所有未提交的事务
+func (s *StandaloneDatabase) stopTransactions() {
+	s.transactions.Range(func(key, value any) bool {
+		tx := value.(*Transaction)
+		tx.timer.Stop()
+		s.expireTx(tx)
+		return true
+	})
+}
+
+// makeUndoLog 生成恢复key当前数据的命令，调用方需要持有key的锁
+func (db *DB) makeUndoLog(keys []string) []constant.CommandLine {
+	undoLog := make([]constant.CommandLine, 0, len(keys)*2)
+	for _, key := range keys {
+		undoLog = append(undoLog, utils.ToCmdLine("DEL", key))
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		if cmd := aof.EntityToCmd(key, &entity); cmd != nil {
+			undoLog = append(undoLog, cmd)
+		}
+		if expireTime, ok := db.TTL(key); ok {
+			undoLog = append(undoLog, aof.MakeExpireCmd(key, expireTime))
+		}
+	}
+	return undoLog
+}
+
+// checkKeysAbsent 检查key都不存在
+func checkKeysAbsent(prepare PreFunc) func(db *DB, args [][]byte) resp.Reply {
+	return func(db *DB, args [][]byte) resp.Reply {
+		keys, _ := prepare(args)
+		for _, key := range keys {
+			if _, exists := db.GetEntity(key); exists {
+				return reply.MakeStandardErrorReply(ErrKeyExists)
+			}
+		}
+		return nil
+	}
+}
+
+// checkRenameFrom renamefrom src dst，检查源key存在，并把数据转换为写入dst的命令交给协调者，由协调者发送给目标节点
+func checkRenameFrom(db *DB, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("renamefrom")
+	}
+	src, dst := string(args[0]), string(args[1])
+	entity, exists := db.GetEntity(src)
+	if !exists {
+		return reply.MakeStandardErrorReply("no such key")
+	}
+	buf := &bytes.Buffer{}
+	buf.Write(reply.MakeMultiBulkReply(aof.EntityToCmd(dst, &entity)).ToBytes())
+	if expireTime, ok := db.TTL(src); ok {
+		buf.Write(reply.MakeMultiBulkReply(aof.MakeExpireCmd(dst, expireTime)).ToBytes())
+	}
+	return reply.MakeBulkReply(buf.Bytes())
+}
+
+// execRenameFrom renamefrom src dst，删除源key
+func execRenameFrom(db *DB, args [][]byte) resp.Reply {
+	db.Remove(string(args[0]))
+	db.addAof(utils.ToCmdLine("DEL", string(args[0])))
+	return reply.MakeOKReply()
+}
+
+// execRenameTo renameto dst data，使用源节点生成的命令重建目标key，原有的数据和过期时间作废
+func execRenameTo(db *DB, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("renameto")
+	}
+	var cmdLines []constant.CommandLine
+	_, err := aof.ReadCommands(bytes.NewReader(args[1]), 0, func(cmdLine constant.CommandLine, _ int64) bool {
+		cmdLines = append(cmdLines, cmdLine)
+		return true
+	})
+	if err != nil {
+		return reply.MakeStandardErrorReply("ERR invalid rename data: " + err.Error())
+	}
+	execDel(db, args[:1])
+	for _, cmdLine := range cmdLines {
+		db.execWithoutLock(cmdLine)
+	}
+	return reply.MakeOKReply()
+}
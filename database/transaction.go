@@ -0,0 +1,219 @@
+package database
+
+import (
+	"errors"
+	"redis-go/constant"
+	"redis-go/interface/resp"
+	"redis-go/lib/utils"
+	"redis-go/resp/reply"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 事务实现，包含multi，exec，discard，watch，unwatch命令
+// 事务中的命令在exec时统一加锁执行，watch基于key的版本号实现乐观锁
+
+// startMulti multi，开启事务
+func startMulti(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("multi")
+	}
+	if c.InMultiState() {
+		return reply.MakeStandardErrorReply("ERR MULTI calls can not be nested")
+	}
+	c.SetMultiState(true)
+	return reply.MakeOKReply()
+}
+
+// enqueueCmd 事务中的命令入队，命令不存在或者参数个数错误时记录错误，exec时会放弃整个事务
+func enqueueCmd(c resp.Connection, cmdLine constant.CommandLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		errReply := reply.MakeStandardErrorReply("ERR unknown command '" + cmdName + "'")
+		c.AddTxError(errors.New(errReply.Status))
+		return errReply
+	}
+	if !ValidateArity(cmd.arity, cmdLine[1:]) {
+		errReply := reply.MakeArgNumErrReply(cmdName)
+		c.AddTxError(errReply)
+		return errReply
+	}
+	c.EnqueueCmd(cmdLine)
+	return reply.MakeStatusReply("QUEUED")
+}
+
+// discardMulti discard，放弃事务
+func discardMulti(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("discard")
+	}
+	if !c.InMultiState() {
+		return reply.MakeStandardErrorReply("ERR DISCARD without MULTI")
+	}
+	c.SetMultiState(false)
+	return reply.MakeOKReply()
+}
+
+// execMulti exec，执行事务中排队的命令，getDB 返回编号对应的db，编号不存在时返回nil
+// execOther 执行事务中不在cmdTable中的命令，如 publish
+func execMulti(getDB func(index int) *DB, execOther ExecOtherFunc, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("exec")
+	}
+	if !c.InMultiState() {
+		return reply.MakeStandardErrorReply("ERR EXEC without MULTI")
+	}
+	// 无论执行结果如何，exec之后都会退出事务状态并取消所有的watch
+	defer c.SetMultiState(false)
+	if len(c.GetTxErrors()) > 0 {
+		return reply.MakeStandardErrorReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return ExecMulti(getDB, execOther, c, c.GetWatching(), c.GetQueuedCmdLine())
+}
+
+// ExecOtherFunc 执行事务中不在cmdTable中的命令，这些命令不涉及key，执行时不需要加锁
+type ExecOtherFunc func(c resp.Connection, cmdLine [][]byte) resp.Reply
+
+// txKeys 事务在某个db中需要锁定的key
+type txKeys struct {
+	write []string
+	read  []string
+}
+
+// ExecMulti 原子地执行一组命令，watch的key发生变化时放弃执行并返回nil
+// 执行过程中某个命令出错不会影响其他命令的执行，和redis保持一致不进行回滚
+// 事务中的select切换之后命令所在的db，执行完成后连接停留在最后选择的db
+func ExecMulti(getDB func(index int) *DB, execOther ExecOtherFunc, c resp.Connection, watching map[resp.WatchKey]uint32, cmdLines [][][]byte) resp.Reply {
+	// 1. 按照命令执行时所在的db收集所有命令涉及的key，watch的key也需要加读锁，防止检查版本号时被修改
+	keys := make(map[*DB]*txKeys)
+	keysOf := func(db *DB) *txKeys {
+		if keys[db] == nil {
+			keys[db] = &txKeys{}
+		}
+		return keys[db]
+	}
+	db := getDB(c.GetDBIndex())
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if cmdName == "select" {
+			if index, err := strconv.Atoi(string(cmdLine[1])); err == nil && getDB(index) != nil {
+				db = getDB(index)
+			}
+			continue
+		}
+		cmd, ok := cmdTable[cmdName]
+		if !ok || cmd.prepare == nil {
+			continue
+		}
+		write, read := cmd.prepare(cmdLine[1:])
+		keysOf(db).write = append(keysOf(db).write, write...)
+		keysOf(db).read = append(keysOf(db).read, read...)
+	}
+	for key := range watching {
+		keysOf(getDB(key.DBIndex)).read = append(keysOf(getDB(key.DBIndex)).read, key.Key)
+	}
+	// 多个db按照编号的顺序加锁，避免和其他事务死锁
+	dbs := make([]*DB, 0, len(keys))
+	for db := range keys {
+		dbs = append(dbs, db)
+	}
+	slices.SortFunc(dbs, func(a, b *DB) int {
+		return a.index - b.index
+	})
+	for _, db := range dbs {
+		db.locker.RWLocks(keys[db].write, keys[db].read)
+	}
+	defer func() {
+		for _, db := range dbs {
+			db.locker.RWUnLocks(keys[db].write, keys[db].read)
+		}
+	}()
+
+	// 2. 检查watch的key是否被修改过，已经过期的key也视为被修改
+	for key, version := range watching {
+		db := getDB(key.DBIndex)
+		db.expireIfNeeded(key.Key)
+		if db.GetVersion(key.Key) != version {
+			return reply.MakeNullMultiBulkReply()
+		}
+	}
+	for _, db := range dbs {
+		db.addVersion(keys[db].write...)
+	}
+
+	// 3. 依次执行命令，期间产生的aof命令先收集起来，最后使用 multi/exec 包裹后一次性写入
+	// 这样aof回放时只会完整地执行整个事务，不会出现只回放了一部分命令的情况
+	// 在其他db中写入时补充select命令，事务之后再切换回开始时的db
+	startDB := getDB(c.GetDBIndex())
+	aofIndex := startDB.index
+	lines := make([]constant.CommandLine, 0)
+	txDBs := make(map[*DB]*DB)
+	replies := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if cmdName == "select" {
+			replies = append(replies, selectDB(c, getDB, cmdLine[1:]))
+			continue
+		}
+		if _, ok := cmdTable[cmdName]; !ok {
+			replies = append(replies, execOther(c, cmdLine))
+			continue
+		}
+		db := getDB(c.GetDBIndex())
+		txDB, ok := txDBs[db]
+		if !ok {
+			dbCopy := *db
+			dbCopy.addAof = func(cmdLines ...constant.CommandLine) {
+				if db.index != aofIndex {
+					lines = append(lines, utils.ToCmdLine("SELECT", strconv.Itoa(db.index)))
+					aofIndex = db.index
+				}
+				lines = append(lines, cmdLines...)
+			}
+			txDB = &dbCopy
+			txDBs[db] = txDB
+		}
+		replies = append(replies, txDB.execWithoutLock(cmdLine))
+	}
+	if len(lines) > 0 {
+		aofLines := make([]constant.CommandLine, 0, len(lines)+3)
+		aofLines = append(aofLines, utils.ToCmdLine("MULTI"))
+		aofLines = append(aofLines, lines...)
+		aofLines = append(aofLines, utils.ToCmdLine("EXEC"))
+		if aofIndex != startDB.index {
+			aofLines = append(aofLines, utils.ToCmdLine("SELECT", strconv.Itoa(startDB.index)))
+		}
+		startDB.addAof(aofLines...)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execWatch watch key [key ...]，记录key当前的版本号
+func execWatch(db *DB, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("watch")
+	}
+	if c.InMultiState() {
+		return reply.MakeStandardErrorReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := c.GetWatching()
+	for _, arg := range args {
+		key := string(arg)
+		watching[resp.WatchKey{DBIndex: db.index, Key: key}] = db.GetVersion(key)
+	}
+	return reply.MakeOKReply()
+}
+
+// execUnwatch unwatch，取消所有的watch
+func execUnwatch(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("unwatch")
+	}
+	watching := c.GetWatching()
+	for key := range watching {
+		delete(watching, key)
+	}
+	return reply.MakeOKReply()
+}
@@ -0,0 +1,106 @@
+package dict
+
+// SimpleDict 基于原生map实现的字典，非并发安全
+// 用作hash、set等数据类型的底层存储，并发控制由上层的db负责
+type SimpleDict struct {
+	m map[string]interface{}
+}
+
+func MakeSimpleDict() *SimpleDict {
+	return &SimpleDict{
+		m: make(map[string]interface{}),
+	}
+}
+
+func (d *SimpleDict) Get(key string) (val interface{}, exist bool) {
+	val, exist = d.m[key]
+	return
+}
+
+func (d *SimpleDict) Len() int {
+	return len(d.m)
+}
+
+func (d *SimpleDict) Put(key string, value interface{}) (result int) {
+	_, existed := d.m[key]
+	d.m[key] = value
+	if existed {
+		return 0
+	}
+	return 1
+}
+
+func (d *SimpleDict) PutIfAbsent(key string, value interface{}) (result int) {
+	if _, existed := d.m[key]; existed {
+		return 0
+	}
+	d.m[key] = value
+	return 1
+}
+
+func (d *SimpleDict) PutIfExists(key string, value interface{}) (result int) {
+	if _, existed := d.m[key]; !existed {
+		return 0
+	}
+	d.m[key] = value
+	return 1
+}
+
+func (d *SimpleDict) Remove(key string) (result int) {
+	if _, existed := d.m[key]; !existed {
+		return 0
+	}
+	delete(d.m, key)
+	return 1
+}
+
+func (d *SimpleDict) ForEach(consumer Consumer) {
+	for k, v := range d.m {
+		if !consumer(k, v) {
+			break
+		}
+	}
+}
+
+func (d *SimpleDict) Keys() []string {
+	keys := make([]string, 0, len(d.m))
+	for k := range d.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (d *SimpleDict) RandomKeys(n int) (keys []string) {
+	// 每次随机返回一个，返回列表可重复，map的遍历顺序本身是随机的
+	if len(d.m) == 0 || n <= 0 {
+		return []string{}
+	}
+	// n 可能很大，预分配的空间不超过字典的大小，之后按需扩容
+	keys = make([]string, 0, min(n, len(d.m)))
+	for i := 0; i < n; i++ {
+		for k := range d.m {
+			keys = append(keys, k)
+			break
+		}
+	}
+	return keys
+}
+
+func (d *SimpleDict) RandomDistinctKeys(n int) (keys []string) {
+	keys = make([]string, 0, max(min(n, len(d.m)), 0))
+	if n <= 0 {
+		return keys
+	}
+	// 尝试最大可能的返回，如果字典不够的话进行截断返回
+	for k := range d.m {
+		keys = append(keys, k)
+		if len(keys) >= n {
+			break
+		}
+	}
+	return keys
+}
+
+func (d *SimpleDict) Clear() {
+	*d = *MakeSimpleDict()
+}
@@ -46,17 +46,14 @@ func (s *SyncDict) PutIfAbsent(key string, value interface{}) (result int) {
 }
 
 func (s *SyncDict) PutIfExists(key string, value interface{}) (result int) {
-	// CAS锁尝试插入，自旋操作
-	for {
-		load, ok := s.m.Load(key)
-		if !ok {
-			return 0
-		}
-		// 乐观锁尝试插入
-		if s.m.CompareAndSwap(key, load, value) {
-			return 1
-		}
+	// 值可能是[]byte这类不可比较的类型，CompareAndSwap会直接panic，这里退化为加锁后写入
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.m.Load(key); !ok {
+		return 0
 	}
+	s.m.Store(key, value)
+	return 1
 }
 
 func (s *SyncDict) Remove(key string) (result int) {
@@ -85,7 +82,7 @@ func (s *SyncDict) Keys() []string {
 
 func (s *SyncDict) RandomKeys(n int) (keys []string) {
 	// 每次随机返回一个，返回列表可重复
-	keys = make([]string, n)
+	keys = make([]string, 0, n)
 	for i := 0; i < n; i++ {
 		s.m.Range(func(key, value interface{}) bool {
 			keys = append(keys, key.(string))
@@ -96,7 +93,10 @@ func (s *SyncDict) RandomKeys(n int) (keys []string) {
 }
 
 func (s *SyncDict) RandomDistinctKeys(n int) (keys []string) {
-	keys = make([]string, n)
+	keys = make([]string, 0, n)
+	if n <= 0 {
+		return keys
+	}
 	// 尝试最大可能的返回，如果字典不够的话进行截断返回
 	s.m.Range(func(key, value interface{}) bool {
 		keys = append(keys, key.(string))
@@ -0,0 +1,26 @@
+package list
+
+// Expected 判断元素是否符合预期的方法，用于按值查找和删除
+type Expected func(a interface{}) bool
+
+// Consumer 遍历方法，返回false时停止遍历
+type Consumer func(i int, v interface{}) bool
+
+// List 列表存储基础数据结构接口，下标从0开始
+type List interface {
+	Add(val interface{})                                 // 尾部追加
+	AddFirst(val interface{})                            // 头部插入
+	Get(index int) (val interface{})                     // 获取指定下标的元素
+	Set(index int, val interface{})                      // 修改指定下标的元素
+	Insert(index int, val interface{})                   // 在指定下标插入元素，原有元素后移
+	Remove(index int) (val interface{})                  // 删除指定下标的元素
+	RemoveFirst() (val interface{})                      // 删除头部元素
+	RemoveLast() (val interface{})                       // 删除尾部元素
+	RemoveAllByVal(expected Expected) int                // 删除全部符合条件的元素
+	RemoveByVal(expected Expected, count int) int        // 从头部开始删除最多count个符合条件的元素
+	ReverseRemoveByVal(expected Expected, count int) int // 从尾部开始删除最多count个符合条件的元素
+	IndexOf(expected Expected) int                       // 返回第一个符合条件的元素下标，不存在返回-1
+	Len() int                                            // 元素个数
+	ForEach(consumer Consumer)                           // 从头到尾遍历
+	Range(start int, stop int) []interface{}             // 返回 [start, stop) 区间的元素
+}
@@ -0,0 +1,388 @@
+package list
+
+import "container/list"
+
+// pageSize 每个分页的最大元素个数
+const pageSize = 1024
+
+// QuickList 快速列表，由若干容量固定的分页串联成的双向链表
+// 相比普通链表减少了大量的指针开销，相比数组在头尾插入删除时不需要整体搬移数据
+type QuickList struct {
+	data *list.List // 每个节点都是一个 []interface{} 分页
+	size int
+}
+
+// iterator 快速列表的迭代器，定位到某个分页中的某个元素
+type iterator struct {
+	node   *list.Element
+	offset int
+	ql     *QuickList
+}
+
+func MakeQuickList() *QuickList {
+	return &QuickList{
+		data: list.New(),
+	}
+}
+
+// Add 尾部追加元素
+func (ql *QuickList) Add(val interface{}) {
+	ql.size++
+	if ql.data.Len() == 0 {
+		page := make([]interface{}, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+	backNode := ql.data.Back()
+	backPage := backNode.Value.([]interface{})
+	if len(backPage) == cap(backPage) {
+		// 尾部分页已满，新建分页
+		page := make([]interface{}, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+	backNode.Value = append(backPage, val)
+}
+
+// AddFirst 头部插入元素
+func (ql *QuickList) AddFirst(val interface{}) {
+	if ql.data.Len() > 0 && len(ql.data.Front().Value.([]interface{})) >= pageSize {
+		// 头部分页已满，直接新建分页，避免拆分分页
+		ql.size++
+		page := make([]interface{}, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushFront(page)
+		return
+	}
+	ql.Insert(0, val)
+}
+
+// find 根据下标定位迭代器，下标在前半段从头部开始查找，否则从尾部开始查找
+func (ql *QuickList) find(index int) *iterator {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if index < 0 || index >= ql.size {
+		panic("index out of bound")
+	}
+	var n *list.Element
+	var page []interface{}
+	var pageBeg int
+	if index < ql.size/2 {
+		n = ql.data.Front()
+		pageBeg = 0
+		for {
+			page = n.Value.([]interface{})
+			if pageBeg+len(page) > index {
+				break
+			}
+			pageBeg += len(page)
+			n = n.Next()
+		}
+	} else {
+		n = ql.data.Back()
+		pageBeg = ql.size
+		for {
+			page = n.Value.([]interface{})
+			pageBeg -= len(page)
+			if pageBeg <= index {
+				break
+			}
+			n = n.Prev()
+		}
+	}
+	return &iterator{
+		node:   n,
+		offset: index - pageBeg,
+		ql:     ql,
+	}
+}
+
+func (iter *iterator) get() interface{} {
+	return iter.page()[iter.offset]
+}
+
+func (iter *iterator) page() []interface{} {
+	return iter.node.Value.([]interface{})
+}
+
+// next 迭代器后移，返回false表示已经到达末尾
+func (iter *iterator) next() bool {
+	page := iter.page()
+	if iter.offset < len(page)-1 {
+		iter.offset++
+		return true
+	}
+	// 当前分页已经遍历完
+	if iter.node == iter.ql.data.Back() {
+		iter.offset = len(page)
+		return false
+	}
+	iter.offset = 0
+	iter.node = iter.node.Next()
+	return true
+}
+
+// prev 迭代器前移，返回false表示已经到达头部
+func (iter *iterator) prev() bool {
+	if iter.offset > 0 {
+		iter.offset--
+		return true
+	}
+	if iter.node == iter.ql.data.Front() {
+		iter.offset = -1
+		return false
+	}
+	iter.node = iter.node.Prev()
+	prevPage := iter.node.Value.([]interface{})
+	iter.offset = len(prevPage) - 1
+	return true
+}
+
+func (iter *iterator) atEnd() bool {
+	if iter.ql.data.Len() == 0 {
+		return true
+	}
+	if iter.node != iter.ql.data.Back() {
+		return false
+	}
+	page := iter.page()
+	return iter.offset == len(page)
+}
+
+func (iter *iterator) atBegin() bool {
+	if iter.ql.data.Len() == 0 {
+		return true
+	}
+	if iter.node != iter.ql.data.Front() {
+		return false
+	}
+	return iter.offset == -1
+}
+
+func (iter *iterator) set(val interface{}) {
+	page := iter.page()
+	page[iter.offset] = val
+}
+
+// remove 删除迭代器指向的元素，删除后迭代器指向下一个元素
+func (iter *iterator) remove() interface{} {
+	page := iter.page()
+	val := page[iter.offset]
+	switch {
+	case iter.offset == 0:
+		// 删除分页头部，直接截断即可
+		page = page[1:]
+	case iter.offset == len(page)-1:
+		page = page[:iter.offset]
+	default:
+		page = append(page[:iter.offset], page[iter.offset+1:]...)
+	}
+	iter.ql.size--
+	if len(page) > 0 {
+		iter.node.Value = page
+		if iter.offset == len(page) {
+			// 删除的是分页的最后一个元素，迭代器移动到下一个分页
+			if iter.node != iter.ql.data.Back() {
+				iter.node = iter.node.Next()
+				iter.offset = 0
+			}
+		}
+		return val
+	}
+	// 分页已空，删除整个分页
+	if iter.node == iter.ql.data.Back() {
+		if prevNode := iter.node.Prev(); prevNode != nil {
+			iter.ql.data.Remove(iter.node)
+			iter.node = prevNode
+			iter.offset = len(prevNode.Value.([]interface{}))
+			return val
+		}
+		// 唯一的分页被删除
+		iter.ql.data.Remove(iter.node)
+		iter.node = nil
+		iter.offset = 0
+		return val
+	}
+	nextNode := iter.node.Next()
+	iter.ql.data.Remove(iter.node)
+	iter.node = nextNode
+	iter.offset = 0
+	return val
+}
+
+// Get 获取指定下标的元素
+func (ql *QuickList) Get(index int) (val interface{}) {
+	iter := ql.find(index)
+	return iter.get()
+}
+
+// Set 修改指定下标的元素
+func (ql *QuickList) Set(index int, val interface{}) {
+	iter := ql.find(index)
+	iter.set(val)
+}
+
+// Insert 在指定下标插入元素，分页已满时将分页拆分为两半
+func (ql *QuickList) Insert(index int, val interface{}) {
+	if index == ql.size {
+		ql.Add(val)
+		return
+	}
+	iter := ql.find(index)
+	page := iter.node.Value.([]interface{})
+	if len(page) < pageSize {
+		// 分页未满，直接插入
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+		iter.node.Value = page
+		ql.size++
+		return
+	}
+	// 分页已满，拆分成两个分页
+	var nextPage []interface{}
+	nextPage = append(nextPage, page[pageSize/2:]...)
+	page = page[:pageSize/2]
+	if iter.offset < len(page) {
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+	} else {
+		i := iter.offset - pageSize/2
+		nextPage = append(nextPage[:i+1], nextPage[i:]...)
+		nextPage[i] = val
+	}
+	iter.node.Value = page
+	ql.data.InsertAfter(nextPage, iter.node)
+	ql.size++
+}
+
+// Remove 删除指定下标的元素
+func (ql *QuickList) Remove(index int) interface{} {
+	iter := ql.find(index)
+	return iter.remove()
+}
+
+// RemoveFirst 删除头部元素，列表为空时返回nil
+func (ql *QuickList) RemoveFirst() interface{} {
+	if ql.size == 0 {
+		return nil
+	}
+	return ql.Remove(0)
+}
+
+// RemoveLast 删除尾部元素，列表为空时返回nil
+func (ql *QuickList) RemoveLast() interface{} {
+	if ql.size == 0 {
+		return nil
+	}
+	return ql.Remove(ql.size - 1)
+}
+
+// Len 返回元素个数
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+// ForEach 从头到尾遍历，consumer返回false时停止
+func (ql *QuickList) ForEach(consumer Consumer) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if ql.Len() == 0 {
+		return
+	}
+	iter := ql.find(0)
+	i := 0
+	for {
+		goNext := consumer(i, iter.get())
+		if !goNext {
+			break
+		}
+		i++
+		if !iter.next() {
+			break
+		}
+	}
+}
+
+// IndexOf 返回第一个符合条件的元素下标
+func (ql *QuickList) IndexOf(expected Expected) int {
+	index := -1
+	ql.ForEach(func(i int, v interface{}) bool {
+		if expected(v) {
+			index = i
+			return false
+		}
+		return true
+	})
+	return index
+}
+
+// RemoveAllByVal 删除全部符合条件的元素，返回删除个数
+func (ql *QuickList) RemoveAllByVal(expected Expected) int {
+	return ql.RemoveByVal(expected, 0)
+}
+
+// RemoveByVal 从头部开始删除符合条件的元素，count<=0时删除全部，返回删除个数
+func (ql *QuickList) RemoveByVal(expected Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(0)
+	removed := 0
+	for !iter.atEnd() {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+			if removed == count || iter.node == nil {
+				break
+			}
+		} else {
+			iter.next()
+		}
+	}
+	return removed
+}
+
+// ReverseRemoveByVal 从尾部开始删除符合条件的元素，count<=0时删除全部，返回删除个数
+func (ql *QuickList) ReverseRemoveByVal(expected Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(ql.size - 1)
+	removed := 0
+	for !iter.atBegin() {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+			if removed == count || iter.node == nil {
+				break
+			}
+		}
+		// 删除后迭代器指向下一个元素，前移一位即可继续向头部遍历
+		iter.prev()
+	}
+	return removed
+}
+
+// Range 返回 [start, stop) 区间内的元素
+func (ql *QuickList) Range(start int, stop int) []interface{} {
+	if start < 0 || start >= ql.Len() {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > ql.Len() {
+		panic("`stop` out of range")
+	}
+	sliceSize := stop - start
+	slice := make([]interface{}, 0, sliceSize)
+	iter := ql.find(start)
+	i := 0
+	for i < sliceSize {
+		slice = append(slice, iter.get())
+		iter.next()
+		i++
+	}
+	return slice
+}
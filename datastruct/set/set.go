@@ -0,0 +1,132 @@
+package set
+
+import "redis-go/datastruct/dict"
+
+// Set 无序集合，基于 dict.Dict 实现，成员作为字典的key，值为空
+type Set struct {
+	dict dict.Dict
+}
+
+// Make 创建集合，可以传入初始成员
+func Make(members ...string) *Set {
+	set := &Set{
+		dict: dict.MakeSimpleDict(),
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// Add 添加成员，返回新增的个数
+func (set *Set) Add(val string) int {
+	return set.dict.Put(val, nil)
+}
+
+// Remove 删除成员，返回删除的个数
+func (set *Set) Remove(val string) int {
+	return set.dict.Remove(val)
+}
+
+// Has 判断成员是否存在
+func (set *Set) Has(val string) bool {
+	if set == nil || set.dict == nil {
+		return false
+	}
+	_, exists := set.dict.Get(val)
+	return exists
+}
+
+// Len 返回成员个数
+func (set *Set) Len() int {
+	if set == nil || set.dict == nil {
+		return 0
+	}
+	return set.dict.Len()
+}
+
+// ToSlice 返回全部成员
+func (set *Set) ToSlice() []string {
+	return set.dict.Keys()
+}
+
+// ForEach 遍历成员，consumer返回false时停止
+func (set *Set) ForEach(consumer func(member string) bool) {
+	if set == nil || set.dict == nil {
+		return
+	}
+	set.dict.ForEach(func(key string, val interface{}) bool {
+		return consumer(key)
+	})
+}
+
+// Intersect 求交集，返回新的集合
+func Intersect(sets ...*Set) *Set {
+	result := Make()
+	if len(sets) == 0 {
+		return result
+	}
+	// 从最小的集合开始遍历，减少比较次数
+	smallest := sets[0]
+	for _, set := range sets[1:] {
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+	smallest.ForEach(func(member string) bool {
+		for _, set := range sets {
+			if !set.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Union 求并集，返回新的集合
+func Union(sets ...*Set) *Set {
+	result := Make()
+	for _, set := range sets {
+		set.ForEach(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// Diff 求差集，返回第一个集合中不存在于其它集合的成员
+func Diff(sets ...*Set) *Set {
+	result := Make()
+	if len(sets) == 0 {
+		return result
+	}
+	sets[0].ForEach(func(member string) bool {
+		for _, set := range sets[1:] {
+			if set.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// RandomMembers 随机返回limit个成员，成员可能重复
+func (set *Set) RandomMembers(limit int) []string {
+	if set == nil || set.dict == nil {
+		return nil
+	}
+	return set.dict.RandomKeys(limit)
+}
+
+// RandomDistinctMembers 随机返回limit个不重复的成员，集合不足limit个时返回全部
+func (set *Set) RandomDistinctMembers(limit int) []string {
+	if set == nil || set.dict == nil {
+		return nil
+	}
+	return set.dict.RandomDistinctKeys(limit)
+}
@@ -0,0 +1,167 @@
+package sortedset
+
+import (
+	"errors"
+	"strconv"
+)
+
+/*
+ * 区间边界，score区间和字典序区间共用同一套查询逻辑
+ * 	score边界: ZRANGEBYSCORE key (1 +inf，"(" 表示开区间，-inf/+inf 表示无穷
+ * 	字典序边界: ZRANGEBYLEX key [a (c，"[" 表示闭区间，"(" 表示开区间，"-"/"+" 表示无穷
+ */
+
+const (
+	negativeInf int8 = -1
+	positiveInf int8 = 1
+)
+
+// Border 区间边界接口
+type Border interface {
+	less(element *Element) bool    // 边界是否小于元素，作为下界使用，返回true表示元素满足下界
+	greater(element *Element) bool // 边界是否大于元素，作为上界使用，返回true表示元素满足上界
+	isIntersected(max Border) bool // 作为下界时，和上界max组成的区间是否非空
+}
+
+// ScoreBorder score区间边界
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+func (border *ScoreBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Score
+	}
+	return border.Value <= element.Score
+}
+
+func (border *ScoreBorder) greater(element *Element) bool {
+	if border.Inf == positiveInf {
+		return true
+	} else if border.Inf == negativeInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value > element.Score
+	}
+	return border.Value >= element.Score
+}
+
+func (border *ScoreBorder) isIntersected(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return false
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return false
+	}
+	if border.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return true
+	}
+	if border.Value > maxBorder.Value {
+		return false
+	}
+	return border.Value < maxBorder.Value || (!border.Exclude && !maxBorder.Exclude)
+}
+
+var errScoreBorder = errors.New("ERR min or max is not a float")
+
+// ParseScoreBorder 解析score边界
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	switch s {
+	case "inf", "+inf":
+		return &ScoreBorder{Inf: positiveInf}, nil
+	case "-inf":
+		return &ScoreBorder{Inf: negativeInf}, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, errScoreBorder
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
+
+// LexBorder 字典序区间边界
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Member
+	}
+	return border.Value <= element.Member
+}
+
+func (border *LexBorder) greater(element *Element) bool {
+	if border.Inf == positiveInf {
+		return true
+	} else if border.Inf == negativeInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value > element.Member
+	}
+	return border.Value >= element.Member
+}
+
+func (border *LexBorder) isIntersected(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return false
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return false
+	}
+	if border.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return true
+	}
+	if border.Value > maxBorder.Value {
+		return false
+	}
+	return border.Value < maxBorder.Value || (!border.Exclude && !maxBorder.Exclude)
+}
+
+var errLexBorder = errors.New("ERR min or max not valid string range item")
+
+// ParseLexBorder 解析字典序边界
+func ParseLexBorder(s string) (*LexBorder, error) {
+	switch s {
+	case "+":
+		return &LexBorder{Inf: positiveInf}, nil
+	case "-":
+		return &LexBorder{Inf: negativeInf}, nil
+	}
+	if len(s) == 0 {
+		return nil, errLexBorder
+	}
+	switch s[0] {
+	case '(':
+		return &LexBorder{Value: s[1:], Exclude: true}, nil
+	case '[':
+		return &LexBorder{Value: s[1:], Exclude: false}, nil
+	}
+	return nil, errLexBorder
+}
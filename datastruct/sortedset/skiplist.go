@@ -0,0 +1,310 @@
+package sortedset
+
+import "math/rand"
+
+const (
+	maxLevel = 16 // 跳表的最大层数
+)
+
+// Element 有序集合中的元素
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// Level 节点在某一层的信息
+type Level struct {
+	forward *node // 该层的下一个节点
+	span    int64 // 到下一个节点跨越的节点个数，用于计算排名
+}
+
+type node struct {
+	Element
+	backward *node    // 第0层的前一个节点，用于反向遍历
+	level    []*Level // level[0] 为最底层
+}
+
+// skiplist 跳表，按照 (score, member) 升序排列
+type skiplist struct {
+	header *node
+	tail   *node
+	length int64
+	level  int16
+}
+
+func makeNode(level int16, score float64, member string) *node {
+	n := &node{
+		Element: Element{
+			Score:  score,
+			Member: member,
+		},
+		level: make([]*Level, level),
+	}
+	for i := range n.level {
+		n.level[i] = new(Level)
+	}
+	return n
+}
+
+func makeSkiplist() *skiplist {
+	return &skiplist{
+		level:  1,
+		header: makeNode(maxLevel, 0, ""),
+	}
+}
+
+// randomLevel 随机生成节点层数，每升高一层的概率为 1/4
+func randomLevel() int16 {
+	level := int16(1)
+	for float32(rand.Int31()&0xFFFF) < (0.25 * 0xFFFF) {
+		level++
+	}
+	if level < maxLevel {
+		return level
+	}
+	return maxLevel
+}
+
+// lessThan 判断节点是否排在 (score, member) 之前
+func (n *node) lessThan(score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+func (sl *skiplist) insert(member string, score float64) *node {
+	update := make([]*node, maxLevel) // 每一层中新节点的前驱节点
+	rank := make([]int64, maxLevel)   // 每一层前驱节点的排名
+
+	// 逐层查找插入位置
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i == sl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for n.level[i].forward != nil && n.level[i].forward.lessThan(score, member) {
+			rank[i] += n.level[i].span
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+
+	level := randomLevel()
+	// 新节点的层数超过了当前层数，新增的层的前驱节点为头节点
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	// 插入新节点并更新跨度
+	n = makeNode(level, score, member)
+	for i := int16(0); i < level; i++ {
+		n.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = n
+		n.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// 更高层的前驱节点跨度加一
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] == sl.header {
+		n.backward = nil
+	} else {
+		n.backward = update[0]
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n
+	} else {
+		sl.tail = n
+	}
+	sl.length++
+	return n
+}
+
+// removeNode 删除节点，update为每一层的前驱节点
+func (sl *skiplist) removeNode(n *node, update []*node) {
+	for i := int16(0); i < sl.level; i++ {
+		if update[i].level[i].forward == n {
+			update[i].level[i].span += n.level[i].span - 1
+			update[i].level[i].forward = n.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n.backward
+	} else {
+		sl.tail = n.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// remove 删除指定元素，返回是否删除成功
+func (sl *skiplist) remove(member string, score float64) bool {
+	update := make([]*node, maxLevel)
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && n.level[i].forward.lessThan(score, member) {
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+	n = n.level[0].forward
+	if n != nil && score == n.Score && n.Member == member {
+		sl.removeNode(n, update)
+		return true
+	}
+	return false
+}
+
+// getRank 获取元素的排名，排名从1开始，元素不存在返回0
+func (sl *skiplist) getRank(member string, score float64) int64 {
+	var rank int64 = 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.lessThan(score, member) ||
+				(x.level[i].forward.Score == score && x.level[i].forward.Member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.header && x.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// getByRank 根据排名获取节点，排名从1开始
+func (sl *skiplist) getByRank(rank int64) *node {
+	var i int64 = 0
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && (i+n.level[level].span) <= rank {
+			i += n.level[level].span
+			n = n.level[level].forward
+		}
+		if i == rank {
+			return n
+		}
+	}
+	return nil
+}
+
+// hasInRange 判断跳表中是否存在区间内的元素
+func (sl *skiplist) hasInRange(min Border, max Border) bool {
+	if !min.isIntersected(max) {
+		return false
+	}
+	// 最大的元素小于下界
+	n := sl.tail
+	if n == nil || !min.less(&n.Element) {
+		return false
+	}
+	// 最小的元素大于上界
+	n = sl.header.level[0].forward
+	if n == nil || !max.greater(&n.Element) {
+		return false
+	}
+	return true
+}
+
+// getFirstInRange 获取区间内的第一个节点，不存在返回nil
+func (sl *skiplist) getFirstInRange(min Border, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		// 跳过所有不满足下界的节点
+		for n.level[level].forward != nil && !min.less(&n.level[level].forward.Element) {
+			n = n.level[level].forward
+		}
+	}
+	n = n.level[0].forward
+	if !max.greater(&n.Element) {
+		return nil
+	}
+	return n
+}
+
+// getLastInRange 获取区间内的最后一个节点，不存在返回nil
+func (sl *skiplist) getLastInRange(min Border, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		// 前进到最后一个满足上界的节点
+		for n.level[level].forward != nil && max.greater(&n.level[level].forward.Element) {
+			n = n.level[level].forward
+		}
+	}
+	if !min.less(&n.Element) {
+		return nil
+	}
+	return n
+}
+
+// RemoveRange 删除区间内的元素，limit<=0 表示不限制个数，返回被删除的元素
+func (sl *skiplist) RemoveRange(min Border, max Border, limit int) (removed []*Element) {
+	update := make([]*node, maxLevel)
+	removed = make([]*Element, 0)
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && !min.less(&n.level[i].forward.Element) {
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+	n = n.level[0].forward
+	for n != nil {
+		if !max.greater(&n.Element) {
+			break
+		}
+		next := n.level[0].forward
+		removedElement := n.Element
+		removed = append(removed, &removedElement)
+		sl.removeNode(n, update)
+		if limit > 0 && len(removed) == limit {
+			break
+		}
+		n = next
+	}
+	return removed
+}
+
+// RemoveRangeByRank 删除排名在 [start, stop) 之间的元素，排名从1开始
+func (sl *skiplist) RemoveRangeByRank(start int64, stop int64) (removed []*Element) {
+	var i int64 = 0
+	update := make([]*node, maxLevel)
+	removed = make([]*Element, 0)
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && (i+n.level[level].span) < start {
+			i += n.level[level].span
+			n = n.level[level].forward
+		}
+		update[level] = n
+	}
+	i++
+	n = n.level[0].forward
+	for n != nil && i < stop {
+		next := n.level[0].forward
+		removedElement := n.Element
+		removed = append(removed, &removedElement)
+		sl.removeNode(n, update)
+		n = next
+		i++
+	}
+	return removed
+}
@@ -0,0 +1,230 @@
+package sortedset
+
+import "errors"
+
+// SortedSet 有序集合，字典负责根据成员O(1)查找分数，跳表负责按照分数排序和范围查询
+type SortedSet struct {
+	dict     map[string]*Element
+	skiplist *skiplist
+}
+
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add 添加或更新成员，返回是否为新增成员
+func (s *SortedSet) Add(member string, score float64) bool {
+	element, ok := s.dict[member]
+	s.dict[member] = &Element{
+		Member: member,
+		Score:  score,
+	}
+	if ok {
+		// 分数变化时需要调整在跳表中的位置
+		if score != element.Score {
+			s.skiplist.remove(member, element.Score)
+			s.skiplist.insert(member, score)
+		}
+		return false
+	}
+	s.skiplist.insert(member, score)
+	return true
+}
+
+// Len 返回成员个数
+func (s *SortedSet) Len() int64 {
+	return int64(len(s.dict))
+}
+
+// Get 获取成员
+func (s *SortedSet) Get(member string) (element *Element, ok bool) {
+	element, ok = s.dict[member]
+	if !ok {
+		return nil, false
+	}
+	return element, true
+}
+
+// Remove 删除成员，返回是否删除成功
+func (s *SortedSet) Remove(member string) bool {
+	v, ok := s.dict[member]
+	if ok {
+		s.skiplist.remove(member, v.Score)
+		delete(s.dict, member)
+		return true
+	}
+	return false
+}
+
+// GetRank 获取成员的排名，排名从0开始，desc为true时按照分数从大到小排名，成员不存在返回-1
+func (s *SortedSet) GetRank(member string, desc bool) (rank int64) {
+	element, ok := s.dict[member]
+	if !ok {
+		return -1
+	}
+	r := s.skiplist.getRank(member, element.Score)
+	if desc {
+		r = s.skiplist.length - r
+	} else {
+		r--
+	}
+	return r
+}
+
+var errRankOutOfRange = errors.New("rank out of range")
+
+// ForEachByRank 按照排名遍历 [start, stop) 区间内的元素，排名从0开始
+func (s *SortedSet) ForEachByRank(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
+	size := s.Len()
+	if start < 0 || start >= size {
+		panic(errRankOutOfRange)
+	}
+	if stop < start || stop > size {
+		panic(errRankOutOfRange)
+	}
+
+	// 找到起始节点
+	var n *node
+	if desc {
+		n = s.skiplist.tail
+		if start > 0 {
+			n = s.skiplist.getByRank(size - start)
+		}
+	} else {
+		n = s.skiplist.header.level[0].forward
+		if start > 0 {
+			n = s.skiplist.getByRank(start + 1)
+		}
+	}
+
+	sliceSize := int(stop - start)
+	for i := 0; i < sliceSize; i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByRank 返回排名在 [start, stop) 区间内的元素
+func (s *SortedSet) RangeByRank(start int64, stop int64, desc bool) []*Element {
+	sliceSize := int(stop - start)
+	slice := make([]*Element, sliceSize)
+	i := 0
+	s.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		slice[i] = element
+		i++
+		return true
+	})
+	return slice
+}
+
+// RangeCount 返回区间内的元素个数
+func (s *SortedSet) RangeCount(min Border, max Border) int64 {
+	var i int64 = 0
+	s.ForEach(min, max, 0, -1, false, func(element *Element) bool {
+		i++
+		return true
+	})
+	return i
+}
+
+// ForEach 遍历区间内的元素，跳过前offset个元素，limit<0 表示不限制个数
+func (s *SortedSet) ForEach(min Border, max Border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	// 找到起始节点
+	var n *node
+	if desc {
+		n = s.skiplist.getLastInRange(min, max)
+	} else {
+		n = s.skiplist.getFirstInRange(min, max)
+	}
+
+	for n != nil && offset > 0 {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		offset--
+	}
+
+	for i := 0; (i < int(limit) || limit < 0) && n != nil; i++ {
+		// 起始节点可能因为offset已经越过了区间
+		if !min.less(&n.Element) || !max.greater(&n.Element) {
+			break
+		}
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// Range 返回区间内的元素
+func (s *SortedSet) Range(min Border, max Border, offset int64, limit int64, desc bool) []*Element {
+	if limit == 0 || offset < 0 {
+		return make([]*Element, 0)
+	}
+	slice := make([]*Element, 0)
+	s.ForEach(min, max, offset, limit, desc, func(element *Element) bool {
+		slice = append(slice, element)
+		return true
+	})
+	return slice
+}
+
+// RemoveRange 删除区间内的元素，返回删除的元素
+func (s *SortedSet) RemoveRange(min Border, max Border) []*Element {
+	removed := s.skiplist.RemoveRange(min, max, 0)
+	for _, element := range removed {
+		delete(s.dict, element.Member)
+	}
+	return removed
+}
+
+// RemoveByRank 删除排名在 [start, stop) 区间内的元素，排名从0开始，返回删除的元素
+func (s *SortedSet) RemoveByRank(start int64, stop int64) []*Element {
+	removed := s.skiplist.RemoveRangeByRank(start+1, stop+1)
+	for _, element := range removed {
+		delete(s.dict, element.Member)
+	}
+	return removed
+}
+
+// PopMin 弹出分数最小的count个元素
+func (s *SortedSet) PopMin(count int) []*Element {
+	// 排名转换时会加一，count 需要先限制在集合大小之内防止溢出
+	if int64(count) > s.Len() {
+		count = int(s.Len())
+	}
+	if count <= 0 {
+		return make([]*Element, 0)
+	}
+	return s.RemoveByRank(0, int64(count))
+}
+
+// PopMax 弹出分数最大的count个元素，按照分数从大到小返回
+func (s *SortedSet) PopMax(count int) []*Element {
+	if int64(count) > s.Len() {
+		count = int(s.Len())
+	}
+	if count <= 0 {
+		return make([]*Element, 0)
+	}
+	removed := s.RangeByRank(0, int64(count), true)
+	for _, element := range removed {
+		s.Remove(element.Member)
+	}
+	return removed
+}
@@ -1,6 +1,9 @@
 package database
 
-import "redis-go/interface/resp"
+import (
+	"redis-go/interface/resp"
+	"redis-go/interface/tcp"
+)
 
 // Database 是数据库接口，定义了数据库的基本操作
 type Database interface {
@@ -9,6 +12,18 @@ type Database interface {
 	Close()
 }
 
+// Clients 当前所有的客户端连接，由处理器实现，client 命令使用
+type Clients interface {
+	ForEachClient(consumer func(client resp.Connection) bool) // 遍历客户端连接，consumer 返回false时停止
+	ClientCount() int                                         // 客户端连接数
+	ConnStats() *tcp.ConnStats                                // 服务端的连接统计，没有开始监听时为nil
+}
+
+// ClientsAware 需要获取客户端连接的数据库，创建处理器时设置
+type ClientsAware interface {
+	SetClients(clients Clients)
+}
+
 // DataEntity 将数据封装为 DataEntity 类型
 type DataEntity struct {
 	Data interface{}
@@ -1,8 +1,72 @@
 // Package resp Conn: 一个 Redis 的连接
 package resp
 
+import "time"
+
+// 客户端的回复模式，client reply 命令设置
+const (
+	ReplyOn   = iota // 正常回复
+	ReplyOff         // 不回复任何命令
+	ReplySkip        // 不回复下一条命令
+)
+
+// ClientStats 客户端连接的统计信息，client list 和 client info 使用
+type ClientStats struct {
+	CreateTime      time.Time // 连接建立的时间
+	LastInteraction time.Time // 最近一次执行命令的时间
+	LastCmd         string    // 最近一次执行的命令
+	QueryBuf        int       // 最近一次收到的命令的字节数
+	ArgvMem         int       // 最近一次收到的命令的参数占用的字节数
+	MultiCmds       int       // 事务中排队的命令数，不处于事务中时为-1
+	MultiMem        int       // 事务中排队的命令占用的字节数
+	OutputBuf       int       // 最近一次回复的字节数
+}
+
+// WatchKey watch 的key，不同db中的同名key是不同的key
+type WatchKey struct {
+	DBIndex int
+	Key     string
+}
+
 type Connection interface {
 	Write([]byte) error // Write data to the connection
 	GetDBIndex() int    // Get database index
 	SelectDB(int)       // Select database
+	RemoteAddr() string // 客户端的地址，没有底层网络连接时为空
+
+	// 认证相关
+	IsAuthenticated() bool // 是否已经通过密码认证
+	SetAuthenticated(bool) // 设置认证状态
+	GetUser() string       // 认证的acl用户，服务端内部使用的连接为空
+	SetUser(string)        // 设置认证的acl用户
+
+	// 事务相关
+	InMultiState() bool               // 是否处于 multi 状态
+	SetMultiState(bool)               // 设置 multi 状态
+	GetQueuedCmdLine() [][][]byte     // 获取事务中排队的命令
+	EnqueueCmd([][]byte)              // 命令入队
+	ClearQueuedCmds()                 // 清空排队的命令
+	GetWatching() map[WatchKey]uint32 // 获取 watch 的key及其版本号
+	AddTxError(err error)             // 记录命令入队时发生的错误
+	GetTxErrors() []error             // 获取命令入队时发生的错误
+
+	// 发布订阅相关
+	Subscribe(channel string)    // 订阅频道
+	UnSubscribe(channel string)  // 取消订阅频道
+	GetChannels() []string       // 获取订阅的所有频道
+	PSubscribe(pattern string)   // 按模式订阅
+	PUnSubscribe(pattern string) // 取消按模式订阅
+	GetPatterns() []string       // 获取订阅的所有模式
+	SubsCount() int              // 订阅的频道和模式的总数，大于0时连接处于订阅模式
+
+	// 客户端信息相关
+	GetID() int64          // 客户端id，服务端内部使用的连接为0
+	GetName() string       // client setname 设置的名称
+	SetName(string)        // 设置名称
+	LocalAddr() string     // 服务端的地址，没有底层网络连接时为空
+	GetStats() ClientStats // 获取连接的统计信息
+	SetReplyMode(mode int) // 设置回复模式
+	SetNoEvict(bool)       // 设置 no-evict 标记
+	IsNoEvict() bool       // 是否设置了 no-evict 标记
+	Kill()                 // 关闭连接，正在执行的命令的回复仍然会发送
 }
@@ -3,9 +3,21 @@ package tcp
 import (
 	"context"
 	"net"
+	"sync/atomic"
 )
 
 type Handler interface {
 	Handle(ctx context.Context, conn net.Conn) error // server处理逻辑，ctx接收终端信号等
 	Close() error                                    // server需实现优雅退出
 }
+
+// ConnStats 服务端的连接统计，每个服务端单独持有，用于info命令展示
+type ConnStats struct {
+	Accepted atomic.Int64 // 累计接受的连接数
+	Rejected atomic.Int64 // 因为超过最大连接数被拒绝的连接数
+}
+
+// ConnStatsAware 需要获取连接统计的处理器，服务端开始监听之前设置
+type ConnStatsAware interface {
+	SetConnStats(stats *ConnStats)
+}
@@ -0,0 +1,78 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HashFunc 哈希函数
+type HashFunc func(data []byte) uint32
+
+// Map 一致性哈希环，每个节点在环上对应 replicas 个虚拟节点，保证key在节点之间分布均匀
+type Map struct {
+	hashFunc HashFunc
+	replicas int
+	keys     []int          // 虚拟节点的哈希值，有序
+	hashMap  map[int]string // 虚拟节点的哈希值 -> 节点
+}
+
+// New 创建一致性哈希环，fn 为nil时使用crc32
+func New(replicas int, fn HashFunc) *Map {
+	m := &Map{
+		hashFunc: fn,
+		replicas: replicas,
+		hashMap:  make(map[int]string),
+	}
+	if m.hashFunc == nil {
+		m.hashFunc = crc32.ChecksumIEEE
+	}
+	return m
+}
+
+// IsEmpty 环上是否没有节点
+func (m *Map) IsEmpty() bool {
+	return len(m.keys) == 0
+}
+
+// AddNode 添加节点
+func (m *Map) AddNode(nodes ...string) {
+	for _, node := range nodes {
+		if node == "" {
+			continue
+		}
+		for i := 0; i < m.replicas; i++ {
+			hash := int(m.hashFunc([]byte(strconv.Itoa(i) + node)))
+			m.keys = append(m.keys, hash)
+			m.hashMap[hash] = node
+		}
+	}
+	sort.Ints(m.keys)
+}
+
+// PickNode 获取key所在的节点，顺时针方向上第一个虚拟节点对应的节点
+func (m *Map) PickNode(key string) string {
+	if m.IsEmpty() {
+		return ""
+	}
+	hash := int(m.hashFunc([]byte(getPartitionKey(key))))
+	idx := sort.SearchInts(m.keys, hash)
+	if idx == len(m.keys) {
+		idx = 0
+	}
+	return m.hashMap[m.keys[idx]]
+}
+
+// getPartitionKey 和redis集群的hash tag一致，key中包含 {tag} 时只使用tag计算哈希，保证相关的key分布在同一个节点
+func getPartitionKey(key string) string {
+	beg := strings.Index(key, "{")
+	if beg == -1 {
+		return key
+	}
+	end := strings.Index(key[beg+1:], "}")
+	if end <= 0 {
+		return key
+	}
+	return key[beg+1 : beg+1+end]
+}
@@ -0,0 +1,74 @@
+package pool
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed 连接池已经关闭
+var ErrClosed = errors.New("pool closed")
+
+// Pool 对象池，缓存空闲的对象(如网络连接)，避免频繁创建
+type Pool[T any] struct {
+	factory   func() (T, error) // 没有空闲对象时创建新的对象
+	finalizer func(T)           // 对象被丢弃时释放资源
+	idles     chan T
+	mu        sync.Mutex
+	closed    bool
+}
+
+// New 创建对象池，maxIdle 为最多缓存的空闲对象数量
+func New[T any](factory func() (T, error), finalizer func(T), maxIdle int) *Pool[T] {
+	return &Pool[T]{
+		factory:   factory,
+		finalizer: finalizer,
+		idles:     make(chan T, maxIdle),
+	}
+}
+
+// Get 获取一个对象，优先使用空闲的对象
+func (p *Pool[T]) Get() (T, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		var zero T
+		return zero, ErrClosed
+	}
+	select {
+	case item := <-p.idles:
+		p.mu.Unlock()
+		return item, nil
+	default:
+	}
+	p.mu.Unlock()
+	return p.factory()
+}
+
+// Put 归还对象，空闲对象已满或者连接池已经关闭时释放对象
+func (p *Pool[T]) Put(item T) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.finalizer(item)
+		return
+	}
+	select {
+	case p.idles <- item:
+	default:
+		p.finalizer(item)
+	}
+}
+
+// Close 关闭对象池，释放所有空闲的对象
+func (p *Pool[T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.idles)
+	for item := range p.idles {
+		p.finalizer(item)
+	}
+}
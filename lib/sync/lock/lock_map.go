@@ -0,0 +1,114 @@
+package lock
+
+import (
+	"sort"
+	"sync"
+)
+
+/**
+ * 分段读写锁，将key通过哈希映射到固定数量的锁上
+ * 单个key的锁粒度太细会占用大量内存，一把全局锁又会导致所有命令串行执行，这里取一个折中
+ * 同时锁定多个key时按照锁的下标顺序加锁，避免出现死锁
+ */
+
+const prime32 = uint32(16777619)
+
+// Locks 分段读写锁
+type Locks struct {
+	table []*sync.RWMutex
+}
+
+// Make 创建分段锁，tableSize 为锁的数量
+func Make(tableSize int) *Locks {
+	table := make([]*sync.RWMutex, tableSize)
+	for i := 0; i < tableSize; i++ {
+		table[i] = &sync.RWMutex{}
+	}
+	return &Locks{table: table}
+}
+
+// fnv32 FNV-1a 哈希算法
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+func (locks *Locks) spread(hashCode uint32) uint32 {
+	return hashCode % uint32(len(locks.table))
+}
+
+// Lock 对单个key加写锁
+func (locks *Locks) Lock(key string) {
+	locks.table[locks.spread(fnv32(key))].Lock()
+}
+
+// UnLock 释放单个key的写锁
+func (locks *Locks) UnLock(key string) {
+	locks.table[locks.spread(fnv32(key))].Unlock()
+}
+
+// RLock 对单个key加读锁
+func (locks *Locks) RLock(key string) {
+	locks.table[locks.spread(fnv32(key))].RLock()
+}
+
+// RUnLock 释放单个key的读锁
+func (locks *Locks) RUnLock(key string) {
+	locks.table[locks.spread(fnv32(key))].RUnlock()
+}
+
+// toLockIndices 计算key对应的锁下标，去重后排序，reverse 为true时逆序
+func (locks *Locks) toLockIndices(keys []string, reverse bool) []uint32 {
+	indexMap := make(map[uint32]struct{})
+	for _, key := range keys {
+		indexMap[locks.spread(fnv32(key))] = struct{}{}
+	}
+	indices := make([]uint32, 0, len(indexMap))
+	for index := range indexMap {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		if reverse {
+			return indices[i] > indices[j]
+		}
+		return indices[i] < indices[j]
+	})
+	return indices
+}
+
+// RWLocks 同时对多个key加锁，writeKeys 加写锁，readKeys 加读锁
+// 同一个key同时出现在两个列表中时只加写锁
+func (locks *Locks) RWLocks(writeKeys []string, readKeys []string) {
+	keys := append(append([]string{}, writeKeys...), readKeys...)
+	writeIndices := make(map[uint32]struct{}, len(writeKeys))
+	for _, key := range writeKeys {
+		writeIndices[locks.spread(fnv32(key))] = struct{}{}
+	}
+	for _, index := range locks.toLockIndices(keys, false) {
+		if _, isWrite := writeIndices[index]; isWrite {
+			locks.table[index].Lock()
+		} else {
+			locks.table[index].RLock()
+		}
+	}
+}
+
+// RWUnLocks 释放 RWLocks 加的锁，参数需要和加锁时保持一致
+func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
+	keys := append(append([]string{}, writeKeys...), readKeys...)
+	writeIndices := make(map[uint32]struct{}, len(writeKeys))
+	for _, key := range writeKeys {
+		writeIndices[locks.spread(fnv32(key))] = struct{}{}
+	}
+	for _, index := range locks.toLockIndices(keys, true) {
+		if _, isWrite := writeIndices[index]; isWrite {
+			locks.table[index].Unlock()
+		} else {
+			locks.table[index].RUnlock()
+		}
+	}
+}
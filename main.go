@@ -13,6 +13,8 @@ func main() {
 	config.SetupConfig(defaultConfigFile)
 
 	_ = tcp.ListenAndServeWithSignal(&tcp.Config{
-		Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port)}, handler.MakeHandler())
+		Address:    fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
+		MaxConnect: config.Properties.MaxClients,
+	}, handler.MakeHandler())
 
 }
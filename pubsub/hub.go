@@ -0,0 +1,150 @@
+package pubsub
+
+import (
+	"redis-go/interface/resp"
+	"redis-go/lib/wildcard"
+	"sync"
+)
+
+// Hub 发布订阅中心，记录每个频道和模式的订阅者
+// 订阅关系同时记录在连接上，连接关闭时可以快速找到需要清理的频道
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[resp.Connection]struct{} // 频道 -> 订阅者
+	patterns map[string]*patternSubscribers          // 模式 -> 订阅者
+}
+
+// patternSubscribers 按模式订阅的订阅者，模式只编译一次
+type patternSubscribers struct {
+	pattern     *wildcard.Pattern
+	subscribers map[resp.Connection]struct{}
+}
+
+// MakeHub 创建发布订阅中心
+func MakeHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[resp.Connection]struct{}),
+		patterns: make(map[string]*patternSubscribers),
+	}
+}
+
+// subscribe 订阅频道，返回是否为新订阅
+func (hub *Hub) subscribe(c resp.Connection, channel string) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.channels[channel]
+	if !ok {
+		subscribers = make(map[resp.Connection]struct{})
+		hub.channels[channel] = subscribers
+	}
+	if _, exists := subscribers[c]; exists {
+		return false
+	}
+	subscribers[c] = struct{}{}
+	return true
+}
+
+// unsubscribe 取消订阅频道，没有订阅者的频道会被删除
+func (hub *Hub) unsubscribe(c resp.Connection, channel string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.channels[channel]
+	if !ok {
+		return
+	}
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(hub.channels, channel)
+	}
+}
+
+// psubscribe 按模式订阅，返回是否为新订阅
+func (hub *Hub) psubscribe(c resp.Connection, pattern string) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	ps, ok := hub.patterns[pattern]
+	if !ok {
+		ps = &patternSubscribers{
+			pattern:     wildcard.CompilePattern(pattern),
+			subscribers: make(map[resp.Connection]struct{}),
+		}
+		hub.patterns[pattern] = ps
+	}
+	if _, exists := ps.subscribers[c]; exists {
+		return false
+	}
+	ps.subscribers[c] = struct{}{}
+	return true
+}
+
+// punsubscribe 取消按模式订阅
+func (hub *Hub) punsubscribe(c resp.Connection, pattern string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	ps, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(ps.subscribers, c)
+	if len(ps.subscribers) == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+// publish 向频道发送消息，返回收到消息的订阅者数量
+// 写入连接可能比较耗时，这里先拷贝订阅者再在锁外发送
+func (hub *Hub) publish(channel string, message []byte) int {
+	type delivery struct {
+		client  resp.Connection
+		payload []byte
+	}
+	deliveries := make([]delivery, 0)
+	hub.mu.RLock()
+	if subscribers, ok := hub.channels[channel]; ok {
+		payload := makeMessage(channel, message)
+		for client := range subscribers {
+			deliveries = append(deliveries, delivery{client, payload})
+		}
+	}
+	for pattern, ps := range hub.patterns {
+		if !ps.pattern.IsMatch(channel) {
+			continue
+		}
+		payload := makePMessage(pattern, channel, message)
+		for client := range ps.subscribers {
+			deliveries = append(deliveries, delivery{client, payload})
+		}
+	}
+	hub.mu.RUnlock()
+	for _, d := range deliveries {
+		_ = d.client.Write(d.payload)
+	}
+	return len(deliveries)
+}
+
+// activeChannels 获取至少有一个订阅者的频道，pattern 为nil时返回全部
+func (hub *Hub) activeChannels(pattern *wildcard.Pattern) []string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	channels := make([]string, 0, len(hub.channels))
+	for channel := range hub.channels {
+		if pattern == nil || pattern.IsMatch(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// numSub 获取频道的订阅者数量，不包含按模式订阅的订阅者
+func (hub *Hub) numSub(channel string) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.channels[channel])
+}
+
+// numPat 获取所有客户端订阅的模式数量
+func (hub *Hub) numPat() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.patterns)
+}
@@ -0,0 +1,190 @@
+package pubsub
+
+import (
+	"redis-go/interface/resp"
+	"redis-go/lib/wildcard"
+	"redis-go/resp/reply"
+	"strings"
+)
+
+// 发布订阅命令实现，包含subscribe，unsubscribe，psubscribe，punsubscribe，publish，pubsub命令
+// 订阅类命令对每个频道都需要单独回复，这里直接写入连接，返回 NoReply
+
+var (
+	messageBytes      = []byte("message")
+	pmessageBytes     = []byte("pmessage")
+	subscribeBytes    = []byte("subscribe")
+	unsubscribeBytes  = []byte("unsubscribe")
+	psubscribeBytes   = []byte("psubscribe")
+	punsubscribeBytes = []byte("punsubscribe")
+)
+
+// makeMessage 构建推送给频道订阅者的消息
+func makeMessage(channel string, message []byte) []byte {
+	return reply.MakeMultiBulkReply([][]byte{messageBytes, []byte(channel), message}).ToBytes()
+}
+
+// makePMessage 构建推送给模式订阅者的消息
+func makePMessage(pattern string, channel string, message []byte) []byte {
+	return reply.MakeMultiBulkReply([][]byte{pmessageBytes, []byte(pattern), []byte(channel), message}).ToBytes()
+}
+
+// makeSubscribeReply 构建订阅类命令的回复，target 为nil时表示没有订阅任何频道
+func makeSubscribeReply(kind []byte, target []byte, count int) []byte {
+	var targetReply resp.Reply = reply.MakeNullBulkReply()
+	if target != nil {
+		targetReply = reply.MakeBulkReply(target)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply(kind),
+		targetReply,
+		reply.MakeIntReply(int64(count)),
+	}).ToBytes()
+}
+
+// Subscribe subscribe channel [channel ...]
+func Subscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("subscribe")
+	}
+	for _, arg := range args {
+		channel := string(arg)
+		if hub.subscribe(c, channel) {
+			c.Subscribe(channel)
+		}
+		_ = c.Write(makeSubscribeReply(subscribeBytes, arg, c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// UnSubscribe unsubscribe [channel [channel ...]]，不指定频道时取消所有的订阅
+func UnSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	channels := make([]string, 0, len(args))
+	for _, arg := range args {
+		channels = append(channels, string(arg))
+	}
+	if len(channels) == 0 {
+		channels = c.GetChannels()
+	}
+	if len(channels) == 0 {
+		_ = c.Write(makeSubscribeReply(unsubscribeBytes, nil, c.SubsCount()))
+		return reply.MakeNoReply()
+	}
+	for _, channel := range channels {
+		hub.unsubscribe(c, channel)
+		c.UnSubscribe(channel)
+		_ = c.Write(makeSubscribeReply(unsubscribeBytes, []byte(channel), c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// PSubscribe psubscribe pattern [pattern ...]
+func PSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("psubscribe")
+	}
+	for _, arg := range args {
+		pattern := string(arg)
+		if hub.psubscribe(c, pattern) {
+			c.PSubscribe(pattern)
+		}
+		_ = c.Write(makeSubscribeReply(psubscribeBytes, arg, c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// PUnSubscribe punsubscribe [pattern [pattern ...]]，不指定模式时取消所有的模式订阅
+func PUnSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	patterns := make([]string, 0, len(args))
+	for _, arg := range args {
+		patterns = append(patterns, string(arg))
+	}
+	if len(patterns) == 0 {
+		patterns = c.GetPatterns()
+	}
+	if len(patterns) == 0 {
+		_ = c.Write(makeSubscribeReply(punsubscribeBytes, nil, c.SubsCount()))
+		return reply.MakeNoReply()
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe(c, pattern)
+		c.PUnSubscribe(pattern)
+		_ = c.Write(makeSubscribeReply(punsubscribeBytes, []byte(pattern), c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// UnsubscribeAll 取消连接的所有订阅，在连接关闭时调用
+func UnsubscribeAll(hub *Hub, c resp.Connection) {
+	for _, channel := range c.GetChannels() {
+		hub.unsubscribe(c, channel)
+		c.UnSubscribe(channel)
+	}
+	for _, pattern := range c.GetPatterns() {
+		hub.punsubscribe(c, pattern)
+		c.PUnSubscribe(pattern)
+	}
+}
+
+// Publish publish channel message，返回收到消息的订阅者数量
+func Publish(hub *Hub, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	return reply.MakeIntReply(int64(hub.publish(string(args[0]), args[1])))
+}
+
+// PubSub pubsub CHANNELS [pattern] | NUMSUB [channel [channel ...]] | NUMPAT
+func PubSub(hub *Hub, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		channels := hub.activeChannels(pattern)
+		result := make([][]byte, len(channels))
+		for i, channel := range channels {
+			result[i] = []byte(channel)
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "numsub":
+		result := make([]resp.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			result = append(result, reply.MakeBulkReply(arg), reply.MakeIntReply(int64(hub.numSub(string(arg)))))
+		}
+		return reply.MakeMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("pubsub|numpat")
+		}
+		return reply.MakeIntReply(int64(hub.numPat()))
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCmd + "'. Try PUBSUB HELP.")
+}
+
+// IsSubscribeModeCmd 订阅模式下允许执行的命令
+func IsSubscribeModeCmd(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping", "quit", "reset":
+		return true
+	}
+	return false
+}
+
+// MakeSubscribeModeErrReply 订阅模式下执行其他命令时的错误
+func MakeSubscribeModeErrReply(cmdName string) resp.Reply {
+	return reply.MakeStandardErrorReply("ERR Can't execute '" + cmdName + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
+
+// MakeSubscribeModePongReply 订阅模式下ping的回复
+func MakeSubscribeModePongReply() resp.Reply {
+	return reply.MakeMultiBulkReply([][]byte{[]byte("pong"), {}})
+}
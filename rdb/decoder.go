@@ -0,0 +1,250 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"redis-go/datastruct/dict"
+	"redis-go/datastruct/list"
+	"redis-go/datastruct/set"
+	"redis-go/datastruct/sortedset"
+	databaseface "redis-go/interface/database"
+	"time"
+)
+
+// Consumer 解析出键值对时的回调，返回false时停止解析
+type Consumer func(dbIndex int, key string, entity *databaseface.DataEntity, expiration *time.Time) bool
+
+// IsRDB 判断数据是否以rdb文件头开始
+func IsRDB(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Parse 解析完整的rdb数据，先校验校验和，再依次回调每个键值对
+// 返回值为rdb数据的长度，数据后面可能还跟着其他内容(如aof命令)
+func Parse(data []byte, consumer Consumer) (int, error) {
+	// 第一遍只扫描并校验，避免加载了一部分损坏的数据
+	if _, err := ParseReader(bufio.NewReader(bytes.NewReader(data)), nil); err != nil {
+		return 0, err
+	}
+	n, err := ParseReader(bufio.NewReader(bytes.NewReader(data)), consumer)
+	return int(n), err
+}
+
+// ParseReader 从reader中流式解析rdb数据并依次回调每个键值对，consumer 为nil时只扫描并校验
+// 读取到校验和为止，之后的数据(如aof命令)仍然可以从reader中继续读取，返回值为rdb数据的长度
+// 校验和在读取完所有数据之后才能校验，返回错误时已经回调过的数据不可信，调用方需要放弃加载
+func ParseReader(reader *bufio.Reader, consumer Consumer) (int64, error) {
+	dec := &decoder{reader: reader, crc: crc64.New(crcTable), consumer: consumer}
+	header := make([]byte, len(magic)+len(version))
+	if _, err := io.ReadFull(dec, header); err != nil || string(header[:len(magic)]) != magic {
+		return 0, ErrInvalidFormat
+	}
+	stopped, err := dec.scan()
+	if err != nil || stopped {
+		return dec.offset, err
+	}
+	checksum := dec.crc.Sum64()
+	var buf [8]byte
+	if _, err := io.ReadFull(dec, buf[:]); err != nil || binary.LittleEndian.Uint64(buf[:]) != checksum {
+		return 0, ErrChecksum
+	}
+	return dec.offset, nil
+}
+
+// maxPreallocLen 字符串长度超过这个值时随着读取逐步分配内存，避免损坏的长度字段导致申请过大的内存
+const maxPreallocLen = 1 << 16
+
+type decoder struct {
+	reader   *bufio.Reader
+	crc      hash.Hash64 // 已经读取的数据的校验和
+	offset   int64       // 已经读取的数据的长度
+	consumer Consumer    // 为nil时只扫描不构建数据
+}
+
+// Read 读取数据的同时计算校验和
+func (dec *decoder) Read(p []byte) (int, error) {
+	n, err := dec.reader.Read(p)
+	dec.crc.Write(p[:n])
+	dec.offset += int64(n)
+	return n, err
+}
+
+// ReadByte 读取一个字节的同时计算校验和
+func (dec *decoder) ReadByte() (byte, error) {
+	b, err := dec.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	dec.crc.Write([]byte{b})
+	dec.offset++
+	return b, nil
+}
+
+// scan 依次读取所有的键值对直到EOF标识，consumer 返回false时提前结束并返回true
+func (dec *decoder) scan() (bool, error) {
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		op, err := dec.ReadByte()
+		if err != nil {
+			return false, ErrInvalidFormat
+		}
+		switch op {
+		case opEOF:
+			return false, nil
+		case opSelectDB:
+			index, err := binary.ReadUvarint(dec)
+			if err != nil {
+				return false, ErrInvalidFormat
+			}
+			dbIndex = int(index)
+			continue
+		case opExpireTimeMs:
+			ms, err := dec.readUint64()
+			if err != nil {
+				return false, err
+			}
+			expireTime := time.UnixMilli(int64(ms))
+			expiration = &expireTime
+			continue
+		}
+		key, err := dec.readString()
+		if err != nil {
+			return false, err
+		}
+		entity, err := dec.readValue(op)
+		if err != nil {
+			return false, err
+		}
+		if dec.consumer != nil && !dec.consumer(dbIndex, string(key), entity, expiration) {
+			return true, nil
+		}
+		expiration = nil
+	}
+}
+
+func (dec *decoder) readLength() (int, error) {
+	n, err := binary.ReadUvarint(dec)
+	if err != nil || n > math.MaxInt32 {
+		return 0, ErrInvalidFormat
+	}
+	return int(n), nil
+}
+
+func (dec *decoder) readString() ([]byte, error) {
+	n, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxPreallocLen {
+		buf, err := io.ReadAll(io.LimitReader(dec, int64(n)))
+		if err != nil || len(buf) != n {
+			return nil, ErrInvalidFormat
+		}
+		return buf, nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(dec, buf); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	return buf, nil
+}
+
+func (dec *decoder) readUint64() (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(dec, buf[:]); err != nil {
+		return 0, ErrInvalidFormat
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// readValue 读取指定类型的值，只扫描时不构建数据结构
+func (dec *decoder) readValue(valueType byte) (*databaseface.DataEntity, error) {
+	build := dec.consumer != nil
+	switch valueType {
+	case typeString:
+		val, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &databaseface.DataEntity{Data: val}, nil
+	case typeList:
+		n, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		l := list.MakeQuickList()
+		for i := 0; i < n; i++ {
+			val, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			if build {
+				l.Add(val)
+			}
+		}
+		return &databaseface.DataEntity{Data: l}, nil
+	case typeSet:
+		n, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		s := set.Make()
+		for i := 0; i < n; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			if build {
+				s.Add(string(member))
+			}
+		}
+		return &databaseface.DataEntity{Data: s}, nil
+	case typeZSet:
+		n, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		zset := sortedset.Make()
+		for i := 0; i < n; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			bits, err := dec.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			if build {
+				zset.Add(string(member), math.Float64frombits(bits))
+			}
+		}
+		return &databaseface.DataEntity{Data: zset}, nil
+	case typeHash:
+		n, err := dec.readLength()
+		if err != nil {
+			return nil, err
+		}
+		hash := dict.MakeSimpleDict()
+		for i := 0; i < n; i++ {
+			field, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			val, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			if build {
+				hash.Put(string(field), val)
+			}
+		}
+		return &databaseface.DataEntity{Data: hash}, nil
+	}
+	return nil, ErrUnsupportedType
+}
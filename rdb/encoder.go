@@ -0,0 +1,155 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"redis-go/datastruct/dict"
+	"redis-go/datastruct/list"
+	"redis-go/datastruct/set"
+	"redis-go/datastruct/sortedset"
+	databaseface "redis-go/interface/database"
+	"time"
+)
+
+// Encoder rdb文件编码器，写入的同时计算校验和
+type Encoder struct {
+	writer *bufio.Writer
+	crc    hash.Hash64
+	buf    [binary.MaxVarintLen64]byte
+	err    error // 第一次写入失败的错误，之后的写入都会被忽略
+}
+
+// NewEncoder 创建编码器
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		writer: bufio.NewWriter(w),
+		crc:    crc64.New(crcTable),
+	}
+}
+
+func (enc *Encoder) write(p []byte) {
+	if enc.err != nil {
+		return
+	}
+	if _, enc.err = enc.writer.Write(p); enc.err == nil {
+		enc.crc.Write(p)
+	}
+}
+
+func (enc *Encoder) writeByte(b byte) {
+	enc.write([]byte{b})
+}
+
+func (enc *Encoder) writeLength(n uint64) {
+	size := binary.PutUvarint(enc.buf[:], n)
+	enc.write(enc.buf[:size])
+}
+
+func (enc *Encoder) writeString(s []byte) {
+	enc.writeLength(uint64(len(s)))
+	enc.write(s)
+}
+
+func (enc *Encoder) writeUint64(n uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	enc.write(buf[:])
+}
+
+// WriteHeader 写入文件头
+func (enc *Encoder) WriteHeader() error {
+	enc.write([]byte(magic + version))
+	return enc.err
+}
+
+// WriteDBHeader 写入db切换标识，之后写入的key都属于该db
+func (enc *Encoder) WriteDBHeader(dbIndex int) error {
+	enc.writeByte(opSelectDB)
+	enc.writeLength(uint64(dbIndex))
+	return enc.err
+}
+
+// WriteEntry 写入一个键值对，expiration 为nil表示没有设置过期时间
+func (enc *Encoder) WriteEntry(key string, entity *databaseface.DataEntity, expiration *time.Time) error {
+	if expiration != nil {
+		enc.writeByte(opExpireTimeMs)
+		enc.writeUint64(uint64(expiration.UnixMilli()))
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		enc.writeByte(typeString)
+		enc.writeString([]byte(key))
+		enc.writeString(val)
+	case list.List:
+		enc.writeByte(typeList)
+		enc.writeString([]byte(key))
+		enc.writeLength(uint64(val.Len()))
+		val.ForEach(func(i int, v interface{}) bool {
+			enc.writeString(v.([]byte))
+			return true
+		})
+	case *set.Set:
+		enc.writeByte(typeSet)
+		enc.writeString([]byte(key))
+		enc.writeLength(uint64(val.Len()))
+		val.ForEach(func(member string) bool {
+			enc.writeString([]byte(member))
+			return true
+		})
+	case *sortedset.SortedSet:
+		enc.writeByte(typeZSet)
+		enc.writeString([]byte(key))
+		enc.writeLength(uint64(val.Len()))
+		if val.Len() > 0 {
+			val.ForEachByRank(0, val.Len(), false, func(element *sortedset.Element) bool {
+				enc.writeString([]byte(element.Member))
+				enc.writeUint64(math.Float64bits(element.Score))
+				return true
+			})
+		}
+	case dict.Dict:
+		enc.writeByte(typeHash)
+		enc.writeString([]byte(key))
+		enc.writeLength(uint64(val.Len()))
+		val.ForEach(func(field string, v interface{}) bool {
+			enc.writeString([]byte(field))
+			enc.writeString(v.([]byte))
+			return true
+		})
+	default:
+		return ErrUnsupportedType
+	}
+	return enc.err
+}
+
+// WriteRaw 写入其他编码器编码好的键值对，数据同样计入校验和
+func (enc *Encoder) WriteRaw(p []byte) error {
+	enc.write(p)
+	return enc.err
+}
+
+// Flush 将缓冲区中的数据写入底层的writer，只编码键值对时使用
+func (enc *Encoder) Flush() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.writer.Flush()
+}
+
+// WriteEnd 写入文件结束标识和校验和，并将缓冲区中的数据写入底层的writer
+func (enc *Encoder) WriteEnd() error {
+	enc.writeByte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], enc.crc.Sum64())
+	if _, err := enc.writer.Write(buf[:]); err != nil {
+		return err
+	}
+	return enc.writer.Flush()
+}
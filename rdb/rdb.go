@@ -0,0 +1,51 @@
+package rdb
+
+import (
+	"errors"
+	"hash/crc64"
+)
+
+// rdb 二进制快照格式，参考redis的rdb文件设计并做了简化
+//
+// 文件结构：
+//   magic(7B) version(4B)
+//   [ SELECTDB dbIndex(uvarint) { [EXPIRETIME_MS ms(8B)] type key value } ... ] ...
+//   EOF checksum(8B)
+//
+// 长度和下标使用uvarint编码，字符串为 长度+内容，有序集合的分数为小端序的float64
+// checksum 为文件中checksum之前所有字节的CRC64(ECMA)，小端序
+
+const (
+	magic   = "REDISGO"
+	version = "0001"
+
+	// HeaderSize 文件头的长度，用于判断数据是否为rdb格式
+	HeaderSize = len(magic) + len(version)
+)
+
+// 操作码
+const (
+	opExpireTimeMs = 0xFC // 下一个key的过期时间，unix毫秒
+	opSelectDB     = 0xFE // 切换db
+	opEOF          = 0xFF // 文件结束
+)
+
+// 数据类型
+const (
+	typeString = 0
+	typeList   = 1
+	typeSet    = 2
+	typeZSet   = 3
+	typeHash   = 4
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+var (
+	// ErrInvalidFormat 文件格式错误
+	ErrInvalidFormat = errors.New("invalid rdb format")
+	// ErrChecksum 文件校验和不一致，文件可能被截断或者损坏
+	ErrChecksum = errors.New("rdb checksum mismatch")
+	// ErrUnsupportedType 不支持的数据类型
+	ErrUnsupportedType = errors.New("unsupported rdb value type")
+)
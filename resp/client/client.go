@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bufio"
+	"net"
+	"redis-go/interface/resp"
+	"redis-go/resp/parser"
+	"redis-go/resp/reply"
+	"time"
+)
+
+const (
+	dialTimeout    = 3 * time.Second
+	requestTimeout = 5 * time.Second
+)
+
+// Client 简单的redis客户端，发送命令后同步等待回复，集群模式下节点之间转发命令时使用
+// 同一时间只能被一个协程使用，需要并发使用时通过连接池获取
+type Client struct {
+	addr   string
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// MakeClient 连接指定地址的redis服务
+func MakeClient(addr string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		addr:   addr,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}, nil
+}
+
+// Send 发送命令并等待回复，返回error时连接已经不可用，需要关闭
+func (c *Client) Send(args [][]byte) (resp.Reply, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(requestTimeout))
+	if _, err := c.conn.Write(reply.MakeMultiBulkReply(args).ToBytes()); err != nil {
+		return nil, err
+	}
+	return parser.ReadReply(c.reader)
+}
+
+// Addr 服务端的地址
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -2,17 +2,58 @@ package connection
 
 import (
 	"net"
+	"redis-go/interface/resp"
 	"redis-go/lib/wait"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// nextClientID 客户端id自增生成，服务端内部使用的连接id为0
+var nextClientID atomic.Int64
+
+// containerCommands 带有子命令的命令，记录最近执行的命令时需要带上子命令
+var containerCommands = map[string]struct{}{
+	"client":  {},
+	"acl":     {},
+	"cluster": {},
+	"pubsub":  {},
+	"object":  {},
+	"config":  {},
+	"command": {},
+}
+
 // Connection 表示客户端和服务端的连接
 type Connection struct {
-	conn         net.Conn   // 底层的网络连接
-	waitingReply wait.Wait  // 等待完成响应的同步器
-	mu           sync.Mutex // 发送响应时的互斥锁
-	selectedDB   int        // 选择的数据库的编号
+	conn          net.Conn   // 底层的网络连接
+	waitingReply  wait.Wait  // 等待完成响应的同步器
+	mu            sync.Mutex // 发送响应时的互斥锁
+	selectedDB    int        // 选择的数据库的编号
+	authenticated bool       // 是否已经通过密码认证，服务端内部使用的连接需要直接设置为已认证
+	user          string     // 认证的acl用户
+
+	// 事务相关的状态，同一个连接上的命令是串行执行的，这里不需要加锁
+	multiState bool                     // 是否处于 multi 状态
+	queue      [][][]byte               // 事务中排队的命令
+	watching   map[resp.WatchKey]uint32 // watch 的key及其版本号
+	txErrors   []error                  // 命令入队时发生的错误
+
+	// 发布订阅相关的状态
+	subsMu   sync.Mutex
+	channels map[string]struct{} // 订阅的频道
+	patterns map[string]struct{} // 按模式订阅的模式
+
+	// 客户端信息相关的状态，client list 等命令会在其他连接上读取，需要加锁
+	id          int64
+	statsMu     sync.Mutex
+	name        string
+	stats       resp.ClientStats
+	replyOff    bool        // client reply off
+	skipReplies int         // 需要跳过回复的命令数，client reply skip 时跳过当前和下一条命令
+	noEvict     atomic.Bool // client no-evict
+	killed      atomic.Bool // 是否已经被 client kill 关闭
 }
 
 func (c *Connection) GetDBIndex() int {
@@ -23,8 +64,151 @@ func (c *Connection) SelectDB(i int) {
 	c.selectedDB = i
 }
 
+func (c *Connection) IsAuthenticated() bool {
+	return c.authenticated
+}
+
+func (c *Connection) SetAuthenticated(authenticated bool) {
+	c.authenticated = authenticated
+}
+
+func (c *Connection) GetUser() string {
+	return c.user
+}
+
+func (c *Connection) SetUser(user string) {
+	c.user = user
+}
+
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// SetMultiState 设置 multi 状态，退出 multi 状态时会清空事务相关的数据
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+	c.statsMu.Lock()
+	c.stats.MultiCmds, c.stats.MultiMem = -1, 0
+	if state {
+		c.stats.MultiCmds = 0
+	}
+	c.statsMu.Unlock()
+}
+
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+	c.statsMu.Lock()
+	c.stats.MultiCmds++
+	c.stats.MultiMem += argvSize(cmdLine)
+	c.statsMu.Unlock()
+}
+
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+	c.statsMu.Lock()
+	if c.stats.MultiCmds > 0 {
+		c.stats.MultiCmds = 0
+	}
+	c.stats.MultiMem = 0
+	c.statsMu.Unlock()
+}
+
+func (c *Connection) GetWatching() map[resp.WatchKey]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[resp.WatchKey]uint32)
+	}
+	return c.watching
+}
+
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
+func (c *Connection) Subscribe(channel string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.channels == nil {
+		c.channels = make(map[string]struct{})
+	}
+	c.channels[channel] = struct{}{}
+}
+
+func (c *Connection) UnSubscribe(channel string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	delete(c.channels, channel)
+}
+
+func (c *Connection) GetChannels() []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	channels := make([]string, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func (c *Connection) PSubscribe(pattern string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.patterns == nil {
+		c.patterns = make(map[string]struct{})
+	}
+	c.patterns[pattern] = struct{}{}
+}
+
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	delete(c.patterns, pattern)
+}
+
+func (c *Connection) GetPatterns() []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	patterns := make([]string, 0, len(c.patterns))
+	for pattern := range c.patterns {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+func (c *Connection) SubsCount() int {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	return len(c.channels) + len(c.patterns)
+}
+
 func NewConnection(conn net.Conn) *Connection {
-	return &Connection{conn: conn}
+	now := time.Now()
+	return &Connection{
+		conn: conn,
+		id:   nextClientID.Add(1),
+		stats: resp.ClientStats{
+			CreateTime:      now,
+			LastInteraction: now,
+			MultiCmds:       -1,
+		},
+	}
+}
+
+// NewFakeConnection 服务端内部执行命令使用的连接，如加载aof和执行主节点转发的命令，没有底层网络连接，不需要认证
+func NewFakeConnection() *Connection {
+	return &Connection{authenticated: true}
 }
 
 func (c *Connection) Close() error {
@@ -33,8 +217,18 @@ func (c *Connection) Close() error {
 	return err
 }
 
-func (c *Connection) getRemoteAddr() net.Addr {
-	return c.conn.RemoteAddr()
+func (c *Connection) LocalAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.LocalAddr().String()
+}
+
+func (c *Connection) RemoteAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
 }
 
 // Write 向conn中进行写数据的方法，放置在并发环境造成写的问题，这里增加互斥锁保证写的串行化
@@ -49,3 +243,110 @@ func (c *Connection) Write(bytes []byte) error {
 	return err
 
 }
+
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+func (c *Connection) GetName() string {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.name
+}
+
+func (c *Connection) SetName(name string) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.name = name
+}
+
+func (c *Connection) GetStats() resp.ClientStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
+}
+
+// BeforeExec 执行命令前记录命令和收到的字节数
+func (c *Connection) BeforeExec(cmdLine [][]byte) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if _, ok := containerCommands[cmdName]; ok && len(cmdLine) > 1 {
+		cmdName += "|" + strings.ToLower(string(cmdLine[1]))
+	}
+	queryBuf := len("*" + strconv.Itoa(len(cmdLine)) + "\r\n")
+	for _, arg := range cmdLine {
+		queryBuf += len("$"+strconv.Itoa(len(arg))+"\r\n") + len(arg) + 2
+	}
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.LastCmd = cmdName
+	c.stats.LastInteraction = time.Now()
+	c.stats.QueryBuf = queryBuf
+	c.stats.ArgvMem = argvSize(cmdLine)
+}
+
+// AfterReply 记录回复的字节数
+func (c *Connection) AfterReply(size int) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.OutputBuf = size
+}
+
+func (c *Connection) SetReplyMode(mode int) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	switch mode {
+	case resp.ReplyOn:
+		c.replyOff = false
+		c.skipReplies = 0
+	case resp.ReplyOff:
+		c.replyOff = true
+	case resp.ReplySkip:
+		// 当前的 client reply skip 命令也不需要回复
+		c.skipReplies = 2
+	}
+}
+
+// NeedReply 当前命令的执行结果是否需要回复给客户端
+func (c *Connection) NeedReply() bool {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.skipReplies > 0 {
+		c.skipReplies--
+		return false
+	}
+	return !c.replyOff
+}
+
+func (c *Connection) SetNoEvict(noEvict bool) {
+	c.noEvict.Store(noEvict)
+}
+
+func (c *Connection) IsNoEvict() bool {
+	return c.noEvict.Load()
+}
+
+// Kill 关闭连接的读端，处理器读取到EOF之后关闭连接，正在执行的命令的回复仍然可以发送
+func (c *Connection) Kill() {
+	c.killed.Store(true)
+	if c.conn == nil {
+		return
+	}
+	if tcpConn, ok := c.conn.(*net.TCPConn); ok {
+		_ = tcpConn.CloseRead()
+		return
+	}
+	_ = c.conn.Close()
+}
+
+func (c *Connection) IsKilled() bool {
+	return c.killed.Load()
+}
+
+// argvSize 命令参数占用的字节数
+func argvSize(cmdLine [][]byte) int {
+	size := 0
+	for _, arg := range cmdLine {
+		size += len(arg)
+	}
+	return size
+}
@@ -4,30 +4,40 @@ import (
 	"context"
 	"io"
 	"net"
+	"redis-go/cluster"
+	"redis-go/config"
 	"redis-go/database"
 	databaseface "redis-go/interface/database"
+	"redis-go/interface/resp"
+	tcpface "redis-go/interface/tcp"
 	"redis-go/lib/logger"
 	"redis-go/lib/sync/atomic"
 	"redis-go/resp/connection"
 	"redis-go/resp/parser"
 	"redis-go/resp/reply"
+	"strings"
 	"sync"
+	syncatomic "sync/atomic"
 )
 
 type RespHandler struct {
-	activeConn sync.Map // 存放简历链接的Connection对象
-	db         databaseface.Database
-	closing    atomic.Boolean
+	activeConn  sync.Map // 存放简历链接的Connection对象
+	clientCount syncatomic.Int64
+	db          databaseface.Database
+	closing     atomic.Boolean
+	connStats   *tcpface.ConnStats // 服务端的连接统计，开始监听时设置
 }
 
 func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) error {
 	if h.closing.Get() { // 当前处于关闭状态，拒绝后续的client链接
 		// 关闭当前新的链接
 		_ = conn.Close()
+		return nil
 	}
 	// 创建客户端链接
 	client := connection.NewConnection(conn)
 	h.activeConn.Store(client, struct{}{})
+	h.clientCount.Add(1)
 
 	// 流式的接收消息
 	payLoads := parser.ParseStream(conn)
@@ -38,7 +48,7 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) error {
 			if payload.Err == io.EOF {
 				// 主动关闭当前链接
 				h.closeClient(client)
-				continue
+				return nil
 			} else {
 				_ = client.Write(reply.MakeStandardErrorReply(payload.Err.Error()).ToBytes())
 				continue
@@ -56,13 +66,26 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) error {
 			continue
 		}
 
+		// 被 client kill 关闭的连接不再执行已经收到的命令
+		if client.IsKilled() {
+			break
+		}
+		client.BeforeExec(bulkReply.Args)
 		res := h.db.Exec(client, bulkReply.Args)
-		err := client.Write(res.ToBytes())
+		if !client.NeedReply() {
+			continue
+		}
+		data := res.ToBytes()
+		err := client.Write(data)
 		if err != nil {
+			h.closeClient(client)
 			return err
 		}
+		client.AfterReply(len(data))
 
 	}
+	// 读取时发生了io异常，解析协程已经退出，需要清理链接
+	h.closeClient(client)
 	return nil
 }
 
@@ -80,12 +103,61 @@ func (h *RespHandler) Close() error {
 func (h *RespHandler) closeClient(client *connection.Connection) {
 	_ = client.Close()
 	h.db.AfterClientClose(client)
-	h.activeConn.Delete(client)
+	if _, loaded := h.activeConn.LoadAndDelete(client); loaded {
+		h.clientCount.Add(-1)
+	}
+}
+
+// ForEachClient 遍历所有活跃的客户端连接
+func (h *RespHandler) ForEachClient(consumer func(client resp.Connection) bool) {
+	h.activeConn.Range(func(key, value interface{}) bool {
+		return consumer(key.(*connection.Connection))
+	})
+}
+
+// ClientCount 活跃的客户端连接数
+func (h *RespHandler) ClientCount() int {
+	return int(h.clientCount.Load())
+}
+
+// SetConnStats 设置服务端的连接统计，开始监听时调用
+func (h *RespHandler) SetConnStats(stats *tcpface.ConnStats) {
+	h.connStats = stats
+}
+
+// ConnStats 服务端的连接统计
+func (h *RespHandler) ConnStats() *tcpface.ConnStats {
+	return h.connStats
 }
 
+// MakeHandler 创建处理器，开启了 clusterEnabled 时使用哈希槽的集群模式，配置了集群节点时使用转发的集群模式，否则使用单机模式
 func MakeHandler() *RespHandler {
-	db := database.NewStandaloneDatabase()
-	return &RespHandler{
+	if config.Properties.ClusterEnabled && config.Properties.Self != "" {
+		return NewHandler(cluster.MakeSlotClusterDatabase())
+	}
+	if config.Properties.Self != "" && hasPeers(config.Properties.Peers) {
+		return NewHandler(cluster.MakeClusterDatabase())
+	}
+	return NewHandler(database.NewStandaloneDatabase())
+}
+
+// hasPeers 配置中的peers为空字符串时会被解析为 [""]，需要过滤
+func hasPeers(peers []string) bool {
+	for _, peer := range peers {
+		if strings.TrimSpace(peer) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// NewHandler 使用指定的数据库创建处理器
+func NewHandler(db databaseface.Database) *RespHandler {
+	h := &RespHandler{
 		db: db,
 	}
+	if aware, ok := db.(databaseface.ClientsAware); ok {
+		aware.SetClients(h)
+	}
+	return h
 }
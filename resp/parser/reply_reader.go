@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"redis-go/interface/resp"
+	"redis-go/resp/reply"
+	"strconv"
+)
+
+// ReadReply 读取一个完整的回复，支持嵌套的数组，客户端读取服务端的回复时使用
+// 和 ParseStream 不同，数组中的元素可以是任意类型
+func ReadReply(reader *bufio.Reader) (resp.Reply, error) {
+	line, err := readReplyLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("[ReadReply error]: empty line")
+	}
+	switch line[0] {
+	case '+':
+		return reply.MakeStatusReply(string(line[1:])), nil
+	case '-':
+		return reply.MakeStandardErrorReply(string(line[1:])), nil
+	case ':':
+		code, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, errors.New("[ReadReply error]: illegal integer " + string(line))
+		}
+		return reply.MakeIntReply(code), nil
+	case '$':
+		arg, err := readBulk(reader, line)
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			return reply.MakeNullBulkReply(), nil
+		}
+		return reply.MakeBulkReply(arg), nil
+	case '*':
+		return readArray(reader, line)
+	}
+	return nil, errors.New("[ReadReply error]: illegal reply " + string(line))
+}
+
+// readReplyLine 读取以\r\n结尾的一行，不包含\r\n
+func readReplyLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("[ReadReply error]: line is not a resp Protocol")
+	}
+	return line[:len(line)-2], nil
+}
+
+// readBulk 读取字符串的内容，null 返回nil
+func readBulk(reader *bufio.Reader, header []byte) ([]byte, error) {
+	size, err := strconv.Atoi(string(header[1:]))
+	if err != nil {
+		return nil, errors.New("[ReadReply error]: illegal bulk header " + string(header))
+	}
+	if size < 0 {
+		return nil, nil
+	}
+	body := make([]byte, size+2)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body[:size], nil
+}
+
+// readArray 读取数组，所有元素都是字符串时返回 MultiBulkReply，否则返回 MultiRawReply
+func readArray(reader *bufio.Reader, header []byte) (resp.Reply, error) {
+	size, err := strconv.Atoi(string(header[1:]))
+	if err != nil {
+		return nil, errors.New("[ReadReply error]: illegal array header " + string(header))
+	}
+	if size < 0 {
+		return reply.MakeNullMultiBulkReply(), nil
+	}
+	if size == 0 {
+		return reply.MakeEmptyMultiBulkReply(), nil
+	}
+	replies := make([]resp.Reply, size)
+	allBulk := true
+	for i := range replies {
+		replies[i], err = ReadReply(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch replies[i].(type) {
+		case *reply.BulkReply, *reply.NullBulkReply:
+		default:
+			allBulk = false
+		}
+	}
+	if !allBulk {
+		return reply.MakeMultiRawReply(replies), nil
+	}
+	args := make([][]byte, size)
+	for i, r := range replies {
+		if bulk, ok := r.(*reply.BulkReply); ok {
+			args[i] = bulk.Arg
+			if args[i] == nil {
+				args[i] = []byte{}
+			}
+		}
+	}
+	return reply.MakeMultiBulkReply(args), nil
+}
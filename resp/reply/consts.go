@@ -60,6 +60,17 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return &EmptyMultiBulkReply{}
 }
 
+// NullMultiBulkReply 空的 MultiBulk 回复(数组 nil)
+type NullMultiBulkReply struct{}
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return []byte("*-1\r\n") // -1，表示 nil 数组
+}
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
 // NoReply 无回复
 type NoReply struct{}
 
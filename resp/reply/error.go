@@ -47,15 +47,30 @@ func MakeSyntaxErrReply() *SyntaxErrReply {
 	return &SyntaxErrReply{}
 }
 
+// IntErrReply 整数解析错误回复
+type IntErrReply struct{}
+
+func (r *IntErrReply) Error() string {
+	return "ERR value is not an integer or out of range"
+}
+
+func (r *IntErrReply) ToBytes() []byte {
+	return []byte("-ERR value is not an integer or out of range\r\n")
+}
+
+func MakeIntErrReply() *IntErrReply {
+	return &IntErrReply{}
+}
+
 // WrongTypeErrReply 类型错误回复
 type WrongTypeErrReply struct{}
 
 func (r *WrongTypeErrReply) Error() string {
-	return "WRONG TYPE Operation against a key holding the wrong kind of value"
+	return "WRONGTYPE Operation against a key holding the wrong kind of value"
 }
 
 func (r *WrongTypeErrReply) ToBytes() []byte {
-	return []byte("-WRONG TYPE Operation against a key holding the wrong kind of value\r\n")
+	return []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
 }
 
 func MakeWrongTypeErrReply() *WrongTypeErrReply {
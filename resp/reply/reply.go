@@ -44,6 +44,11 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	buffer := bytes.Buffer{}
 	buffer.WriteString("*" + strconv.Itoa(len(m.Args)) + CRLF)
 	for _, arg := range m.Args {
+		if arg == nil {
+			// nil 元素表示不存在的值，例如hmget中不存在的字段
+			buffer.WriteString("$-1" + CRLF)
+			continue
+		}
 		buffer.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
 	}
 	return buffer.Bytes()
@@ -55,6 +60,26 @@ func MakeMultiBulkReply(args [][]byte) *MultiBulkReply {
 	}
 }
 
+// MultiRawReply 嵌套数组回复，数组中的元素可以是任意类型的回复，例如scan命令返回的 [cursor, [keys...]]
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+func (m *MultiRawReply) ToBytes() []byte {
+	buffer := bytes.Buffer{}
+	buffer.WriteString("*" + strconv.Itoa(len(m.Replies)) + CRLF)
+	for _, r := range m.Replies {
+		buffer.Write(r.ToBytes())
+	}
+	return buffer.Bytes()
+}
+
+func MakeMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
 type StandardErrorReply struct {
 	Status string
 }
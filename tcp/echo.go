@@ -37,6 +37,7 @@ func (e *EchoHandler) Handle(ctx context.Context, conn net.Conn) error {
 	if e.closing.Get() { // 当前处于关闭状态，拒绝后续的client链接
 		// 关闭当前新的链接
 		_ = conn.Close()
+		return nil
 	}
 	// 创建客户端链接
 	client := &EchoClient{
@@ -2,22 +2,32 @@ package tcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"redis-go/interface/tcp"
 	"redis-go/lib/logger"
+	"redis-go/resp/reply"
 	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
 type Config struct {
-	Address string
+	Address    string
+	MaxConnect int // 最大客户端连接数，0表示不限制
 }
 
+// maxClientsErr 连接数达到上限时返回给新连接的错误
+const maxClientsErr = "ERR max number of clients reached"
+
 // ListenAndServeWithSignal 绑定端口，注册新号
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
+	if cfg == nil {
+		return errors.New("tcp server config is nil")
+	}
 	closeChan := make(chan struct{})
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
@@ -33,11 +43,20 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 		return err
 	}
 	logger.Info(fmt.Sprintf("bind: %s, start listening...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan)
+	ListenAndServe(listener, handler, closeChan, cfg)
 	return nil
 }
 
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
+// ListenAndServe 处理监听到的连接，cfg 为nil时使用默认配置
+func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}, cfg *Config) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	// 连接统计由当前服务端持有，处理器需要时交给处理器
+	stats := &tcp.ConnStats{}
+	if aware, ok := handler.(tcp.ConnStatsAware); ok {
+		aware.SetConnStats(stats)
+	}
 	go func() {
 		<-closeChan
 		_ = listener.Close()
@@ -51,16 +70,30 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 
 	ctx := context.Background() // 创建一个空白的context
 	wg := sync.WaitGroup{}      // 出现错误链接的时候，进行优雅退出
+	var connected atomic.Int64  // 当前处理中的连接数
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			logger.Error(err)
 			break
 		}
+		// 超过最大连接数时直接返回错误并关闭连接，不创建处理协程
+		if cfg.MaxConnect > 0 && connected.Load() >= int64(cfg.MaxConnect) {
+			stats.Rejected.Add(1)
+			logger.Info(fmt.Sprintf("reject connection: %s, max number of clients reached", conn.RemoteAddr().String()))
+			_, _ = conn.Write(reply.MakeStandardErrorReply(maxClientsErr).ToBytes())
+			_ = conn.Close()
+			continue
+		}
+		stats.Accepted.Add(1)
+		connected.Add(1)
 		logger.Info(fmt.Sprintf("get new connection: %s", conn.RemoteAddr().String()))
 		wg.Add(1)
 		go func() {
-			defer wg.Done()
+			defer func() {
+				connected.Add(-1)
+				wg.Done()
+			}()
 			_ = handler.Handle(ctx, conn)
 		}()
 	}
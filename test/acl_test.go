@@ -0,0 +1,192 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"strings"
+	"testing"
+)
+
+// acl单测
+
+func TestACLPermissions(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	admin, alice := &connection.Connection{}, &connection.Connection{}
+	execAs := func(conn *connection.Connection, args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+
+	if res := execAs(admin, "acl", "setuser", "alice", "on", ">pw", "~cache:*", "&news.*", "+@read", "+set", "-keys"); res != "+OK\r\n" {
+		t.Fatalf("setuser: %q", res)
+	}
+	if res := execAs(admin, "acl", "setuser", "alice", "+nosuchcmd"); !strings.HasPrefix(res, "-ERR Error in ACL SETUSER modifier '+nosuchcmd'") {
+		t.Fatalf("setuser with unknown command: %q", res)
+	}
+	if res := execAs(alice, "auth", "alice", "wrong"); !strings.HasPrefix(res, "-WRONGPASS") {
+		t.Fatalf("auth with wrong password: %q", res)
+	}
+	if res := execAs(alice, "auth", "alice", "pw"); res != "+OK\r\n" {
+		t.Fatalf("auth: %q", res)
+	}
+	if res := execAs(alice, "acl", "whoami"); res != "-NOPERM User alice has no permissions to run the 'acl' command\r\n" {
+		t.Fatalf("whoami: %q", res)
+	}
+	if res := execAs(admin, "acl", "whoami"); res != "$7\r\ndefault\r\n" {
+		t.Fatalf("whoami: %q", res)
+	}
+
+	// 命令权限和key权限
+	if res := execAs(alice, "set", "cache:1", "v"); res != "+OK\r\n" {
+		t.Fatalf("set allowed key: %q", res)
+	}
+	if res := execAs(alice, "get", "cache:1"); res != "$1\r\nv\r\n" {
+		t.Fatalf("get allowed key: %q", res)
+	}
+	if res := execAs(alice, "get", "secret"); res != "-NOPERM No permissions to access a key\r\n" {
+		t.Fatalf("get denied key: %q", res)
+	}
+	if res := execAs(alice, "mget", "cache:1", "secret"); res != "-NOPERM No permissions to access a key\r\n" {
+		t.Fatalf("mget denied key: %q", res)
+	}
+	if res := execAs(alice, "hset", "cache:h", "f", "v"); res != "-NOPERM User alice has no permissions to run the 'hset' command\r\n" {
+		t.Fatalf("hset: %q", res)
+	}
+	if res := execAs(alice, "keys", "*"); !strings.HasPrefix(res, "-NOPERM") {
+		t.Fatalf("keys should be removed from @read: %q", res)
+	}
+
+	// 频道权限，psubscribe 的模式需要完全相同
+	execAs(admin, "acl", "setuser", "alice", "+@pubsub", "+@transaction")
+	if res := execAs(alice, "publish", "news.sports", "hi"); res != ":0\r\n" {
+		t.Fatalf("publish allowed channel: %q", res)
+	}
+	if res := execAs(alice, "publish", "weather", "hi"); res != "-NOPERM No permissions to access a channel\r\n" {
+		t.Fatalf("publish denied channel: %q", res)
+	}
+	if res := execAs(alice, "psubscribe", "news.s*"); res != "-NOPERM No permissions to access a channel\r\n" {
+		t.Fatalf("psubscribe broader pattern: %q", res)
+	}
+
+	// 事务中没有权限的命令导致整个事务失败
+	execAs(alice, "multi")
+	if res := execAs(alice, "get", "secret"); !strings.HasPrefix(res, "-NOPERM") {
+		t.Fatalf("get in multi: %q", res)
+	}
+	if res := execAs(alice, "exec"); !strings.HasPrefix(res, "-EXECABORT") {
+		t.Fatalf("exec: %q", res)
+	}
+
+	// 用户信息
+	list := execAs(admin, "acl", "list")
+	if !strings.Contains(list, "user alice on #") || !strings.Contains(list, " ~cache:* &news.* -@all +@read +set -keys +@pubsub +@transaction\r\n") ||
+		!strings.Contains(list, "user default on nopass ~* &* +@all\r\n") {
+		t.Fatalf("acl list: %q", list)
+	}
+	if res := execAs(admin, "acl", "getuser", "alice"); !strings.HasPrefix(res, "*10\r\n$5\r\nflags\r\n*1\r\n$2\r\non\r\n$9\r\npasswords\r\n*1\r\n") {
+		t.Fatalf("getuser: %q", res)
+	}
+	if res := execAs(admin, "acl", "getuser", "nobody"); res != "$-1\r\n" {
+		t.Fatalf("getuser missing user: %q", res)
+	}
+	if res := execAs(admin, "acl", "cat"); !strings.Contains(res, "$9\r\nsortedset\r\n") {
+		t.Fatalf("acl cat: %q", res)
+	}
+	if res := execAs(admin, "acl", "cat", "hash"); !strings.Contains(res, "$7\r\nhgetall\r\n") || strings.Contains(res, "$3\r\nget\r\n") {
+		t.Fatalf("acl cat hash: %q", res)
+	}
+
+	// 被拒绝的命令记录到日志中，相同的记录合并计数
+	execAs(alice, "get", "secret")
+	logs := execAs(admin, "acl", "log")
+	if !strings.Contains(logs, "$5\r\ncount\r\n:3\r\n$6\r\nreason\r\n$3\r\nkey\r\n$7\r\ncontext\r\n$8\r\ntoplevel\r\n$6\r\nobject\r\n$6\r\nsecret\r\n") ||
+		!strings.Contains(logs, "$6\r\nreason\r\n$4\r\nauth\r\n") {
+		t.Fatalf("acl log: %q", logs)
+	}
+	if res := execAs(admin, "acl", "log", "1"); !strings.HasPrefix(res, "*1\r\n") {
+		t.Fatalf("acl log 1: %q", res)
+	}
+	execAs(admin, "acl", "log", "reset")
+	if res := execAs(admin, "acl", "log"); res != "*0\r\n" {
+		t.Fatalf("acl log after reset: %q", res)
+	}
+
+	// 集群命令和节点之间的内部命令只有 @admin 权限的用户可以执行
+	for _, cmd := range [][]string{{"cluster", "setslot", "0", "stable"}, {"asking"}, {"_relay", "get", "cache:1"}, {"_prepare", "tx", "del", "cache:1"}, {"_commit", "tx"}, {"_rollback", "tx"}} {
+		if res := execAs(alice, cmd...); res != "-NOPERM User alice has no permissions to run the '"+cmd[0]+"' command\r\n" {
+			t.Fatalf("%s: %q", cmd[0], res)
+		}
+	}
+
+	// 删除用户后连接需要重新认证
+	if res := execAs(admin, "acl", "deluser", "default"); !strings.HasPrefix(res, "-ERR The 'default' user cannot be removed") {
+		t.Fatalf("deluser default: %q", res)
+	}
+	if res := execAs(admin, "acl", "deluser", "alice", "nobody"); res != ":1\r\n" {
+		t.Fatalf("deluser: %q", res)
+	}
+	if res := execAs(alice, "get", "cache:1"); res != "-NOAUTH Authentication required.\r\n" {
+		t.Fatalf("get after deluser: %q", res)
+	}
+}
+
+func TestACLFile(t *testing.T) {
+	dir := t.TempDir()
+	aclFile := filepath.Join(dir, "users.acl")
+	content := "# users\nuser default on >secret ~* &* +@all\nuser bob on >bobpw ~bob:* +@string\n"
+	if err := os.WriteFile(aclFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(dir, "dump.rdb"), AclFile: aclFile}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	if res := exec("get", "bob:1"); res != "-NOAUTH Authentication required.\r\n" {
+		t.Fatalf("default user should require password: %q", res)
+	}
+	if res := exec("auth", "bob", "bobpw"); res != "+OK\r\n" {
+		t.Fatalf("auth bob: %q", res)
+	}
+	if res := exec("set", "bob:1", "v"); res != "+OK\r\n" {
+		t.Fatalf("set as bob: %q", res)
+	}
+	if res := exec("lpush", "bob:2", "v"); !strings.HasPrefix(res, "-NOPERM") {
+		t.Fatalf("lpush as bob: %q", res)
+	}
+
+	// 修改后保存到文件，重新加载后生效
+	exec("auth", "secret")
+	exec("acl", "setuser", "carol", "on", ">carolpw", "+get", "~*")
+	if res := exec("acl", "save"); res != "+OK\r\n" {
+		t.Fatalf("acl save: %q", res)
+	}
+	data, _ := os.ReadFile(aclFile)
+	if !strings.Contains(string(data), "user carol on #") {
+		t.Fatalf("acl file: %q", data)
+	}
+	exec("acl", "deluser", "carol")
+	if res := exec("acl", "load"); res != "+OK\r\n" {
+		t.Fatalf("acl load: %q", res)
+	}
+	if res := exec("auth", "carol", "carolpw"); res != "+OK\r\n" {
+		t.Fatalf("auth carol after load: %q", res)
+	}
+
+	// 文件有错误时不做修改
+	_ = os.WriteFile(aclFile, []byte("user broken on +nosuchcmd\n"), 0600)
+	exec("auth", "secret")
+	if res := exec("acl", "load"); !strings.HasPrefix(res, "-ERR "+aclFile+":1:") {
+		t.Fatalf("acl load broken file: %q", res)
+	}
+	if res := exec("acl", "users"); res != "*3\r\n$3\r\nbob\r\n$5\r\ncarol\r\n$7\r\ndefault\r\n" {
+		t.Fatalf("acl users: %q", res)
+	}
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"redis-go/aof"
+	"redis-go/config"
+	"redis-go/constant"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"redis-go/resp/reply"
+	"strings"
+	"testing"
+)
+
+// aof文件截断和损坏的处理单测
+
+// writeTestAof 生成一个包含若干命令的aof文件，返回文件内容
+func writeTestAof(t *testing.T, aofFile string) []byte {
+	config.Properties = &config.ServerProperties{AppendOnly: true, AppendFilename: aofFile}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	for i := 0; i < 10; i++ {
+		db.Exec(conn, utils.ToCmdLine("incr", "counter"))
+	}
+	db.Close()
+	data, err := os.ReadFile(aofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLoadTruncatedAof(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	data := writeTestAof(t, aofFile)
+	// 模拟最后一次写入不完整
+	partial := append(bytes.Clone(data), []byte("*2\r\n$4\r\nINCR\r\n$7\r\ncoun")...)
+	_ = os.WriteFile(aofFile, partial, 0600)
+
+	result, err := aof.Check(aofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !aof.IsTruncated(result.Err) || result.ValidSize != int64(len(data)) || result.Commands != 11 {
+		t.Fatalf("unexpected check result: %+v", result)
+	}
+
+	// 默认截断到最后一条完整的命令后继续加载
+	db := database.NewStandaloneDatabase()
+	res := string(db.Exec(&connection.Connection{}, utils.ToCmdLine("get", "counter")).ToBytes())
+	db.Close()
+	if res != "$2\r\n10\r\n" {
+		t.Errorf("expect counter 10, got %q", res)
+	}
+	if info, _ := os.Stat(aofFile); info.Size() != int64(len(data)) {
+		t.Errorf("expect aof file truncated to %d, got %d", len(data), info.Size())
+	}
+
+	// 配置为 no 时拒绝启动
+	_ = os.WriteFile(aofFile, partial, 0600)
+	config.Properties.AofLoadTruncated = "no"
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expect refuse to load truncated aof file")
+		}
+	}()
+	database.NewStandaloneDatabase()
+}
+
+func TestLoadCorruptedAof(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	data := writeTestAof(t, aofFile)
+	// 在文件中间的命令中写入错误的数据
+	offset := bytes.Index(data, []byte("*2\r\n$4\r\nINCR"))
+	corrupted := bytes.Clone(data)
+	corrupted[offset] = '?'
+	_ = os.WriteFile(aofFile, corrupted, 0600)
+
+	result, err := aof.Check(aofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corruptedErr *aof.CorruptedError
+	if aof.IsTruncated(result.Err) || result.ValidSize != int64(offset) {
+		t.Fatalf("unexpected check result: %+v", result)
+	}
+	if !errors.As(result.Err, &corruptedErr) || corruptedErr.Offset != int64(offset) {
+		t.Fatalf("expect corrupted at offset %d, got %v", offset, result.Err)
+	}
+
+	// 文件中间损坏时总是拒绝启动
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expect refuse to load corrupted aof file")
+		}
+	}()
+	database.NewStandaloneDatabase()
+}
+
+func TestReadCommandsUnclosedMulti(t *testing.T) {
+	var buf bytes.Buffer
+	var offsets []int
+	for _, line := range [][]string{{"set", "a", "1"}, {"multi"}, {"set", "b", "2"}} {
+		offsets = append(offsets, buf.Len())
+		buf.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(line...)).ToBytes())
+	}
+	// 事务没有exec时整个事务都是不完整的
+	count := 0
+	validEnd, err := aof.ReadCommands(bytes.NewReader(buf.Bytes()), 0, func(constant.CommandLine, int64) bool {
+		count++
+		return true
+	})
+	if !aof.IsTruncated(err) || validEnd != int64(offsets[1]) || count != 3 {
+		t.Errorf("expect truncated at multi offset %d, got %d %v", offsets[1], validEnd, err)
+	}
+}
+
+func TestCheckAofWithRdbPreamble(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties = &config.ServerProperties{
+		AppendOnly:        true,
+		AppendFilename:    aofFile,
+		AofUseRdbPreamble: true,
+	}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	// 较长的字符串在读取时逐步分配内存
+	large := strings.Repeat("v", 100000)
+	db.Exec(conn, utils.ToCmdLine("set", "large", large))
+	if err := db.RewriteAof(); err != nil {
+		t.Fatalf("rewrite aof failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		db.Exec(conn, utils.ToCmdLine("incr", "counter"))
+	}
+	db.Close()
+	data, _ := os.ReadFile(aofFile)
+	partial := append(bytes.Clone(data), []byte("*2\r\n$4\r\nINCR")...)
+	_ = os.WriteFile(aofFile, partial, 0600)
+
+	// rdb数据之后的命令从同一个reader中继续读取，偏移量从文件开头算起
+	result, err := aof.Check(aofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Preamble || !aof.IsTruncated(result.Err) || result.ValidSize != int64(len(data)) || result.Commands != 4 {
+		t.Fatalf("unexpected check result: %+v", result)
+	}
+	reloaded := database.NewStandaloneDatabase()
+	conn2 := &connection.Connection{}
+	counter := string(reloaded.Exec(conn2, utils.ToCmdLine("get", "counter")).ToBytes())
+	value := reloaded.Exec(conn2, utils.ToCmdLine("get", "large")).ToBytes()
+	reloaded.Close()
+	if counter != "$1\r\n3\r\n" || string(value) != string(reply.MakeBulkReply([]byte(large)).ToBytes()) {
+		t.Errorf("unexpected reloaded data, counter %q", counter)
+	}
+
+	// rdb数据损坏时校验失败
+	corrupted := bytes.Clone(data)
+	corrupted[bytes.Index(corrupted, []byte("large"))] ^= 0xFF
+	_ = os.WriteFile(aofFile, corrupted, 0600)
+	result, err = aof.Check(aofFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err == nil || aof.IsTruncated(result.Err) || result.ValidSize != 0 {
+		t.Errorf("expect invalid rdb preamble, got %+v", result)
+	}
+}
@@ -0,0 +1,229 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"redis-go/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// aof重写单测
+
+func TestRewriteAof(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties = &config.ServerProperties{
+		AppendOnly:     true,
+		AppendFilename: aofFile,
+	}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	for i := 0; i < 1000; i++ {
+		exec("incr", "counter")
+	}
+	exec("set", "ttl", "v", "EX", "1000")
+	exec("rpush", "list", "a", "b", "c")
+	exec("hset", "hash", "f", "v")
+	exec("select", "3")
+	exec("sadd", "set", "x", "y")
+	exec("zadd", "zset", "1.5", "m", "-inf", "n")
+	time.Sleep(100 * time.Millisecond)
+	before, _ := os.Stat(aofFile)
+
+	if err := db.RewriteAof(); err != nil {
+		t.Fatalf("rewrite aof failed: %v", err)
+	}
+	// 重写之后的写入需要追加到新文件中
+	exec("select", "0")
+	exec("incr", "counter")
+	time.Sleep(100 * time.Millisecond)
+	after, _ := os.Stat(aofFile)
+	if after.Size() >= before.Size() {
+		t.Errorf("expect aof file shrink, before %d, after %d", before.Size(), after.Size())
+	}
+
+	reloaded := database.NewStandaloneDatabase()
+	defer reloaded.Close()
+	conn2 := &connection.Connection{}
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"get", "counter"}, "$4\r\n1001\r\n"},
+		{[]string{"ttl", "ttl"}, ":1000\r\n"},
+		{[]string{"lrange", "list", "0", "-1"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"hget", "hash", "f"}, "$1\r\nv\r\n"},
+		{[]string{"select", "3"}, ":3\r\n"},
+		{[]string{"scard", "set"}, ":2\r\n"},
+		{[]string{"zrange", "zset", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nn\r\n$4\r\n-inf\r\n$1\r\nm\r\n$3\r\n1.5\r\n"},
+	}
+	for _, c := range cases {
+		if res := string(reloaded.Exec(conn2, utils.ToCmdLine(c.args...)).ToBytes()); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
+
+func TestAppendFsync(t *testing.T) {
+	for _, policy := range []string{"always", "everysec", "no"} {
+		aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+		config.Properties = &config.ServerProperties{
+			AppendOnly:     true,
+			AppendFilename: aofFile,
+			AppendFsync:    policy,
+		}
+		db := database.NewStandaloneDatabase()
+		conn := &connection.Connection{}
+		for i := 0; i < 100; i++ {
+			db.Exec(conn, utils.ToCmdLine("incr", "counter"))
+		}
+		// 关闭时需要将剩余的命令全部写入文件，关闭之后写入的命令被丢弃
+		db.Close()
+		db.Exec(conn, utils.ToCmdLine("incr", "counter"))
+
+		reloaded := database.NewStandaloneDatabase()
+		res := string(reloaded.Exec(conn, utils.ToCmdLine("get", "counter")).ToBytes())
+		reloaded.Close()
+		if res != "$3\r\n100\r\n" {
+			t.Errorf("%s: expect counter 100, got %q", policy, res)
+		}
+	}
+}
+
+func TestRewriteAofWithRdbPreamble(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties = &config.ServerProperties{
+		AppendOnly:        true,
+		AppendFilename:    aofFile,
+		AofUseRdbPreamble: true,
+	}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	for i := 0; i < 100; i++ {
+		exec("incr", "counter")
+	}
+	exec("set", "ttl", "v", "EX", "1000")
+	exec("rpush", "list", "a", "b", "c")
+	exec("select", "3")
+	exec("zadd", "zset", "1.5", "m")
+
+	if err := db.RewriteAof(); err != nil {
+		t.Fatalf("rewrite aof failed: %v", err)
+	}
+	// 重写之后的写入以resp格式追加在rdb文件头之后
+	exec("zadd", "zset", "2", "n")
+	exec("select", "0")
+	exec("incr", "counter")
+	exec("del", "list")
+	time.Sleep(100 * time.Millisecond)
+	data, _ := os.ReadFile(aofFile)
+	if !strings.HasPrefix(string(data), "REDISGO") {
+		t.Fatalf("expect aof file start with rdb preamble")
+	}
+
+	reloaded := database.NewStandaloneDatabase()
+	defer reloaded.Close()
+	conn2 := &connection.Connection{}
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"get", "counter"}, "$3\r\n101\r\n"},
+		{[]string{"ttl", "ttl"}, ":1000\r\n"},
+		{[]string{"exists", "list"}, ":0\r\n"},
+		{[]string{"select", "3"}, ":3\r\n"},
+		{[]string{"zrange", "zset", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nm\r\n$3\r\n1.5\r\n$1\r\nn\r\n$1\r\n2\r\n"},
+	}
+	for _, c := range cases {
+		if res := string(reloaded.Exec(conn2, utils.ToCmdLine(c.args...)).ToBytes()); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
+
+func TestRewriteAofWithConcurrentWrites(t *testing.T) {
+	for _, preamble := range []bool{false, true} {
+		aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+		config.Properties = &config.ServerProperties{
+			AppendOnly:        true,
+			AppendFilename:    aofFile,
+			AofUseRdbPreamble: preamble,
+		}
+		db := database.NewStandaloneDatabase()
+		conn := &connection.Connection{}
+		const keys = 10000
+		for i := 0; i < keys; i++ {
+			db.Exec(conn, utils.ToCmdLine("rpush", "list"+strconv.Itoa(i), "a"))
+		}
+		// 重写期间并发写入，写入前后的key都不能在快照和重写缓冲区中重复出现
+		var wg sync.WaitGroup
+		var writes atomic.Int64
+		stop := make(chan struct{})
+		pushed := make([]int, 4)
+		for w := range pushed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c := &connection.Connection{}
+				for i := w; ; i += len(pushed) {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					db.Exec(c, utils.ToCmdLine("rpush", "list"+strconv.Itoa(i%keys), "b"))
+					db.Exec(c, utils.ToCmdLine("incr", "counter"))
+					pushed[w]++
+					writes.Add(1)
+				}
+			}()
+		}
+		for writes.Load() < 100 {
+			time.Sleep(time.Millisecond)
+		}
+		err := db.RewriteAof()
+		close(stop)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("rewrite aof failed: %v", err)
+		}
+		db.Close()
+
+		reloaded := database.NewStandaloneDatabase()
+		conn2 := &connection.Connection{}
+		total := 0
+		for _, n := range pushed {
+			total += n
+		}
+		counter := reloaded.Exec(conn2, utils.ToCmdLine("get", "counter")).ToBytes()
+		if expect := reply.MakeBulkReply([]byte(strconv.Itoa(total))).ToBytes(); total > 0 && string(counter) != string(expect) {
+			t.Errorf("preamble %v: expect counter %d, got %q", preamble, total, counter)
+		}
+		length := 0
+		for i := 0; i < keys; i++ {
+			res := reloaded.Exec(conn2, utils.ToCmdLine("llen", "list"+strconv.Itoa(i))).ToBytes()
+			n, _ := strconv.Atoi(strings.TrimSpace(string(res[1:])))
+			length += n
+		}
+		if length != keys+total {
+			t.Errorf("preamble %v: expect total list length %d, got %d", preamble, keys+total, length)
+		}
+		reloaded.Close()
+	}
+}
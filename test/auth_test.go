@@ -0,0 +1,104 @@
+package test
+
+import (
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 密码认证单测
+
+func TestAuth(t *testing.T) {
+	config.Properties = &config.ServerProperties{
+		DbFilename:  filepath.Join(t.TempDir(), "dump.rdb"),
+		RequirePass: "secret",
+	}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+
+	if res := exec("set", "k", "v"); res != "-NOAUTH Authentication required.\r\n" {
+		t.Fatalf("unauthenticated set: %q", res)
+	}
+	if res := exec("ping"); res != "+PONG\r\n" {
+		t.Fatalf("unauthenticated ping: %q", res)
+	}
+	if res := exec("hello", "2"); !strings.HasPrefix(res, "-NOAUTH HELLO must be called") {
+		t.Fatalf("unauthenticated hello: %q", res)
+	}
+	if res := exec("auth", "wrong"); res != "-WRONGPASS invalid username-password pair or user is disabled.\r\n" {
+		t.Fatalf("auth with wrong password: %q", res)
+	}
+	if res := exec("auth", "someone", "secret"); !strings.HasPrefix(res, "-WRONGPASS") {
+		t.Fatalf("auth with unknown user: %q", res)
+	}
+	if res := exec("auth", "secret"); res != "+OK\r\n" {
+		t.Fatalf("auth: %q", res)
+	}
+	if res := exec("set", "k", "v"); res != "+OK\r\n" {
+		t.Fatalf("authenticated set: %q", res)
+	}
+	// 认证失败时保持原来的认证状态
+	exec("auth", "wrong")
+	if res := exec("get", "k"); res != "$1\r\nv\r\n" {
+		t.Fatalf("get after failed auth: %q", res)
+	}
+	if res := exec("auth", "default", "secret"); res != "+OK\r\n" {
+		t.Fatalf("auth with username: %q", res)
+	}
+
+	// hello 可以同时完成认证
+	conn = &connection.Connection{}
+	if res := exec("hello", "3"); res != "-NOPROTO unsupported protocol version\r\n" {
+		t.Fatalf("hello 3: %q", res)
+	}
+	if res := exec("hello", "2", "auth", "default", "secret"); !strings.HasPrefix(res, "*14\r\n$6\r\nserver\r\n") {
+		t.Fatalf("hello with auth: %q", res)
+	}
+	if res := exec("get", "k"); res != "$1\r\nv\r\n" {
+		t.Fatalf("get after hello: %q", res)
+	}
+}
+
+func TestAuthWithoutPassword(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	if res := string(db.Exec(conn, utils.ToCmdLine("auth", "any")).ToBytes()); !strings.HasPrefix(res, "-ERR AUTH <password> called without any password configured") {
+		t.Fatalf("auth without password configured: %q", res)
+	}
+	if res := string(db.Exec(conn, utils.ToCmdLine("auth", "default", "any")).ToBytes()); res != "+OK\r\n" {
+		t.Fatalf("auth default user: %q", res)
+	}
+}
+
+func TestClusterAuth(t *testing.T) {
+	config.Properties = &config.ServerProperties{
+		DbFilename:  filepath.Join(t.TempDir(), "dump.rdb"),
+		RequirePass: "secret",
+	}
+	nodes := startCluster(t, 2)
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(nodes[0].Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	if res := exec("get", "key1"); res != "-NOAUTH Authentication required.\r\n" {
+		t.Fatalf("unauthenticated get: %q", res)
+	}
+	exec("auth", "secret")
+	// 节点之间转发命令时使用相同的密码认证
+	for i := 0; i < 10; i++ {
+		if res := exec("set", "key"+strconv.Itoa(i), "v"); res != "+OK\r\n" {
+			t.Fatalf("set through cluster: %q", res)
+		}
+	}
+}
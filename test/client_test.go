@@ -0,0 +1,153 @@
+package test
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/client"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client命令单测
+
+func TestClientCommands(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	addr := "127.0.0.1:" + strconv.Itoa(startServer(t, db))
+	newClient := func() *client.Client {
+		cli, err := client.MakeClient(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = cli.Close() })
+		return cli
+	}
+	send := func(cli *client.Client, args ...string) string {
+		res, err := cli.Send(utils.ToCmdLine(args...))
+		if err != nil {
+			t.Fatalf("send %v: %v", args, err)
+		}
+		return string(res.ToBytes())
+	}
+	admin, worker := newClient(), newClient()
+
+	if res := send(admin, "client", "getname"); res != "$-1\r\n" {
+		t.Errorf("expect no name, got %q", res)
+	}
+	if res := send(worker, "client", "setname", "bad name"); !strings.HasPrefix(res, "-ERR Client names cannot contain spaces") {
+		t.Errorf("expect invalid name error, got %q", res)
+	}
+	send(worker, "client", "setname", "worker")
+	if res := send(worker, "client", "getname"); res != "$6\r\nworker\r\n" {
+		t.Errorf("unexpected name %q", res)
+	}
+	workerID := strings.Trim(send(worker, "client", "id"), ":\r\n")
+	send(worker, "set", "k", "v")
+
+	list := send(admin, "client", "list")
+	if !strings.Contains(list, "id="+workerID+" ") || !strings.Contains(list, "name=worker ") || !strings.Contains(list, "cmd=set ") {
+		t.Errorf("expect worker in client list, got %q", list)
+	}
+	if !strings.Contains(list, "cmd=client|list user=default") {
+		t.Errorf("expect current client in client list, got %q", list)
+	}
+	if res := send(admin, "client", "list", "id", workerID); strings.Count(res, "id=") != 1 || !strings.Contains(res, "name=worker") {
+		t.Errorf("unexpected client list by id %q", res)
+	}
+	if res := send(admin, "client", "info"); !strings.Contains(res, "cmd=client|info") || strings.Count(res, "id=") != 1 {
+		t.Errorf("unexpected client info %q", res)
+	}
+
+	// client kill 关闭其他连接，跳过当前连接
+	if res := send(admin, "client", "kill", "id", workerID); res != ":1\r\n" {
+		t.Errorf("expect one client killed, got %q", res)
+	}
+	if _, err := worker.Send(utils.ToCmdLine("ping")); err == nil {
+		t.Errorf("expect killed client closed")
+	}
+	if res := send(admin, "client", "kill", "user", "default"); res != ":0\r\n" {
+		t.Errorf("expect skip current client, got %q", res)
+	}
+	if res := send(admin, "client", "kill", "127.0.0.1:1"); res != "-ERR No such client\r\n" {
+		t.Errorf("expect no such client, got %q", res)
+	}
+
+	if res := send(admin, "client", "pause", "9223372036854775807"); res != "-ERR timeout is not an integer or out of range\r\n" {
+		t.Errorf("expect timeout out of range, got %q", res)
+	}
+
+	// client pause write 只暂停写入命令
+	writer := newClient()
+	send(admin, "client", "pause", "200", "write")
+	start := time.Now()
+	if res := send(writer, "get", "k"); res != "$1\r\nv\r\n" || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("expect read not paused, got %q after %v", res, time.Since(start))
+	}
+	if res := send(writer, "set", "k", "v2"); res != "+OK\r\n" || time.Since(start) < 150*time.Millisecond {
+		t.Errorf("expect write paused, got %q after %v", res, time.Since(start))
+	}
+
+	// client unpause 唤醒所有暂停的命令
+	send(admin, "client", "pause", "10000")
+	done := make(chan string, 1)
+	go func() {
+		res, _ := writer.Send(utils.ToCmdLine("get", "k"))
+		done <- string(res.ToBytes())
+	}()
+	select {
+	case res := <-done:
+		t.Fatalf("expect command paused, got %q", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+	send(admin, "client", "unpause")
+	select {
+	case res := <-done:
+		if res != "$2\r\nv2\r\n" {
+			t.Errorf("unexpected reply after unpause %q", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect command resumed after unpause")
+	}
+}
+
+func TestClientReply(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(startServer(t, db)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	write := func(args ...string) {
+		_, _ = conn.Write([]byte("*" + strconv.Itoa(len(args)) + "\r\n"))
+		for _, arg := range args {
+			_, _ = conn.Write([]byte("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"))
+		}
+	}
+	// skip 跳过当前和下一条命令的回复，off 之后不回复直到 on
+	write("client", "reply", "skip")
+	write("ping")
+	write("get", "missing")
+	write("client", "reply", "off")
+	write("ping")
+	write("client", "reply", "on")
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read reply: %v, got %q", err, lines)
+		}
+		lines = append(lines, line)
+	}
+	if lines[0] != "$-1\r\n" || lines[1] != "+OK\r\n" {
+		t.Errorf("unexpected replies %q", lines)
+	}
+}
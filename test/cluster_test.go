@@ -0,0 +1,299 @@
+package test
+
+import (
+	"net"
+	"path/filepath"
+	"redis-go/cluster"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/consistenthash"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"redis-go/resp/handler"
+	"redis-go/resp/reply"
+	"redis-go/tcp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 集群模式单测
+
+func TestConsistentHash(t *testing.T) {
+	m := consistenthash.New(100, nil)
+	if m.PickNode("a") != "" {
+		t.Fatal("empty map should pick nothing")
+	}
+	m.AddNode("127.0.0.1:6379", "127.0.0.1:6380", "127.0.0.1:6381")
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[m.PickNode("key"+strconv.Itoa(i))]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("keys should spread over all nodes, got %v", counts)
+	}
+	// hash tag 相同的key分布在同一个节点
+	for i := 0; i < 100; i++ {
+		if m.PickNode("{user1000}.following"+strconv.Itoa(i)) != m.PickNode("{user1000}.followers") {
+			t.Fatal("keys with the same hash tag should be on the same node")
+		}
+	}
+}
+
+// startCluster 在随机端口上启动多个集群节点
+func startCluster(t *testing.T, size int) []*cluster.ClusterDatabase {
+	listeners := make([]net.Listener, size)
+	addrs := make([]string, size)
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+		addrs[i] = listener.Addr().String()
+	}
+	nodes := make([]*cluster.ClusterDatabase, size)
+	for i, listener := range listeners {
+		nodes[i] = cluster.NewClusterDatabase(addrs[i], addrs)
+		closeChan := make(chan struct{})
+		go tcp.ListenAndServe(listener, handler.NewHandler(nodes[i]), closeChan, &tcp.Config{})
+		t.Cleanup(func() { close(closeChan) })
+	}
+	return nodes
+}
+
+func TestCluster(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	nodes := startCluster(t, 2)
+	conn0, conn1 := &connection.Connection{}, &connection.Connection{}
+	exec := func(node int, args ...string) string {
+		conn := conn0
+		if node == 1 {
+			conn = conn1
+		}
+		return string(nodes[node].Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+
+	// 通过任意节点写入的key都可以从其他节点读取
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		if res := exec(i%2, "set", key, strconv.Itoa(i)); res != "+OK\r\n" {
+			t.Fatalf("set %s: %q", key, res)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		value := strconv.Itoa(i)
+		expected := "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+		if res := exec((i+1)%2, "get", key); res != expected {
+			t.Fatalf("get %s: %q", key, res)
+		}
+	}
+	if res := exec(0, "keys", "*"); res[:4] != "*20\r" {
+		t.Fatalf("keys should merge all nodes: %q", res)
+	}
+
+	// 涉及多个节点的key的命令返回错误，hash tag 相同的key可以一起操作
+	crossed := false
+	for i := 1; i < 20 && !crossed; i++ {
+		res := exec(0, "sinter", "key0", "key"+strconv.Itoa(i))
+		crossed = res == "-ERR keys in request don't hash to the same node\r\n"
+	}
+	if !crossed {
+		t.Fatal("keys should be distributed to different nodes")
+	}
+	if res := exec(1, "mset", "{tag}a", "1", "{tag}b", "2"); res != "+OK\r\n" {
+		t.Fatalf("mset with hash tag: %q", res)
+	}
+
+	// mget 和 exists 从多个节点收集结果
+	if res := exec(1, "mget", "key1", "key2", "missing", "{tag}b"); res != "*4\r\n$1\r\n1\r\n$1\r\n2\r\n$-1\r\n$1\r\n2\r\n" {
+		t.Fatalf("mget: %q", res)
+	}
+	if res := exec(0, "exists", "key1", "key2", "key3", "missing"); res != ":3\r\n" {
+		t.Fatalf("exists: %q", res)
+	}
+
+	// 转发时使用客户端当前选择的db
+	exec(0, "select", "1")
+	exec(0, "set", "key5", "db1")
+	if res := exec(0, "get", "key5"); res != "$3\r\ndb1\r\n" {
+		t.Fatalf("get in db1: %q", res)
+	}
+	if res := exec(1, "get", "key5"); res != "$1\r\n5\r\n" {
+		t.Fatalf("get in db0: %q", res)
+	}
+
+	if res := exec(0, "multi"); res != "-ERR command 'multi' is not supported in cluster mode\r\n" {
+		t.Fatalf("multi: %q", res)
+	}
+	if res := exec(1, "flush"); res != "+OK\r\n" {
+		t.Fatalf("flush: %q", res)
+	}
+	if res := exec(0, "select", "0"); res != ":0\r\n" {
+		t.Fatalf("select: %q", res)
+	}
+	if res := exec(0, "keys", "*"); res != "*0\r\n" {
+		t.Fatalf("keys after flush: %q", res)
+	}
+}
+
+// crossKeys 找到分布在不同节点上的两个key
+func crossKeys(t *testing.T, node *cluster.ClusterDatabase, conn *connection.Connection) (string, string) {
+	for i := 1; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		res := node.Exec(conn, utils.ToCmdLine("sinter", "key0", key))
+		if string(res.ToBytes()) == "-ERR keys in request don't hash to the same node\r\n" {
+			return "key0", key
+		}
+	}
+	t.Fatal("keys should be distributed to different nodes")
+	return "", ""
+}
+
+func TestClusterTransaction(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	nodes := startCluster(t, 2)
+	conn := &connection.Connection{}
+	exec := func(node int, args ...string) string {
+		return string(nodes[node].Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	k1, k2 := crossKeys(t, nodes[0], conn)
+
+	// 跨节点的 rename 同时转移数据和过期时间
+	exec(0, "rpush", k1, "a", "b", "c")
+	exec(0, "expire", k1, "100")
+	if res := exec(1, "rename", k1, k2); res != "+OK\r\n" {
+		t.Fatalf("rename: %q", res)
+	}
+	if res := exec(0, "exists", k1); res != ":0\r\n" {
+		t.Fatalf("src should be removed: %q", res)
+	}
+	if res := exec(0, "lrange", k2, "0", "-1"); res != "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n" {
+		t.Fatalf("dst value: %q", res)
+	}
+	if res := exec(0, "ttl", k2); res != ":100\r\n" && res != ":99\r\n" {
+		t.Fatalf("dst ttl: %q", res)
+	}
+	if res := exec(0, "rename", k1, k2); res != "-no such key\r\n" {
+		t.Fatalf("rename missing key: %q", res)
+	}
+
+	// 目标key存在时 renamenx 在两个节点上都不生效
+	exec(0, "set", k1, "v1")
+	if res := exec(0, "renamenx", k1, k2); res != "-key already exists\r\n" {
+		t.Fatalf("renamenx: %q", res)
+	}
+	if res := exec(1, "get", k1); res != "$2\r\nv1\r\n" {
+		t.Fatalf("src should be kept: %q", res)
+	}
+	if res := exec(1, "llen", k2); res != ":3\r\n" {
+		t.Fatalf("dst should be kept: %q", res)
+	}
+
+	// msetnx 任意key已经存在时不写入
+	if res := exec(0, "msetnx", k1, "1", k2, "2"); res != ":0\r\n" {
+		t.Fatalf("msetnx: %q", res)
+	}
+	if res := exec(0, "get", k1); res != "$2\r\nv1\r\n" {
+		t.Fatalf("msetnx should write nothing: %q", res)
+	}
+	exec(0, "del", k1)
+	exec(0, "del", k2)
+	if res := exec(0, "msetnx", k1, "1", k2, "2"); res != ":1\r\n" {
+		t.Fatalf("msetnx: %q", res)
+	}
+
+	// 跨节点的 del
+	if res := exec(1, "del", k1, k2, "missing"); res != ":2\r\n" {
+		t.Fatalf("del: %q", res)
+	}
+	if res := exec(0, "exists", k1, k2); res != ":0\r\n" {
+		t.Fatalf("keys should be deleted: %q", res)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	exec("sadd", "s", "a", "b")
+	exec("set", "str", "v")
+	exec("expire", "str", "100")
+
+	// 已经提交的事务通过undo日志恢复
+	if res := db.PrepareTx(conn, utils.ToCmdLine("tx1", "del", "s", "str", "missing")); reply.IsErrReply(res) {
+		t.Fatalf("prepare: %q", res.ToBytes())
+	}
+	if res := db.CommitTx(utils.ToCmdLine("tx1")); string(res.ToBytes()) != ":2\r\n" {
+		t.Fatalf("commit: %q", res.ToBytes())
+	}
+	if res := db.RollbackTx(utils.ToCmdLine("tx1")); string(res.ToBytes()) != "+OK\r\n" {
+		t.Fatalf("rollback: %q", res.ToBytes())
+	}
+	if res := exec("scard", "s"); res != ":2\r\n" {
+		t.Fatalf("set should be restored: %q", res)
+	}
+	if res := exec("get", "str"); res != "$1\r\nv\r\n" {
+		t.Fatalf("string should be restored: %q", res)
+	}
+	if res := exec("ttl", "str"); res != ":100\r\n" && res != ":99\r\n" {
+		t.Fatalf("ttl should be restored: %q", res)
+	}
+	if res := exec("exists", "missing"); res != ":0\r\n" {
+		t.Fatalf("missing key should stay missing: %q", res)
+	}
+
+	// 准备失败时释放锁，未提交的事务回滚后不能再提交
+	if res := db.PrepareTx(conn, utils.ToCmdLine("tx2", "msetnx", "s", "1")); string(res.ToBytes()) != "-key already exists\r\n" {
+		t.Fatalf("prepare msetnx: %q", res.ToBytes())
+	}
+	db.PrepareTx(conn, utils.ToCmdLine("tx3", "del", "s"))
+	db.RollbackTx(utils.ToCmdLine("tx3"))
+	if res := db.CommitTx(utils.ToCmdLine("tx3")); !reply.IsErrReply(res) {
+		t.Fatalf("commit after rollback: %q", res.ToBytes())
+	}
+	if res := exec("del", "s"); res != ":1\r\n" {
+		t.Fatalf("keys should be unlocked: %q", res)
+	}
+
+	// 回滚先于准备到达时，之后的准备被拒绝且不锁定key
+	db.RollbackTx(utils.ToCmdLine("tx4"))
+	if res := db.PrepareTx(conn, utils.ToCmdLine("tx4", "del", "str")); string(res.ToBytes()) != "-ERR transaction tx4 is rolledback\r\n" {
+		t.Fatalf("prepare after rollback: %q", res.ToBytes())
+	}
+	if res := exec("del", "str"); res != ":1\r\n" {
+		t.Fatalf("keys should not be locked: %q", res)
+	}
+}
+
+func TestRelayTxAccess(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	node := cluster.NewClusterDatabase("127.0.0.1:0", nil)
+	defer node.Close()
+	admin, alice := &connection.Connection{}, &connection.Connection{}
+	exec := func(conn *connection.Connection, args ...string) string {
+		return string(node.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	exec(admin, "set", "secret", "v")
+	exec(admin, "acl", "setuser", "alice", "on", ">pw", "~foo*", "+@all")
+	exec(alice, "auth", "alice", "pw")
+
+	// 通过 _relay 执行事务命令时同样需要检查key的权限
+	if res := exec(alice, "_relay", "_prepare", "t1", "del", "secret"); res != "-NOPERM No permissions to access a key\r\n" {
+		t.Fatalf("relay prepare with denied key: %q", res)
+	}
+	if res := exec(alice, "_relay", "_commit", "t1"); !strings.HasPrefix(res, "-ERR transaction t1 not found") {
+		t.Fatalf("relay commit: %q", res)
+	}
+	if res := exec(admin, "get", "secret"); res != "$1\r\nv\r\n" {
+		t.Fatalf("expect secret kept, got %q", res)
+	}
+	if res := exec(alice, "_relay", "_prepare", "t2", "del", "foo"); res != "+OK\r\n" {
+		t.Fatalf("relay prepare with allowed key: %q", res)
+	}
+	exec(alice, "_relay", "_rollback", "t2")
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"testing"
+	"time"
+)
+
+// 过期相关命令单测
+
+func TestExpire(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	db.Exec(nil, utils.ToCmdLine("set", "hello", "world"))
+	if res := string(db.Exec(nil, utils.ToCmdLine("ttl", "hello")).ToBytes()); res != ":-1\r\n" {
+		t.Errorf("expect ttl -1, got %q", res)
+	}
+	if res := string(db.Exec(nil, utils.ToCmdLine("pexpire", "hello", "100")).ToBytes()); res != ":1\r\n" {
+		t.Errorf("expect pexpire 1, got %q", res)
+	}
+	if res := string(db.Exec(nil, utils.ToCmdLine("expire", "hello", "100", "NX")).ToBytes()); res != ":0\r\n" {
+		t.Errorf("expect expire nx 0, got %q", res)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if res := string(db.Exec(nil, utils.ToCmdLine("get", "hello")).ToBytes()); res != "$-1\r\n" {
+		t.Errorf("expect expired key, got %q", res)
+	}
+	if res := string(db.Exec(nil, utils.ToCmdLine("ttl", "hello")).ToBytes()); res != ":-2\r\n" {
+		t.Errorf("expect ttl -2, got %q", res)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	db.Exec(nil, utils.ToCmdLine("set", "hello", "world"))
+	db.Exec(nil, utils.ToCmdLine("expire", "hello", "100"))
+	if res := string(db.Exec(nil, utils.ToCmdLine("ttl", "hello")).ToBytes()); res != ":100\r\n" {
+		t.Errorf("expect ttl 100, got %q", res)
+	}
+	if res := string(db.Exec(nil, utils.ToCmdLine("persist", "hello")).ToBytes()); res != ":1\r\n" {
+		t.Errorf("expect persist 1, got %q", res)
+	}
+	if res := string(db.Exec(nil, utils.ToCmdLine("ttl", "hello")).ToBytes()); res != ":-1\r\n" {
+		t.Errorf("expect ttl -1, got %q", res)
+	}
+	// 过期时间溢出时返回错误，不会被当作过去的时间删除key
+	for _, args := range [][]string{{"expire", "hello", "9223372036854775"}, {"pexpire", "hello", "9223372036854775807"}} {
+		if res := string(db.Exec(nil, utils.ToCmdLine(args...)).ToBytes()); res != "-ERR invalid expire time in '"+args[0]+"' command\r\n" {
+			t.Errorf("%v: expect invalid expire time, got %q", args, res)
+		}
+	}
+	if _, exists := db.GetEntity("hello"); !exists {
+		t.Errorf("expect key kept after invalid expire time")
+	}
+	// 过去的时间戳直接删除key
+	db.Exec(nil, utils.ToCmdLine("expireat", "hello", "1"))
+	if _, exists := db.GetEntity("hello"); exists {
+		t.Errorf("expect key removed by expireat in the past")
+	}
+}
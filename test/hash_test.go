@@ -0,0 +1,38 @@
+package test
+
+import (
+	"redis-go/database"
+	"testing"
+)
+
+// hash相关命令单测
+
+func TestHashCommands(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"hset", "h", "a", "1", "b", "2"}, ":2\r\n"},
+		{[]string{"hset", "h", "a", "3"}, ":0\r\n"},
+		{[]string{"hget", "h", "a"}, "$1\r\n3\r\n"},
+		{[]string{"hmget", "h", "a", "c"}, "*2\r\n$1\r\n3\r\n$-1\r\n"},
+		{[]string{"hincrby", "h", "a", "5"}, ":8\r\n"},
+		{[]string{"hincrbyfloat", "h", "b", "0.5"}, "$3\r\n2.5\r\n"},
+		{[]string{"hexists", "h", "b"}, ":1\r\n"},
+		{[]string{"hlen", "h"}, ":2\r\n"},
+		{[]string{"hscan", "h", "0", "COUNT", "1"}, "*2\r\n$1\r\n1\r\n*2\r\n$1\r\na\r\n$1\r\n8\r\n"},
+		{[]string{"hscan", "h", "1", "NOVALUES"}, "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nb\r\n"},
+		{[]string{"hscan", "h", "0", "COUNT", "9223372036854775807", "NOVALUES"}, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"hscan", "h", "9223372036854775807", "COUNT", "9223372036854775807"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{[]string{"type", "h"}, "+hash\r\n"},
+		{[]string{"strlen", "h"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"hdel", "h", "a", "b", "c"}, ":2\r\n"},
+		{[]string{"exists", "h"}, ":0\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/client"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// info命令单测
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	config.Properties = &config.ServerProperties{
+		DbFilename:     filepath.Join(dir, "dump.rdb"),
+		AppendOnly:     true,
+		AppendFilename: filepath.Join(dir, "appendonly.aof"),
+		MaxClients:     100,
+	}
+	db := database.NewStandaloneDatabase()
+	cli, err := client.MakeClient("127.0.0.1:" + strconv.Itoa(startServer(t, db)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cli.Close() }()
+	send := func(args ...string) string {
+		res, err := cli.Send(utils.ToCmdLine(args...))
+		if err != nil {
+			t.Fatalf("send %v: %v", args, err)
+		}
+		return string(res.ToBytes())
+	}
+	send("set", "a", "1")
+	send("set", "b", "1", "ex", "100")
+	send("select", "3")
+	send("rpush", "list", "x")
+
+	info := send("info")
+	for _, header := range []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Stats", "# Replication", "# Cluster", "# Keyspace"} {
+		if !strings.Contains(info, header+"\r\n") {
+			t.Errorf("expect section %q in info, got %q", header, info)
+		}
+	}
+	for _, field := range []string{"redis_version:7.0.0", "connected_clients:1", "maxclients:100", "aof_enabled:1",
+		"aof_last_write_status:ok", "rdb_last_bgsave_status:ok", "cluster_enabled:0", "db3:keys=1,expires=0,avg_ttl=0"} {
+		if !strings.Contains(info, "\r\n"+field+"\r\n") {
+			t.Errorf("expect %q in info, got %q", field, info)
+		}
+	}
+	if keyspace := infoField(info, "db0"); !strings.HasPrefix(keyspace, "keys=2,expires=1,avg_ttl=") {
+		t.Errorf("unexpected db0 keyspace %q", keyspace)
+	}
+	if uptime := infoField(info, "uptime_in_seconds"); uptime == "" {
+		t.Errorf("expect uptime in info")
+	}
+	if rss := mustAtoi(infoField(info, "used_memory_rss")); rss <= 0 {
+		t.Errorf("expect process rss, got %q", infoField(info, "used_memory_rss"))
+	}
+	if fsyncTime := int64(mustAtoi(infoField(info, "aof_last_fsync_time"))); fsyncTime < time.Now().Add(-time.Minute).Unix() || fsyncTime > time.Now().Unix() {
+		t.Errorf("unexpected aof last fsync time %q", infoField(info, "aof_last_fsync_time"))
+	}
+	if size := mustAtoi(infoField(info, "aof_current_size")); size <= 0 {
+		t.Errorf("expect aof file size, got %q", infoField(info, "aof_current_size"))
+	}
+
+	// 已经过期但还没有删除的key不计入过期key的统计
+	send("select", "5")
+	send("set", "expired", "1", "px", "1")
+	time.Sleep(5 * time.Millisecond)
+	if keyspace := infoField(send("info", "keyspace"), "db5"); keyspace != "" && !strings.HasPrefix(keyspace, "keys=1,expires=0,") {
+		t.Errorf("unexpected db5 keyspace %q", keyspace)
+	}
+
+	// 指定分组时只输出对应的分组
+	keyspace := send("info", "keyspace")
+	if !strings.Contains(keyspace, "# Keyspace\r\n") || strings.Contains(keyspace, "# Server") {
+		t.Errorf("unexpected keyspace info %q", keyspace)
+	}
+
+	// 执行过的命令数和每秒执行命令数
+	processed := mustAtoi(infoField(send("info", "stats"), "total_commands_processed"))
+	for i := 0; i < 100; i++ {
+		send("ping")
+	}
+	waitFor(t, "ops per second", func() bool {
+		return mustAtoi(infoField(send("info", "stats"), "instantaneous_ops_per_sec")) > 0
+	})
+	if now := mustAtoi(infoField(send("info", "stats"), "total_commands_processed")); now < processed+100 {
+		t.Errorf("expect total commands processed increased by 100, got %d -> %d", processed, now)
+	}
+}
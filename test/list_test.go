@@ -0,0 +1,100 @@
+package test
+
+import (
+	"math/rand"
+	"redis-go/database"
+	"redis-go/datastruct/list"
+	"testing"
+)
+
+// 列表相关单测
+
+// TestQuickList 随机操作快速列表，并与切片的结果进行比对
+func TestQuickList(t *testing.T) {
+	ql := list.MakeQuickList()
+	expect := make([]int, 0)
+	for i := 0; i < 20000; i++ {
+		// 插入操作的概率更高，保证会出现分页拆分
+		switch op := rand.Intn(8); {
+		case op == 0 || op > 5:
+			ql.Add(i)
+			expect = append(expect, i)
+		case op == 1:
+			ql.AddFirst(i)
+			expect = append([]int{i}, expect...)
+		case op == 2 && len(expect) > 0:
+			index := rand.Intn(len(expect))
+			ql.Insert(index, i)
+			expect = append(expect[:index], append([]int{i}, expect[index:]...)...)
+		case op == 3 && len(expect) > 0:
+			index := rand.Intn(len(expect))
+			ql.Remove(index)
+			expect = append(expect[:index], expect[index+1:]...)
+		case op == 4 && len(expect) > 0:
+			ql.RemoveLast()
+			expect = expect[:len(expect)-1]
+		case op == 5 && len(expect) > 0:
+			ql.RemoveFirst()
+			expect = expect[1:]
+		}
+	}
+	if ql.Len() != len(expect) {
+		t.Fatalf("expect len %d, got %d", len(expect), ql.Len())
+	}
+	ql.ForEach(func(i int, v interface{}) bool {
+		if v.(int) != expect[i] {
+			t.Fatalf("index %d: expect %d, got %d", i, expect[i], v.(int))
+		}
+		return true
+	})
+	// 按值删除
+	even := func(a interface{}) bool { return a.(int)%2 == 0 }
+	removed := ql.ReverseRemoveByVal(even, 0)
+	remain := make([]int, 0)
+	for _, v := range expect {
+		if v%2 != 0 {
+			remain = append(remain, v)
+		}
+	}
+	if removed != len(expect)-len(remain) || ql.Len() != len(remain) {
+		t.Fatalf("expect %d removed, got %d", len(expect)-len(remain), removed)
+	}
+	for i, v := range ql.Range(0, ql.Len()) {
+		if v.(int) != remain[i] {
+			t.Fatalf("index %d: expect %d, got %d", i, remain[i], v.(int))
+		}
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"rpush", "l", "a", "b", "c"}, ":3\r\n"},
+		{[]string{"lpush", "l", "z"}, ":4\r\n"},
+		{[]string{"lrange", "l", "0", "-1"}, "*4\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"linsert", "l", "BEFORE", "b", "x"}, ":5\r\n"},
+		{[]string{"lindex", "l", "-3"}, "$1\r\nx\r\n"},
+		{[]string{"lset", "l", "0", "y"}, "+OK\r\n"},
+		{[]string{"lrem", "l", "0", "y"}, ":1\r\n"},
+		{[]string{"ltrim", "l", "1", "-1"}, "+OK\r\n"},
+		{[]string{"lrange", "l", "0", "-1"}, "*3\r\n$1\r\nx\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ltrim", "l", "0", "9223372036854775807"}, "+OK\r\n"},
+		{[]string{"lrange", "l", "-9223372036854775808", "9223372036854775807"}, "*3\r\n$1\r\nx\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"rpop", "l", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"lpop", "l"}, "$1\r\nx\r\n"},
+		{[]string{"exists", "l"}, ":0\r\n"},
+		{[]string{"lpop", "l", "1"}, "*-1\r\n"},
+		{[]string{"rpush", "l", "a"}, ":1\r\n"},
+		{[]string{"type", "l"}, "+list\r\n"},
+		{[]string{"get", "l"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"lpop", "l", "9223372036854775807"}, "*1\r\n$1\r\na\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/client"
+	"redis-go/resp/handler"
+	"redis-go/resp/reply"
+	"redis-go/tcp"
+	"strconv"
+	"testing"
+)
+
+// 最大连接数单测
+
+func TestMaxClients(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go tcp.ListenAndServe(listener, handler.NewHandler(database.NewStandaloneDatabase()), closeChan, &tcp.Config{MaxConnect: 1})
+	defer close(closeChan)
+	addr := "127.0.0.1:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	ping := func(conn net.Conn) string {
+		_, _ = conn.Write([]byte("*1\r\n$4\r\nping\r\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return line
+	}
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := ping(first); res != "+PONG\r\n" {
+		t.Fatalf("unexpected ping reply %q", res)
+	}
+
+	// 超过上限的连接收到错误后被关闭
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(second)
+	if line, _ := reader.ReadString('\n'); line != "-ERR max number of clients reached\r\n" {
+		t.Errorf("expect max clients error, got %q", line)
+	}
+	if _, err := reader.ReadByte(); err == nil {
+		t.Errorf("expect rejected connection closed")
+	}
+	_ = second.Close()
+
+	// 已有连接断开之后可以建立新的连接
+	_ = first.Close()
+	waitFor(t, "connection released", func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		defer func() { _ = conn.Close() }()
+		return ping(conn) == "+PONG\r\n"
+	})
+	// 连接统计只包含当前服务端的连接
+	waitFor(t, "connection released", func() bool {
+		cli, err := client.MakeClient(addr)
+		if err != nil {
+			return false
+		}
+		defer func() { _ = cli.Close() }()
+		res, err := cli.Send(utils.ToCmdLine("info", "stats"))
+		if err != nil || reply.IsErrReply(res) {
+			return false
+		}
+		info := string(res.ToBytes())
+		if accepted, rejected := mustAtoi(infoField(info, "total_connections_received")), mustAtoi(infoField(info, "rejected_connections")); accepted != 3 || rejected < 1 {
+			t.Errorf("unexpected connection stats %q", info)
+		}
+		return true
+	})
+}
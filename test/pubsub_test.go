@@ -0,0 +1,82 @@
+package test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"redis-go/lib/utils"
+	"redis-go/pubsub"
+	"redis-go/resp/connection"
+	"testing"
+	"time"
+)
+
+// 发布订阅相关命令单测
+
+// pipeConn 创建一个基于内存管道的连接，写入连接的数据可以从返回的reader中读出
+func pipeConn() (*connection.Connection, *bufio.Reader) {
+	server, client := net.Pipe()
+	return connection.NewConnection(server), bufio.NewReader(client)
+}
+
+// readReply 读取指定字节数的回复
+func readReply(t *testing.T, reader *bufio.Reader, expect string) {
+	buf := make([]byte, len(expect))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(reader, buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("read reply failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %q", expect)
+	}
+	if string(buf) != expect {
+		t.Errorf("expect %q, got %q", expect, buf)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	hub := pubsub.MakeHub()
+	conn, reader := pipeConn()
+
+	go pubsub.Subscribe(hub, conn, utils.ToCmdLine("news", "sport"))
+	readReply(t, reader, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	readReply(t, reader, "*3\r\n$9\r\nsubscribe\r\n$5\r\nsport\r\n:2\r\n")
+	go pubsub.PSubscribe(hub, conn, utils.ToCmdLine("n*"))
+	readReply(t, reader, "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:3\r\n")
+
+	// 频道订阅和模式订阅都会收到消息
+	done := make(chan string, 1)
+	go func() {
+		done <- string(pubsub.Publish(hub, utils.ToCmdLine("news", "hi")).ToBytes())
+	}()
+	readReply(t, reader, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$2\r\nhi\r\n")
+	readReply(t, reader, "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$2\r\nhi\r\n")
+	if res := <-done; res != ":2\r\n" {
+		t.Errorf("expect publish 2, got %q", res)
+	}
+
+	if res := string(pubsub.PubSub(hub, utils.ToCmdLine("numsub", "news", "none")).ToBytes()); res != "*4\r\n$4\r\nnews\r\n:1\r\n$4\r\nnone\r\n:0\r\n" {
+		t.Errorf("unexpected numsub reply %q", res)
+	}
+	if res := string(pubsub.PubSub(hub, utils.ToCmdLine("channels", "s*")).ToBytes()); res != "*1\r\n$5\r\nsport\r\n" {
+		t.Errorf("unexpected channels reply %q", res)
+	}
+
+	// 连接关闭后不再收到消息
+	pubsub.UnsubscribeAll(hub, conn)
+	if conn.SubsCount() != 0 {
+		t.Errorf("expect no subscription, got %d", conn.SubsCount())
+	}
+	if res := string(pubsub.Publish(hub, utils.ToCmdLine("news", "hi")).ToBytes()); res != ":0\r\n" {
+		t.Errorf("expect publish 0, got %q", res)
+	}
+	if res := string(pubsub.PubSub(hub, utils.ToCmdLine("numpat")).ToBytes()); res != ":0\r\n" {
+		t.Errorf("expect numpat 0, got %q", res)
+	}
+}
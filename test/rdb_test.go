@@ -0,0 +1,154 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rdb快照单测
+
+func TestSaveAndLoadRDB(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "dump.rdb")
+	config.Properties = &config.ServerProperties{DbFilename: rdbFile}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	exec("set", "str", "v")
+	exec("set", "ttl", "v", "EX", "1000")
+	exec("set", "expired", "v", "PX", "1")
+	exec("rpush", "list", "a", "b", "c")
+	exec("hset", "hash", "f1", "v1", "f2", "v2")
+	exec("select", "5")
+	exec("sadd", "set", "x", "y")
+	exec("zadd", "zset", "1.5", "m", "+inf", "n")
+	time.Sleep(5 * time.Millisecond)
+	if res := exec("save"); res != "+OK\r\n" {
+		t.Fatalf("expect save ok, got %q", res)
+	}
+	db.Close()
+
+	reloaded := database.NewStandaloneDatabase()
+	defer reloaded.Close()
+	conn2 := &connection.Connection{}
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"get", "str"}, "$1\r\nv\r\n"},
+		{[]string{"ttl", "ttl"}, ":1000\r\n"},
+		{[]string{"exists", "expired"}, ":0\r\n"},
+		{[]string{"lrange", "list", "0", "-1"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"hget", "hash", "f2"}, "$2\r\nv2\r\n"},
+		{[]string{"select", "5"}, ":5\r\n"},
+		{[]string{"smismember", "set", "x", "y", "z"}, "*3\r\n:1\r\n:1\r\n:0\r\n"},
+		{[]string{"zrange", "zset", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nm\r\n$3\r\n1.5\r\n$1\r\nn\r\n$3\r\ninf\r\n"},
+	}
+	for _, c := range cases {
+		if res := string(reloaded.Exec(conn2, utils.ToCmdLine(c.args...)).ToBytes()); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
+
+func TestRDBChecksum(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "dump.rdb")
+	config.Properties = &config.ServerProperties{DbFilename: rdbFile}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	db.Exec(conn, utils.ToCmdLine("set", "k", "value"))
+	db.Exec(conn, utils.ToCmdLine("save"))
+	db.Close()
+
+	// 修改文件中的一个字节后加载会失败
+	data, _ := os.ReadFile(rdbFile)
+	data[len(data)-12] ^= 0xFF
+	_ = os.WriteFile(rdbFile, data, 0600)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expect load corrupted rdb file failed")
+		}
+	}()
+	database.NewStandaloneDatabase()
+}
+
+func TestAutoSave(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "dump.rdb")
+	config.Properties = &config.ServerProperties{DbFilename: rdbFile, Save: "1 2"}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	lastSave := string(db.Exec(conn, utils.ToCmdLine("lastsave")).ToBytes())
+	db.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	db.Exec(conn, utils.ToCmdLine("set", "b", "2"))
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(rdbFile); err != nil {
+		t.Fatalf("expect rdb file saved automatically: %v", err)
+	}
+	if res := string(db.Exec(conn, utils.ToCmdLine("lastsave")).ToBytes()); res == lastSave {
+		t.Errorf("expect lastsave updated, got %q", res)
+	}
+}
+
+func TestSaveWithConcurrentWrites(t *testing.T) {
+	rdbFile := filepath.Join(t.TempDir(), "dump.rdb")
+	config.Properties = &config.ServerProperties{DbFilename: rdbFile}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	const pairs = 20000
+	for i := 0; i < pairs; i++ {
+		db.Exec(conn, utils.ToCmdLine("mset", "x"+strconv.Itoa(i), "0", "y"+strconv.Itoa(i), "0"))
+	}
+	// 保存期间并发地同时修改两个key，快照中两个key的值需要保持一致
+	var wg sync.WaitGroup
+	var writes atomic.Int64
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := &connection.Connection{}
+			for i := w; ; i += 4 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n := strconv.Itoa(i % pairs)
+				db.Exec(c, utils.ToCmdLine("mset", "x"+n, strconv.Itoa(i), "y"+n, strconv.Itoa(i)))
+				writes.Add(1)
+			}
+		}()
+	}
+	for writes.Load() < 100 {
+		time.Sleep(time.Millisecond)
+	}
+	res := string(db.Exec(conn, utils.ToCmdLine("save")).ToBytes())
+	close(stop)
+	wg.Wait()
+	db.Close()
+	if res != "+OK\r\n" {
+		t.Fatalf("expect save ok, got %q", res)
+	}
+
+	reloaded := database.NewStandaloneDatabase()
+	defer reloaded.Close()
+	conn2 := &connection.Connection{}
+	for i := 0; i < pairs; i++ {
+		n := strconv.Itoa(i)
+		x := string(reloaded.Exec(conn2, utils.ToCmdLine("get", "x"+n)).ToBytes())
+		if y := string(reloaded.Exec(conn2, utils.ToCmdLine("get", "y"+n)).ToBytes()); x != y {
+			t.Fatalf("expect x%s equals y%s, got %q and %q", n, n, x, y)
+		}
+	}
+}
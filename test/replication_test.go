@@ -0,0 +1,333 @@
+package test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"redis-go/resp/handler"
+	"redis-go/tcp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 主从复制单测
+
+// startServer 在随机端口上启动服务，返回端口
+func startServer(t *testing.T, db *database.StandaloneDatabase) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go tcp.ListenAndServe(listener, handler.NewHandler(db), closeChan, &tcp.Config{})
+	t.Cleanup(func() { close(closeChan) })
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitFor 等待条件满足
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", desc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	master := database.NewStandaloneDatabase()
+	port := startServer(t, master)
+	masterConn := &connection.Connection{}
+	execMaster := func(args ...string) string {
+		return string(master.Exec(masterConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	execMaster("set", "before", "1")
+	execMaster("rpush", "list", "a", "b")
+
+	replica := database.NewStandaloneDatabase()
+	defer replica.Close()
+	replicaConn := &connection.Connection{}
+	execReplica := func(args ...string) string {
+		return string(replica.Exec(replicaConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	execReplica("set", "stale", "1")
+	if res := execReplica("replicaof", "127.0.0.1", strconv.Itoa(port)); res != "+OK\r\n" {
+		t.Fatalf("replicaof failed: %q", res)
+	}
+	// 全量同步之后原有的数据被替换
+	waitFor(t, "full sync", func() bool {
+		return execReplica("get", "before") == "$1\r\n1\r\n"
+	})
+	if res := execReplica("exists", "stale"); res != ":0\r\n" {
+		t.Errorf("expect stale key removed, got %q", res)
+	}
+	if res := execReplica("lrange", "list", "0", "-1"); res != "*2\r\n$1\r\na\r\n$1\r\nb\r\n" {
+		t.Errorf("unexpected list %q", res)
+	}
+
+	// 同步之后的写入命令通过命令流转发
+	execMaster("incr", "counter")
+	execMaster("select", "2")
+	execMaster("multi")
+	execMaster("set", "tx", "v")
+	execMaster("expire", "tx", "100")
+	execMaster("exec")
+	execMaster("select", "0")
+	execMaster("del", "before")
+	waitFor(t, "command stream", func() bool {
+		return execReplica("exists", "before") == ":0\r\n"
+	})
+	if res := execReplica("get", "counter"); res != "$1\r\n1\r\n" {
+		t.Errorf("unexpected counter %q", res)
+	}
+	execReplica("select", "2")
+	if res := execReplica("get", "tx"); res != "$1\r\nv\r\n" {
+		t.Errorf("unexpected tx value %q", res)
+	}
+	if res := execReplica("ttl", "tx"); res != ":100\r\n" {
+		t.Errorf("unexpected ttl %q", res)
+	}
+
+	// 从节点只读
+	if res := execReplica("set", "k", "v"); !strings.HasPrefix(res, "-READONLY") {
+		t.Errorf("expect readonly error, got %q", res)
+	}
+
+	// role 和 info replication
+	role := execReplica("role")
+	if !strings.HasPrefix(role, "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:"+strconv.Itoa(port)+"\r\n$9\r\nconnected\r\n") {
+		t.Errorf("unexpected replica role %q", role)
+	}
+	info := execReplica("info", "replication")
+	for _, field := range []string{"role:slave", "master_link_status:up", "master_sync_in_progress:0"} {
+		if !strings.Contains(info, field) {
+			t.Errorf("expect %q in replica info, got %q", field, info)
+		}
+	}
+	waitFor(t, "replica ack", func() bool {
+		info := execMaster("info", "replication")
+		offset := infoField(info, "master_repl_offset")
+		return strings.Contains(info, "connected_slaves:1") && strings.Contains(info, "state=online,offset="+offset+",")
+	})
+	if role := execMaster("role"); !strings.HasPrefix(role, "*3\r\n$6\r\nmaster\r\n:") {
+		t.Errorf("unexpected master role %q", role)
+	}
+	if masterOffset, replicaOffset := infoField(execMaster("info"), "master_repl_offset"), infoField(execReplica("info"), "slave_repl_offset"); masterOffset != replicaOffset {
+		t.Errorf("expect replica offset %s equal to master offset %s", replicaOffset, masterOffset)
+	}
+
+	// 暂停客户端期间仍然执行主节点的命令流，也可以断开和主节点的连接
+	execReplica("client", "pause", "10000", "write")
+	execMaster("set", "paused", "1")
+	execReplica("select", "0")
+	waitFor(t, "command stream while paused", func() bool {
+		return execReplica("get", "paused") == "$1\r\n1\r\n"
+	})
+
+	// 提升为主节点之后可以写入
+	if res := execReplica("replicaof", "no", "one"); res != "+OK\r\n" {
+		t.Fatalf("replicaof no one failed: %q", res)
+	}
+	execReplica("client", "unpause")
+	if res := execReplica("set", "k", "v"); res != "+OK\r\n" {
+		t.Errorf("expect writable after promoted, got %q", res)
+	}
+	if info := execReplica("info"); !strings.Contains(info, "role:master") {
+		t.Errorf("expect role master, got %q", info)
+	}
+}
+
+func TestReplicationWithAuth(t *testing.T) {
+	config.Properties = &config.ServerProperties{
+		DbFilename:  filepath.Join(t.TempDir(), "dump.rdb"),
+		RequirePass: "secret",
+		MasterAuth:  "secret",
+	}
+	master := database.NewStandaloneDatabase()
+	port := startServer(t, master)
+	masterConn := &connection.Connection{}
+	master.Exec(masterConn, utils.ToCmdLine("auth", "secret"))
+	master.Exec(masterConn, utils.ToCmdLine("set", "k", "v"))
+
+	replica := database.NewStandaloneDatabase()
+	defer replica.Close()
+	replicaConn := &connection.Connection{}
+	execReplica := func(args ...string) string {
+		return string(replica.Exec(replicaConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	execReplica("auth", "secret")
+	execReplica("replicaof", "127.0.0.1", strconv.Itoa(port))
+	defer execReplica("replicaof", "no", "one")
+	waitFor(t, "sync with auth", func() bool {
+		return execReplica("get", "k") == "$1\r\nv\r\n"
+	})
+}
+
+func TestReplicaOutputBufferLimit(t *testing.T) {
+	config.Properties = &config.ServerProperties{
+		DbFilename:               filepath.Join(t.TempDir(), "dump.rdb"),
+		ReplicaOutputBufferLimit: 64,
+	}
+	master := database.NewStandaloneDatabase()
+	port := startServer(t, master)
+	masterConn := &connection.Connection{}
+	execMaster := func(args ...string) string {
+		return string(master.Exec(masterConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = conn.Write([]byte("*1\r\n$4\r\nSYNC\r\n"))
+	waitFor(t, "replica connected", func() bool {
+		return infoField(execMaster("info", "replication"), "connected_slaves") == "1"
+	})
+	// 命令流超过输出缓冲区的上限时断开从节点
+	execMaster("set", "k", strings.Repeat("v", 100))
+	waitFor(t, "replica disconnected", func() bool {
+		return infoField(execMaster("info", "replication"), "connected_slaves") == "0"
+	})
+}
+
+// infoField 获取info输出中的字段
+func infoField(info, key string) string {
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, ok := strings.CutPrefix(line, key+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// linkProxy 转发从节点和主节点之间的连接，用于模拟网络中断
+type linkProxy struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// startProxy 在随机端口上启动转发到 target 端口的代理，返回代理的端口
+func startProxy(t *testing.T, target int) (*linkProxy, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	proxy := &linkProxy{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(target))
+			if err != nil {
+				_ = conn.Close()
+				continue
+			}
+			proxy.mu.Lock()
+			proxy.conns = append(proxy.conns, conn, upstream)
+			proxy.mu.Unlock()
+			go func() { _, _ = io.Copy(upstream, conn); _ = upstream.Close() }()
+			go func() { _, _ = io.Copy(conn, upstream); _ = conn.Close() }()
+		}
+	}()
+	return proxy, listener.Addr().(*net.TCPAddr).Port
+}
+
+// cut 断开所有经过代理的连接
+func (p *linkProxy) cut() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.conns = nil
+}
+
+func TestPartialResync(t *testing.T) {
+	config.Properties = &config.ServerProperties{
+		DbFilename:      filepath.Join(t.TempDir(), "dump.rdb"),
+		ReplBacklogSize: 1024,
+	}
+	master := database.NewStandaloneDatabase()
+	proxy, port := startProxy(t, startServer(t, master))
+	masterConn := &connection.Connection{}
+	execMaster := func(args ...string) string {
+		return string(master.Exec(masterConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	replica := database.NewStandaloneDatabase()
+	defer replica.Close()
+	replicaConn := &connection.Connection{}
+	execReplica := func(args ...string) string {
+		return string(replica.Exec(replicaConn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	execMaster("set", "a", "1")
+	execReplica("replicaof", "127.0.0.1", strconv.Itoa(port))
+	waitFor(t, "full sync", func() bool {
+		return execReplica("get", "a") == "$1\r\n1\r\n"
+	})
+	execMaster("select", "3")
+	execMaster("set", "b", "1")
+	waitFor(t, "command stream", func() bool {
+		return infoField(execReplica("info"), "slave_repl_offset") == infoField(execMaster("info"), "master_repl_offset")
+	})
+
+	// 短暂断线期间的写入通过积压缓冲区补发，选择的db在重连后保持不变
+	proxy.cut()
+	waitFor(t, "link down", func() bool {
+		return infoField(execMaster("info"), "connected_slaves") == "0"
+	})
+	execMaster("set", "c", "1")
+	waitFor(t, "partial resync", func() bool {
+		return infoField(execMaster("info"), "sync_partial_ok") == "1"
+	})
+	waitFor(t, "command stream after partial resync", func() bool {
+		return infoField(execReplica("info"), "slave_repl_offset") == infoField(execMaster("info"), "master_repl_offset")
+	})
+	execReplica("select", "3")
+	if res := execReplica("get", "c"); res != "$1\r\n1\r\n" {
+		t.Errorf("expect key written during disconnection, got %q", res)
+	}
+	if full := infoField(execMaster("info"), "sync_full"); full != "1" {
+		t.Errorf("expect only one full sync, got %s", full)
+	}
+
+	// 断线期间的写入超出积压缓冲区时只能全量同步
+	proxy.cut()
+	waitFor(t, "link down", func() bool {
+		return infoField(execMaster("info"), "connected_slaves") == "0"
+	})
+	execMaster("set", "big", strings.Repeat("x", 2048))
+	waitFor(t, "full resync", func() bool {
+		return infoField(execMaster("info"), "sync_full") == "2"
+	})
+	waitFor(t, "snapshot loaded", func() bool {
+		return execReplica("strlen", "big") == ":2048\r\n"
+	})
+
+	// 提升为主节点后保留原来的复制id，原主节点的其他从节点可以继续部分同步
+	masterID := infoField(execMaster("info"), "master_replid")
+	execReplica("replicaof", "no", "one")
+	info := execReplica("info", "replication")
+	if infoField(info, "master_replid2") != masterID || infoField(info, "master_replid") == masterID {
+		t.Errorf("expect replid shifted after promoted, got %q", info)
+	}
+	if infoField(info, "second_repl_offset") != strconv.Itoa(mustAtoi(infoField(info, "master_repl_offset"))+1) {
+		t.Errorf("unexpected second_repl_offset: %q", info)
+	}
+}
+
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
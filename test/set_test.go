@@ -0,0 +1,71 @@
+package test
+
+import (
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 集合相关命令单测
+
+// sortedMembers 解析多行回复中的成员并排序，集合的返回顺序是不确定的
+func sortedMembers(raw string) []string {
+	lines := strings.Split(strings.TrimSuffix(raw, "\r\n"), "\r\n")
+	members := make([]string, 0)
+	for i := 2; i < len(lines); i += 2 {
+		members = append(members, lines[i])
+	}
+	sort.Strings(members)
+	return members
+}
+
+func TestSetCommands(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	db.Exec(nil, utils.ToCmdLine("sadd", "s1", "a", "b", "c", "d"))
+	db.Exec(nil, utils.ToCmdLine("sadd", "s2", "c", "d", "e"))
+	if res := execString(db, "sadd", "s1", "a", "x"); res != ":1\r\n" {
+		t.Errorf("expect sadd 1, got %q", res)
+	}
+	if res := strings.Join(sortedMembers(execString(db, "sinter", "s1", "s2")), ","); res != "c,d" {
+		t.Errorf("expect sinter c,d, got %q", res)
+	}
+	if res := strings.Join(sortedMembers(execString(db, "sdiff", "s1", "s2")), ","); res != "a,b,x" {
+		t.Errorf("expect sdiff a,b,x, got %q", res)
+	}
+	if res := execString(db, "sunionstore", "s3", "s1", "s2", "none"); res != ":6\r\n" {
+		t.Errorf("expect sunionstore 6, got %q", res)
+	}
+	if res := execString(db, "type", "s3"); res != "+set\r\n" {
+		t.Errorf("expect type set, got %q", res)
+	}
+	if res := execString(db, "spop", "s3", "2"); len(sortedMembers(res)) != 2 {
+		t.Errorf("expect spop 2 members, got %q", res)
+	}
+	if res := execString(db, "scard", "s3"); res != ":4\r\n" {
+		t.Errorf("expect scard 4, got %q", res)
+	}
+	if res := execString(db, "srandmember", "s3", "-10"); len(sortedMembers(res)) != 10 {
+		t.Errorf("expect srandmember 10 members, got %q", res)
+	}
+	if res := execString(db, "srandmember", "s3", "10"); len(sortedMembers(res)) != 4 {
+		t.Errorf("expect srandmember 4 members, got %q", res)
+	}
+	// count 超出范围时不会按照count预分配空间
+	if res := execString(db, "srandmember", "s3", "9223372036854775807"); len(sortedMembers(res)) != 4 {
+		t.Errorf("expect srandmember 4 members, got %q", res)
+	}
+	if res := execString(db, "srandmember", "s3", "-9223372036854775808"); res != "-ERR value is out of range\r\n" {
+		t.Errorf("expect srandmember out of range, got %q", res)
+	}
+	if res := execString(db, "spop", "s3", "9223372036854775807"); len(sortedMembers(res)) != 4 {
+		t.Errorf("expect spop 4 members, got %q", res)
+	}
+	if res := execString(db, "sinterstore", "s3", "s1", "none"); res != ":0\r\n" {
+		t.Errorf("expect sinterstore 0, got %q", res)
+	}
+	if res := execString(db, "exists", "s3"); res != ":0\r\n" {
+		t.Errorf("expect empty store result removed, got %q", res)
+	}
+}
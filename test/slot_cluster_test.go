@@ -0,0 +1,125 @@
+package test
+
+import (
+	"path/filepath"
+	"redis-go/cluster"
+	"redis-go/config"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"strings"
+	"testing"
+)
+
+// 哈希槽集群模式单测
+
+func TestKeySlot(t *testing.T) {
+	// 和redis的 CLUSTER KEYSLOT 结果一致
+	cases := map[string]int{
+		"foo":                  12182,
+		"hello":                866,
+		"somekey":              11058,
+		"{user1000}.following": cluster.KeySlot("user1000"),
+		"foo{}{bar}":           cluster.KeySlot("foo{}{bar}"),
+		"foo{{bar}}zap":        cluster.KeySlot("{bar"),
+	}
+	for key, expected := range cases {
+		if slot := cluster.KeySlot(key); slot != expected {
+			t.Fatalf("keyslot %s: expected %d, got %d", key, expected, slot)
+		}
+	}
+}
+
+func TestSlotCluster(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	addrs := []string{"127.0.0.1:7001", "127.0.0.1:7000"}
+	// 按照地址排序后分配，7000 负责 0-8191，7001 负责 8192-16383
+	node0 := cluster.NewSlotClusterDatabase(addrs[1], addrs)
+	node1 := cluster.NewSlotClusterDatabase(addrs[0], addrs)
+	defer node0.Close()
+	defer node1.Close()
+	conn0, conn1 := &connection.Connection{}, &connection.Connection{}
+	exec0 := func(args ...string) string {
+		return string(node0.Exec(conn0, utils.ToCmdLine(args...)).ToBytes())
+	}
+	exec1 := func(args ...string) string {
+		return string(node1.Exec(conn1, utils.ToCmdLine(args...)).ToBytes())
+	}
+
+	if res := exec0("set", "foo", "1"); res != "-MOVED 12182 127.0.0.1:7001\r\n" {
+		t.Fatalf("set foo: %q", res)
+	}
+	if res := exec1("set", "foo", "1"); res != "+OK\r\n" {
+		t.Fatalf("set foo: %q", res)
+	}
+	if res := exec0("set", "hello", "1"); res != "+OK\r\n" {
+		t.Fatalf("set hello: %q", res)
+	}
+	if res := exec0("mset", "hello", "1", "foo", "2"); res != "-CROSSSLOT Keys in request don't hash to the same slot\r\n" {
+		t.Fatalf("mset: %q", res)
+	}
+	if res := exec0("select", "1"); res != "-ERR SELECT is not allowed in cluster mode\r\n" {
+		t.Fatalf("select: %q", res)
+	}
+	if res := exec0("ping"); res != "+PONG\r\n" {
+		t.Fatalf("ping: %q", res)
+	}
+
+	// 客户端获取槽的分布
+	if res := exec0("cluster", "keyslot", "foo"); res != ":12182\r\n" {
+		t.Fatalf("cluster keyslot: %q", res)
+	}
+	id0 := strings.Split(exec0("cluster", "myid"), "\r\n")[1]
+	id1 := strings.Split(exec1("cluster", "myid"), "\r\n")[1]
+	expected := "*2\r\n" +
+		"*3\r\n:0\r\n:8191\r\n*3\r\n$9\r\n127.0.0.1\r\n:7000\r\n$40\r\n" + id0 + "\r\n" +
+		"*3\r\n:8192\r\n:16383\r\n*3\r\n$9\r\n127.0.0.1\r\n:7001\r\n$40\r\n" + id1 + "\r\n"
+	if res := exec1("cluster", "slots"); res != expected {
+		t.Fatalf("cluster slots: %q", res)
+	}
+	nodes := exec0("cluster", "nodes")
+	if !strings.Contains(nodes, id0+" 127.0.0.1:7000@17000 myself,master - 0 0 0 connected 0-8191\n") ||
+		!strings.Contains(nodes, id1+" 127.0.0.1:7001@17001 master - 0 0 0 connected 8192-16383\n") {
+		t.Fatalf("cluster nodes: %q", nodes)
+	}
+	if res := exec0("cluster", "shards"); !strings.HasPrefix(res, "*2\r\n*4\r\n$5\r\nslots\r\n*2\r\n:0\r\n:8191\r\n$5\r\nnodes\r\n") {
+		t.Fatalf("cluster shards: %q", res)
+	}
+
+	// 迁移槽 866，已经迁走的key返回 ASK，目标节点只有在 ASKING 之后才执行
+	if res := exec0("cluster", "setslot", "866", "migrating", id1); res != "+OK\r\n" {
+		t.Fatalf("setslot migrating: %q", res)
+	}
+	if res := exec1("cluster", "setslot", "866", "importing", id0); res != "+OK\r\n" {
+		t.Fatalf("setslot importing: %q", res)
+	}
+	if res := exec0("get", "hello"); res != "$1\r\n1\r\n" {
+		t.Fatalf("existing key should be served: %q", res)
+	}
+	if res := exec0("set", "{hello}new", "1"); res != "-ASK 866 127.0.0.1:7001\r\n" {
+		t.Fatalf("missing key should be redirected: %q", res)
+	}
+	if res := exec0("mget", "hello", "{hello}new"); !strings.HasPrefix(res, "-TRYAGAIN") {
+		t.Fatalf("partially migrated keys: %q", res)
+	}
+	if res := exec1("set", "{hello}new", "1"); res != "-MOVED 866 127.0.0.1:7000\r\n" {
+		t.Fatalf("importing slot without asking: %q", res)
+	}
+	exec1("asking")
+	if res := exec1("set", "{hello}new", "1"); res != "+OK\r\n" {
+		t.Fatalf("importing slot with asking: %q", res)
+	}
+	if res := exec1("get", "{hello}new"); res != "-MOVED 866 127.0.0.1:7000\r\n" {
+		t.Fatalf("asking should only affect the next command: %q", res)
+	}
+	exec0("cluster", "setslot", "866", "node", id1)
+	exec1("cluster", "setslot", "866", "node", id1)
+	if res := exec1("get", "{hello}new"); res != "$1\r\n1\r\n" {
+		t.Fatalf("get after migration: %q", res)
+	}
+	if res := exec0("get", "{hello}new"); res != "-MOVED 866 127.0.0.1:7001\r\n" {
+		t.Fatalf("get after migration: %q", res)
+	}
+	if nodes := exec0("cluster", "nodes"); !strings.Contains(nodes, "connected 0-865 867-8191\n") {
+		t.Fatalf("cluster nodes after migration: %q", nodes)
+	}
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"redis-go/database"
+	"testing"
+)
+
+// 有序集合相关命令单测
+
+func TestSortedSetCommands(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"zadd", "z", "1", "a", "2", "b", "3", "c"}, ":3\r\n"},
+		{[]string{"type", "z"}, "+zset\r\n"},
+		{[]string{"zadd", "z", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"zadd", "z", "GT", "LT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"zadd", "z", "CH", "GT", "0", "a", "5", "b", "4", "d"}, ":2\r\n"},
+		{[]string{"zadd", "z", "XX", "INCR", "1", "none"}, "$-1\r\n"},
+		{[]string{"zincrby", "z", "1.5", "a"}, "$3\r\n2.5\r\n"},
+		{[]string{"zscore", "z", "b"}, "$1\r\n5\r\n"},
+		{[]string{"zrank", "z", "c"}, ":1\r\n"},
+		{[]string{"zrevrank", "z", "c", "WITHSCORE"}, "*2\r\n:2\r\n$1\r\n3\r\n"},
+		{[]string{"zrange", "z", "0", "-1"}, "*4\r\n$1\r\na\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\nb\r\n"},
+		{[]string{"zrange", "z", "(5", "3", "BYSCORE", "REV", "LIMIT", "1", "1", "WITHSCORES"}, "*2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"zrange", "z", "0", "1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{[]string{"zrangebyscore", "z", "-inf", "(3"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"zcount", "z", "3", "+inf"}, ":3\r\n"},
+		{[]string{"zcount", "z", "x", "+inf"}, "-ERR min or max is not a float\r\n"},
+		{[]string{"zpopmax", "z", "2"}, "*4\r\n$1\r\nb\r\n$1\r\n5\r\n$1\r\nd\r\n$1\r\n4\r\n"},
+		{[]string{"zremrangebyrank", "z", "0", "0"}, ":1\r\n"},
+		{[]string{"zrem", "z", "c", "x"}, ":1\r\n"},
+		{[]string{"exists", "z"}, ":0\r\n"},
+		{[]string{"zadd", "lex", "0", "a", "0", "b", "0", "c", "0", "d"}, ":4\r\n"},
+		{[]string{"zlexcount", "lex", "[b", "+"}, ":3\r\n"},
+		{[]string{"zrevrangebylex", "lex", "(d", "-", "LIMIT", "0", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"zremrangebylex", "lex", "-", "[b"}, ":2\r\n"},
+		{[]string{"zcard", "lex"}, ":2\r\n"},
+		{[]string{"zpopmin", "lex", "9223372036854775807"}, "*4\r\n$1\r\nc\r\n$1\r\n0\r\n$1\r\nd\r\n$1\r\n0\r\n"},
+		{[]string{"exists", "lex"}, ":0\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"sync"
+	"testing"
+)
+
+// 字符串相关命令单测
+
+func execString(db *database.DB, args ...string) string {
+	return string(db.Exec(nil, utils.ToCmdLine(args...)).ToBytes())
+}
+
+func TestSetOptions(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"set", "k", "v1", "XX"}, "$-1\r\n"},
+		{[]string{"set", "k", "v1", "NX", "EX", "100"}, "+OK\r\n"},
+		{[]string{"ttl", "k"}, ":100\r\n"},
+		{[]string{"set", "k", "v2", "NX"}, "$-1\r\n"},
+		{[]string{"set", "k", "v2", "XX", "KEEPTTL", "GET"}, "$2\r\nv1\r\n"},
+		{[]string{"ttl", "k"}, ":100\r\n"},
+		{[]string{"set", "k", "v3", "GET"}, "$2\r\nv2\r\n"},
+		{[]string{"ttl", "k"}, ":-1\r\n"},
+		{[]string{"set", "k", "v3", "NX", "XX"}, "-ERR syntax error\r\n"},
+		{[]string{"set", "k", "v3", "EX", "10", "KEEPTTL"}, "-ERR syntax error\r\n"},
+		{[]string{"set", "k", "v3", "EX", "10", "PX", "100"}, "-ERR syntax error\r\n"},
+		{[]string{"set", "k", "v3", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"set", "k", "v3", "EX", "9223372036854775"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"set", "k", "v3", "PX"}, "-ERR syntax error\r\n"},
+		{[]string{"setex", "k", "10", "v4"}, "+OK\r\n"},
+		{[]string{"get", "k"}, "$2\r\nv4\r\n"},
+		{[]string{"ttl", "k"}, ":10\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"incr", "n"}, ":1\r\n"},
+		{[]string{"incrby", "n", "9"}, ":10\r\n"},
+		{[]string{"decrby", "n", "-5"}, ":15\r\n"},
+		{[]string{"decr", "n"}, ":14\r\n"},
+		{[]string{"incrby", "n", "9223372036854775807"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"incrbyfloat", "n", "0.5"}, "$4\r\n14.5\r\n"},
+		{[]string{"incr", "n"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"incrbyfloat", "n", "abc"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"rpush", "l", "a"}, ":1\r\n"},
+		{[]string{"incr", "l"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+
+	// 并发自增不应该丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				db.Exec(nil, utils.ToCmdLine("incr", "counter"))
+			}
+		}()
+	}
+	wg.Wait()
+	if res := execString(db, "get", "counter"); res != "$4\r\n5000\r\n" {
+		t.Errorf("expect counter 5000, got %q", res)
+	}
+}
+
+func TestMultiKeyStrings(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"append", "s", "Hello"}, ":5\r\n"},
+		{[]string{"append", "s", " World"}, ":11\r\n"},
+		{[]string{"getrange", "s", "-5", "-1"}, "$5\r\nWorld\r\n"},
+		{[]string{"getrange", "s", "0", "-100"}, "$1\r\nH\r\n"},
+		{[]string{"getrange", "s", "5", "3"}, "$0\r\n\r\n"},
+		{[]string{"setrange", "s", "6", "Redis"}, ":11\r\n"},
+		{[]string{"setrange", "pad", "3", "x"}, ":4\r\n"},
+		{[]string{"get", "pad"}, "$4\r\n\x00\x00\x00x\r\n"},
+		{[]string{"setrange", "s", "9223372036854775807", "x"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+		{[]string{"mset", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{[]string{"mset", "a", "1", "b", "2"}, "+OK\r\n"},
+		{[]string{"rpush", "l", "x"}, ":1\r\n"},
+		{[]string{"mget", "a", "none", "l", "s"}, "*4\r\n$1\r\n1\r\n$-1\r\n$-1\r\n$11\r\nHello Redis\r\n"},
+		{[]string{"msetnx", "c", "3", "a", "x"}, ":0\r\n"},
+		{[]string{"exists", "c"}, ":0\r\n"},
+		{[]string{"msetnx", "c", "3", "d", "4"}, ":1\r\n"},
+		{[]string{"getex", "c", "EX", "100"}, "$1\r\n3\r\n"},
+		{[]string{"ttl", "c"}, ":100\r\n"},
+		{[]string{"getex", "c", "PERSIST"}, "$1\r\n3\r\n"},
+		{[]string{"ttl", "c"}, ":-1\r\n"},
+		{[]string{"getdel", "c"}, "$1\r\n3\r\n"},
+		{[]string{"getdel", "c"}, "$-1\r\n"},
+	}
+	for _, c := range cases {
+		if res := execString(db, c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"path/filepath"
+	"redis-go/config"
+	"redis-go/database"
+	"redis-go/lib/utils"
+	"redis-go/resp/connection"
+	"strconv"
+	"testing"
+)
+
+// 事务相关命令单测
+
+func TestMultiExec(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"exec"}, "-ERR EXEC without MULTI\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"multi"}, "-ERR MULTI calls can not be nested\r\n"},
+		{[]string{"set", "a", "1"}, "+QUEUED\r\n"},
+		{[]string{"incr", "a"}, "+QUEUED\r\n"},
+		{[]string{"rpush", "a", "x"}, "+QUEUED\r\n"},
+		{[]string{"get", "a"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "*4\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n$1\r\n2\r\n"},
+		// 入队时出错会放弃整个事务
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "3"}, "+QUEUED\r\n"},
+		{[]string{"get"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{[]string{"exec"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"get", "a"}, "$1\r\n2\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "3"}, "+QUEUED\r\n"},
+		{[]string{"discard"}, "+OK\r\n"},
+		{[]string{"get", "a"}, "$1\r\n2\r\n"},
+	}
+	for _, c := range cases {
+		if res := exec(c.args...); res != c.expect {
+			t.Errorf("%v: expect %q, got %q", c.args, c.expect, res)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	db := database.NewDB(database.WithIndex(0))
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	// watch 的key被其他客户端修改后事务放弃执行
+	exec("watch", "a")
+	execString(db, "set", "a", "other")
+	exec("multi")
+	exec("set", "a", "mine")
+	if res := exec("exec"); res != "*-1\r\n" {
+		t.Errorf("expect exec aborted, got %q", res)
+	}
+	if res := exec("get", "a"); res != "$5\r\nother\r\n" {
+		t.Errorf("expect value unchanged, got %q", res)
+	}
+	// exec 之后watch会被清空，未被修改的key事务正常执行
+	exec("watch", "a")
+	exec("multi")
+	if res := exec("watch", "a"); res != "-ERR WATCH inside MULTI is not allowed\r\n" {
+		t.Errorf("expect watch inside multi error, got %q", res)
+	}
+	exec("set", "a", "mine")
+	if res := exec("exec"); res != "*1\r\n+OK\r\n" {
+		t.Errorf("expect exec success, got %q", res)
+	}
+	// unwatch 之后修改key不会影响事务
+	exec("watch", "a")
+	exec("unwatch")
+	execString(db, "set", "a", "other")
+	exec("multi")
+	exec("get", "a")
+	if res := exec("exec"); res != "*1\r\n$5\r\nother\r\n" {
+		t.Errorf("expect exec success after unwatch, got %q", res)
+	}
+}
+
+func TestMultiSelect(t *testing.T) {
+	aofFile := filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties = &config.ServerProperties{AppendOnly: true, AppendFilename: aofFile}
+	db := database.NewStandaloneDatabase()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	// watch 的key只和所在db中的同名key比较
+	exec("watch", "a")
+	exec("select", "1")
+	exec("set", "a", "other")
+	exec("select", "0")
+	exec("multi")
+	exec("set", "a", "0")
+	if res := exec("select", "1"); res != "+QUEUED\r\n" {
+		t.Fatalf("expect select queued, got %q", res)
+	}
+	exec("set", "b", "1")
+	exec("select", "2")
+	exec("set", "c", "2")
+	if res := exec("exec"); res != "*5\r\n+OK\r\n:1\r\n+OK\r\n:2\r\n+OK\r\n" {
+		t.Fatalf("unexpected exec reply %q", res)
+	}
+	// exec 之后连接停留在事务中最后选择的db
+	if res := exec("get", "c"); res != "$1\r\n2\r\n" {
+		t.Errorf("expect db 2 selected after exec, got %q", res)
+	}
+	exec("set", "d", "3")
+	db.Close()
+
+	// aof中事务之后的命令仍然写入正确的db
+	reloaded := database.NewStandaloneDatabase()
+	defer reloaded.Close()
+	conn = &connection.Connection{}
+	for _, c := range []struct{ db, key, value string }{{"0", "a", "0"}, {"1", "a", "other"}, {"1", "b", "1"}, {"2", "c", "2"}, {"2", "d", "3"}} {
+		reloaded.Exec(conn, utils.ToCmdLine("select", c.db))
+		if res := string(reloaded.Exec(conn, utils.ToCmdLine("get", c.key)).ToBytes()); res != "$"+strconv.Itoa(len(c.value))+"\r\n"+c.value+"\r\n" {
+			t.Errorf("db%s %s: expect %q, got %q", c.db, c.key, c.value, res)
+		}
+	}
+}
+
+func TestMultiPublish(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	// 发布消息的命令入队，exec时执行
+	exec("multi")
+	if res := exec("publish", "ch", "hi"); res != "+QUEUED\r\n" {
+		t.Fatalf("expect publish queued, got %q", res)
+	}
+	exec("pubsub", "numsub", "ch")
+	if res := exec("exec"); res != "*2\r\n:0\r\n*2\r\n$2\r\nch\r\n:0\r\n" {
+		t.Fatalf("unexpected exec reply %q", res)
+	}
+	// 订阅相关的命令不允许在事务中执行
+	exec("multi")
+	if res := exec("subscribe", "ch"); res != "-ERR Command not allowed inside a transaction\r\n" {
+		t.Fatalf("expect subscribe rejected, got %q", res)
+	}
+	if res := exec("exec"); res != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Fatalf("expect exec aborted, got %q", res)
+	}
+}
+
+func TestMultiNotAllowed(t *testing.T) {
+	config.Properties = &config.ServerProperties{DbFilename: filepath.Join(t.TempDir(), "dump.rdb")}
+	db := database.NewStandaloneDatabase()
+	defer db.Close()
+	conn := &connection.Connection{}
+	exec := func(args ...string) string {
+		return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	// 服务端管理相关的命令不能在事务中执行，之后exec会放弃整个事务
+	for _, args := range [][]string{
+		{"bgrewriteaof"},
+		{"save"},
+		{"bgsave"},
+		{"lastsave"},
+		{"replicaof", "no", "one"},
+		{"slaveof", "no", "one"},
+		{"role"},
+		{"info"},
+		{"auth", "pw"},
+		{"hello", "2"},
+		{"acl", "whoami"},
+		{"client", "id"},
+	} {
+		exec("multi")
+		if res := exec(args...); res != "-ERR Command not allowed inside a transaction\r\n" {
+			t.Errorf("%v: expect not allowed inside a transaction, got %q", args, res)
+		}
+		if res := exec("exec"); res != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+			t.Errorf("%v: expect exec aborted, got %q", args, res)
+		}
+	}
+}